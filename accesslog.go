@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogger 以 Apache Combined Log Format 写入访问日志, 与结构化应用日志分开
+type AccessLogger struct {
+	out   io.Writer
+	file  io.Closer // 写到标准输出时为 nil
+	mutex sync.Mutex
+}
+
+// 未设置 ACCESS_LOG 时为 nil, 不记录访问日志
+var accessLog *AccessLogger
+
+// path 为 "-" 时写到标准输出, 否则追加写入该文件, 按 rotate 轮转
+func NewAccessLogger(path string, rotate RotateConfig) (*AccessLogger, error) {
+	if path == "-" {
+		return &AccessLogger{out: os.Stdout}, nil
+	}
+	f, err := openLogFile(path, rotate, systemClock)
+	if err != nil {
+		return nil, err
+	}
+	return &AccessLogger{out: f, file: f}, nil
+}
+
+// 写入一行, 加锁保证并发请求的行不会交错; 写入失败只记录应用日志
+func (l *AccessLogger) Log(line string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if _, err := io.WriteString(l.out, line); err != nil {
+		slog.Error("写入访问日志失败", "event", "access_log_error", "error", err)
+	}
+}
+
+func (l *AccessLogger) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// 记录响应状态码和响应体字节数
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogWriter) WriteHeader(code int) {
+	// 1xx 信息性响应之后还会有最终响应
+	if w.status == 0 && code >= 200 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// /events 和导出接口依赖 http.Flusher
+func (w *accessLogWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// 每个请求结束后写一行访问日志, 客户端地址按 TRUSTED_PROXIES 解析
+func accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if accessLog == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		lw := &accessLogWriter{ResponseWriter: w}
+		defer func() {
+			accessLog.Log(combinedLogLine(r, getClientIP(r), start, lw.status, lw.bytes))
+		}()
+		next.ServeHTTP(lw, r)
+	})
+}
+
+// %h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i"
+func combinedLogLine(r *http.Request, ip string, start time.Time, status int, bytes int64) string {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	size := "-"
+	if bytes > 0 {
+		size = strconv.FormatInt(bytes, 10)
+	}
+	return fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"\n",
+		persistedIP(ip), start.Format("02/Jan/2006:15:04:05 -0700"),
+		escapeLogField(r.Method), escapeLogField(r.RequestURI), escapeLogField(r.Proto),
+		status, size, logFieldOrDash(r.Referer()), logFieldOrDash(r.UserAgent()))
+}
+
+func logFieldOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return escapeLogField(s)
+}
+
+// 与 Apache 相同: 引号和反斜杠前加反斜杠, 控制字符和非 ASCII 字节写成 \xhh, 防止伪造日志行
+func escapeLogField(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
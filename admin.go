@@ -0,0 +1,80 @@
+package main
+
+import (
+	_ "embed"
+	"html/template"
+	"log/slog"
+	"net/http"
+)
+
+// 管理页面自动刷新间隔 (秒)
+const adminRefreshSeconds = 30
+
+// 管理页面: 以 HTML 表格列出最近的提交, limit 默认 50
+// 记录中的 User-Agent 等字段由客户端提交, 必须经 html/template 转义后输出
+func adminHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		sendResponse(w, r, http.StatusMethodNotAllowed, Response{
+			Status:  "error",
+			Code:    "method_not_allowed",
+			Message: "Only GET method is allowed",
+		})
+		return
+	}
+
+	limit, err := queryInt(r, "limit", defaultPageLimit)
+	if err != nil || limit == 0 {
+		sendResponse(w, r, http.StatusBadRequest, Response{
+			Status:  "error",
+			Code:    "invalid_param",
+			Message: "limit 必须是正整数",
+		})
+		return
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	if store == nil {
+		sendResponse(w, r, http.StatusNotFound, Response{
+			Status:  "error",
+			Code:    "not_enabled",
+			Message: "设备存储未启用",
+		})
+		return
+	}
+
+	records, err := store.List(r.Context(), limit, 0)
+	if err != nil {
+		sendResponse(w, r, http.StatusInternalServerError, Response{
+			Status:  "error",
+			Code:    "storage_error",
+			Message: "读取设备信息失败: " + err.Error(),
+		})
+		return
+	}
+
+	// 页面不含脚本: 单独设置禁止一切脚本的 CSP, 不受 SECURITY_HEADERS 影响
+	// 即使某个字段漏掉转义, 注入的脚本也不会执行
+	h := w.Header()
+	h.Set("Content-Security-Policy", adminCSP)
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Cache-Control", "no-store")
+	if err := adminTemplate.Execute(w, adminData{Records: records, Refresh: adminRefreshSeconds}); err != nil {
+		slog.ErrorContext(r.Context(), "渲染管理页面失败", "event", "render_error", "error", err)
+	}
+}
+
+const adminCSP = "default-src 'none'; style-src 'unsafe-inline'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'"
+
+// 管理页面模板参数
+type adminData struct {
+	Records []DeviceInfo
+	Refresh int
+}
+
+var adminTemplate = template.Must(template.New("admin").Parse(adminHTML))
+
+//go:embed admin.html
+var adminHTML string
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 管理页面中的存储数据经过 html/template 转义, 注入的标签不会原样输出
+func TestAdminPageEscapes(t *testing.T) {
+	tests := []struct {
+		name    string
+		info    DeviceInfo
+		raw     string
+		escaped string
+	}{
+		{"user agent script", DeviceInfo{UserAgent: "<script>alert(1)</script>"}, "<script>alert(1)</script>", "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{"os version tag", DeviceInfo{OSVersion: `<img src=x onerror=alert(1)>`}, "<img", "&lt;img src=x onerror=alert(1)&gt;"},
+		{"device id closes cell", DeviceInfo{DeviceID: `</td><script>x</script>`}, "</td><script>", "&lt;/td&gt;&lt;script&gt;"},
+		{"quotes", DeviceInfo{UserAgent: `"><svg onload=alert(1)>`}, `"><svg`, "&#34;&gt;&lt;svg onload=alert(1)&gt;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewRingStore(10)
+			useStore(t, s)
+			tt.info.Timestamp = "2024-01-01 12:00:00"
+			if err := s.Insert(context.Background(), tt.info); err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			adminHandler(w, httptest.NewRequest("GET", "/admin", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			body := w.Body.String()
+			if strings.Contains(body, tt.raw) {
+				t.Errorf("page contains unescaped %q", tt.raw)
+			}
+			if !strings.Contains(body, tt.escaped) {
+				t.Errorf("page does not contain %q", tt.escaped)
+			}
+			if csp := w.Header().Get("Content-Security-Policy"); csp != adminCSP {
+				t.Errorf("Content-Security-Policy = %q", csp)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// k-匿名导出的默认 k, 也是允许的最小值 (ANON_K 环境变量)
+var anonK = 5
+
+// 可参与 k-匿名汇总的字段: 只包含粗粒度的属性, 不含指纹、IP、设备ID 等可直接识别设备的字段
+var anonFields = map[string]func(DeviceInfo) string{
+	"deviceType":     func(i DeviceInfo) string { return i.DeviceType },
+	"osVersion":      func(i DeviceInfo) string { return i.OSVersion },
+	"browserVersion": func(i DeviceInfo) string { return i.BrowserVersion },
+	"language":       func(i DeviceInfo) string { return i.Language },
+	"timezone":       func(i DeviceInfo) string { return i.Timezone },
+	"screen":         func(i DeviceInfo) string { return i.Screen },
+	"geoCountry":     func(i DeviceInfo) string { return i.GeoCountry },
+	"gpuVendor":      func(i DeviceInfo) string { return i.GPUVendor },
+	"deviceTier":     func(i DeviceInfo) string { return i.DeviceTier },
+}
+
+// 未指定 fields 时汇总的字段
+var defaultAnonFields = []string{"deviceType", "osVersion", "browserVersion", "language", "geoCountry"}
+
+// AnonExport k-匿名汇总结果: 只输出至少 K 条记录共有的字段取值组合
+type AnonExport struct {
+	K          int         `json:"k" xml:"k"`
+	Fields     []string    `json:"fields" xml:"fields>field"`
+	Total      int         `json:"total" xml:"total"`
+	Suppressed int         `json:"suppressed" xml:"suppressed"` // 所在组合不足 K 条而未输出的记录数
+	Groups     []AnonGroup `json:"groups" xml:"groups>group"`
+}
+
+// AnonGroup 一个字段取值组合及其记录数
+type AnonGroup struct {
+	Values XMLMap[string] `json:"values" xml:"values"`
+	Count  int            `json:"count" xml:"count"`
+}
+
+// AnonAggregator 按 fields 逐条汇总记录, 结果中丢弃记录数少于 k 的组合
+type AnonAggregator struct {
+	k      int
+	fields []string
+	counts map[string]int
+	total  int
+}
+
+func NewAnonAggregator(k int, fields []string) *AnonAggregator {
+	return &AnonAggregator{k: k, fields: fields, counts: make(map[string]int)}
+}
+
+func (a *AnonAggregator) Add(info DeviceInfo) {
+	values := make([]string, len(a.fields))
+	for i, f := range a.fields {
+		values[i] = anonFields[f](info)
+	}
+	a.counts[strings.Join(values, "\x00")]++
+	a.total++
+}
+
+// 汇总结果, 组合按记录数从多到少排列
+func (a *AnonAggregator) Result() AnonExport {
+	result := AnonExport{K: a.k, Fields: a.fields, Total: a.total, Groups: []AnonGroup{}}
+	for key, count := range a.counts {
+		if count < a.k {
+			result.Suppressed += count
+			continue
+		}
+		values := make(XMLMap[string], len(a.fields))
+		for i, v := range strings.Split(key, "\x00") {
+			values[a.fields[i]] = v
+		}
+		result.Groups = append(result.Groups, AnonGroup{Values: values, Count: count})
+	}
+	sort.Slice(result.Groups, func(i, j int) bool {
+		gi, gj := result.Groups[i], result.Groups[j]
+		if gi.Count != gj.Count {
+			return gi.Count > gj.Count
+		}
+		for _, f := range a.fields {
+			if gi.Values[f] != gj.Values[f] {
+				return gi.Values[f] < gj.Values[f]
+			}
+		}
+		return false
+	})
+	return result
+}
+
+// k-匿名汇总导出: GET /export/anon?k=5&fields=deviceType,osVersion
+// k 默认为 ANON_K 且不能小于它, fields 从 anonFields 中选择
+func anonExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		sendResponse(w, r, http.StatusMethodNotAllowed, Response{
+			Status:  "error",
+			Code:    "method_not_allowed",
+			Message: "Only GET method is allowed",
+		})
+		return
+	}
+
+	k := anonK
+	if v := r.URL.Query().Get("k"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < anonK {
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Status:  "error",
+				Code:    "invalid_param",
+				Message: fmt.Sprintf("k 必须是不小于 %d 的整数", anonK),
+			})
+			return
+		}
+		k = n
+	}
+
+	fields := defaultAnonFields
+	if v := r.URL.Query().Get("fields"); v != "" {
+		fields = splitList(v)
+		if len(fields) == 0 {
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Status:  "error",
+				Code:    "invalid_param",
+				Message: "fields 不能为空",
+			})
+			return
+		}
+		seen := make(map[string]bool)
+		for _, f := range fields {
+			if anonFields[f] == nil || seen[f] {
+				sendResponse(w, r, http.StatusBadRequest, Response{
+					Status:  "error",
+					Code:    "invalid_param",
+					Message: "fields 含有不支持或重复的字段: " + f,
+				})
+				return
+			}
+			seen[f] = true
+		}
+	}
+
+	if store == nil {
+		sendResponse(w, r, http.StatusNotFound, Response{
+			Status:  "error",
+			Code:    "not_enabled",
+			Message: "设备存储未启用",
+		})
+		return
+	}
+
+	agg := NewAnonAggregator(k, fields)
+	err := store.Iterate(r.Context(), "", func(info DeviceInfo) error {
+		agg.Add(info)
+		return nil
+	})
+	if err != nil {
+		sendResponse(w, r, http.StatusInternalServerError, Response{
+			Status:  "error",
+			Code:    "storage_error",
+			Message: "读取设备信息失败: " + err.Error(),
+		})
+		return
+	}
+
+	sendResponse(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: "获取匿名汇总成功",
+		Data:    agg.Result(),
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAnonAggregator(t *testing.T) {
+	var records []DeviceInfo
+	add := func(n int, info DeviceInfo) {
+		for i := 0; i < n; i++ {
+			records = append(records, info)
+		}
+	}
+	add(6, DeviceInfo{DeviceType: "desktop", OSVersion: "Windows 10", GeoCountry: "CN"})
+	add(5, DeviceInfo{DeviceType: "mobile", OSVersion: "iOS 17", GeoCountry: "CN"})
+	add(2, DeviceInfo{DeviceType: "mobile", OSVersion: "iOS 17", GeoCountry: "IS"})
+	add(1, DeviceInfo{DeviceType: "tablet", OSVersion: "Android 14", GeoCountry: "CN"})
+
+	tests := []struct {
+		name       string
+		k          int
+		fields     []string
+		groups     []int // 各组合的记录数
+		suppressed int
+	}{
+		{"k=5 with country", 5, []string{"deviceType", "osVersion", "geoCountry"}, []int{6, 5}, 3},
+		{"k=5 without country", 5, []string{"deviceType", "osVersion"}, []int{7, 6}, 1},
+		{"k=7", 7, []string{"deviceType"}, []int{7}, 7},
+		{"k=2", 2, []string{"geoCountry"}, []int{12, 2}, 0},
+		{"k larger than total", 20, []string{"deviceType"}, []int{}, 14},
+	}
+	for _, tt := range tests {
+		agg := NewAnonAggregator(tt.k, tt.fields)
+		for _, info := range records {
+			agg.Add(info)
+		}
+		result := agg.Result()
+		if result.Total != len(records) || result.Suppressed != tt.suppressed {
+			t.Errorf("%s: total=%d suppressed=%d, want %d %d", tt.name, result.Total, result.Suppressed, len(records), tt.suppressed)
+		}
+		if len(result.Groups) != len(tt.groups) {
+			t.Fatalf("%s: %d 个组合, want %d", tt.name, len(result.Groups), len(tt.groups))
+		}
+		for i, g := range result.Groups {
+			if g.Count != tt.groups[i] || g.Count < tt.k || len(g.Values) != len(tt.fields) {
+				t.Errorf("%s: groups[%d] = %+v", tt.name, i, g)
+			}
+		}
+	}
+}
+
+func TestAnonExportHandler(t *testing.T) {
+	rs := NewRingStore(20)
+	for i := 0; i < 5; i++ {
+		rs.Insert(context.Background(), DeviceInfo{DeviceType: "desktop", IPAddress: "1.2.3.4", DeviceID: "d"})
+	}
+	rs.Insert(context.Background(), DeviceInfo{DeviceType: "mobile"})
+	useStore(t, rs)
+
+	tests := []struct {
+		query  string
+		status int
+		groups int
+	}{
+		{"", http.StatusOK, 1},
+		{"?k=6", http.StatusOK, 0},
+		{"?k=4", http.StatusBadRequest, 0}, // 小于 ANON_K
+		{"?k=abc", http.StatusBadRequest, 0},
+		{"?fields=deviceId", http.StatusBadRequest, 0},
+		{"?fields=ipAddress", http.StatusBadRequest, 0},
+		{"?fields=deviceType,deviceType", http.StatusBadRequest, 0},
+		{"?fields=,", http.StatusBadRequest, 0},
+		{"?fields=deviceType", http.StatusOK, 1},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		anonExportHandler(w, httptest.NewRequest("GET", "/export/anon"+tt.query, nil))
+		if w.Code != tt.status {
+			t.Errorf("%q: status = %d, want %d", tt.query, w.Code, tt.status)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		var resp struct {
+			Data AnonExport `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Data.Groups) != tt.groups || resp.Data.Total != 6 {
+			t.Errorf("%q: %d 个组合, total=%d", tt.query, len(resp.Data.Groups), resp.Data.Total)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// AnonymityCounter 能在存储层按指纹分组统计匿名集大小的后端, 其余后端逐条读取记录后在内存中统计
+type AnonymityCounter interface {
+	// 统计 timestamp 不早于 since 的记录 (since 为空时统计全部), 返回 匿名集大小 -> 指纹数
+	AnonymitySetSizes(ctx context.Context, since string) (map[int]int, error)
+}
+
+// AnonymityStats 匿名集分布: 共享同一组合指纹 (deviceId) 的设备构成一个匿名集
+// 设备按 cookieId 区分, 没有 cookieId 的记录各自视为一台设备
+type AnonymityStats struct {
+	Fingerprints   int               `json:"fingerprints" xml:"fingerprints"`
+	Devices        int               `json:"devices" xml:"devices"`
+	Unique         int               `json:"unique" xml:"unique"`                 // 匿名集大小为 1 的设备数
+	UniqueFraction float64           `json:"uniqueFraction" xml:"uniqueFraction"` // Unique / Devices
+	Histogram      []AnonymityBucket `json:"histogram" xml:"histogram>bucket"`
+}
+
+// AnonymityBucket 匿名集大小为 Size 的指纹数及其设备数
+type AnonymityBucket struct {
+	Size         int `json:"size" xml:"size"`
+	Fingerprints int `json:"fingerprints" xml:"fingerprints"`
+	Devices      int `json:"devices" xml:"devices"`
+}
+
+// 逐条读取记录统计匿名集大小
+func countAnonymitySets(ctx context.Context, s Store, since string) (map[int]int, error) {
+	sets := make(map[string]map[string]bool) // deviceId -> 设备
+	rows := 0
+	err := s.Iterate(ctx, since, func(info DeviceInfo) error {
+		rows++
+		if info.DeviceID == "" {
+			return nil
+		}
+		// 没有 cookieId 的记录以其序号区分, 与 SQLite 中以行 id 区分一致
+		device := info.CookieID
+		if device == "" {
+			device = "row:" + strconv.Itoa(rows)
+		}
+		if sets[info.DeviceID] == nil {
+			sets[info.DeviceID] = make(map[string]bool)
+		}
+		sets[info.DeviceID][device] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sizes := make(map[int]int)
+	for _, devices := range sets {
+		sizes[len(devices)]++
+	}
+	return sizes, nil
+}
+
+// 由 匿名集大小 -> 指纹数 计算分布, 直方图按大小从小到大排列
+func anonymityStats(sizes map[int]int) AnonymityStats {
+	stats := AnonymityStats{Histogram: []AnonymityBucket{}}
+	for size, n := range sizes {
+		stats.Histogram = append(stats.Histogram, AnonymityBucket{Size: size, Fingerprints: n, Devices: size * n})
+		stats.Fingerprints += n
+		stats.Devices += size * n
+	}
+	sort.Slice(stats.Histogram, func(i, j int) bool {
+		return stats.Histogram[i].Size < stats.Histogram[j].Size
+	})
+	stats.Unique = sizes[1]
+	if stats.Devices > 0 {
+		stats.UniqueFraction = math.Round(float64(stats.Unique)/float64(stats.Devices)*10000) / 10000
+	}
+	return stats
+}
+
+// 匿名集分布: GET /stats/anonymity?since=RFC3339
+func anonymityHandler(w http.ResponseWriter, r *http.Request) {
+	since, ok := sinceQuery(w, r)
+	if !ok {
+		return
+	}
+
+	var sizes map[int]int
+	var err error
+	if counter, ok := store.(AnonymityCounter); ok {
+		sizes, err = counter.AnonymitySetSizes(r.Context(), since)
+	} else {
+		sizes, err = countAnonymitySets(r.Context(), store, since)
+	}
+	if err != nil {
+		sendResponse(w, r, http.StatusInternalServerError, Response{
+			Status:  "error",
+			Code:    "storage_error",
+			Message: "读取设备信息失败: " + err.Error(),
+		})
+		return
+	}
+
+	sendResponse(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: "获取匿名集分布成功",
+		Data:    anonymityStats(sizes),
+	})
+}
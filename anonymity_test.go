@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAnonymityStats(t *testing.T) {
+	records := []DeviceInfo{
+		// fp1: 两台设备, 其中一台访问两次
+		{DeviceID: "fp1", CookieID: "c1", Timestamp: "2024-01-01 10:00:00"},
+		{DeviceID: "fp1", CookieID: "c1", Timestamp: "2024-01-02 10:00:00"},
+		{DeviceID: "fp1", CookieID: "c2", Timestamp: "2024-01-02 11:00:00"},
+		// fp2: 唯一
+		{DeviceID: "fp2", CookieID: "c3", Timestamp: "2024-01-01 10:00:00"},
+		// fp3: 没有 cookieId 的两条记录算作两台设备
+		{DeviceID: "fp3", Timestamp: "2024-01-01 10:00:00"},
+		{DeviceID: "fp3", Timestamp: "2024-01-02 10:00:00"},
+		// fp4: 唯一
+		{DeviceID: "fp4", CookieID: "c4", Timestamp: "2024-01-03 10:00:00"},
+		// 没有 deviceId 的记录不参与统计
+		{CookieID: "c5", Timestamp: "2024-01-03 10:00:00"},
+	}
+	tests := []struct {
+		since string
+		want  AnonymityStats
+	}{
+		{"", AnonymityStats{
+			Fingerprints: 4, Devices: 6, Unique: 2, UniqueFraction: 0.3333,
+			Histogram: []AnonymityBucket{{1, 2, 2}, {2, 2, 4}},
+		}},
+		{"2024-01-02 00:00:00", AnonymityStats{
+			Fingerprints: 3, Devices: 4, Unique: 2, UniqueFraction: 0.5,
+			Histogram: []AnonymityBucket{{1, 2, 2}, {2, 1, 2}},
+		}},
+		{"2025-01-01 00:00:00", AnonymityStats{Histogram: []AnonymityBucket{}}},
+	}
+
+	for name, s := range newTestStores(t) {
+		for _, info := range records {
+			s.Insert(context.Background(), info)
+		}
+		for _, tt := range tests {
+			var sizes map[int]int
+			var err error
+			if counter, ok := s.(AnonymityCounter); ok {
+				sizes, err = counter.AnonymitySetSizes(context.Background(), tt.since)
+			} else {
+				sizes, err = countAnonymitySets(context.Background(), s, tt.since)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := anonymityStats(sizes)
+			if got.Fingerprints != tt.want.Fingerprints || got.Devices != tt.want.Devices ||
+				got.Unique != tt.want.Unique || got.UniqueFraction != tt.want.UniqueFraction ||
+				len(got.Histogram) != len(tt.want.Histogram) {
+				t.Errorf("%s since=%q: %+v, want %+v", name, tt.since, got, tt.want)
+				continue
+			}
+			for i := range got.Histogram {
+				if got.Histogram[i] != tt.want.Histogram[i] {
+					t.Errorf("%s since=%q: histogram[%d] = %+v, want %+v", name, tt.since, i, got.Histogram[i], tt.want.Histogram[i])
+				}
+			}
+		}
+	}
+}
+
+func TestAnonymityHandler(t *testing.T) {
+	rs := NewRingStore(10)
+	rs.Insert(context.Background(), DeviceInfo{DeviceID: "fp1", CookieID: "c1"})
+	rs.Insert(context.Background(), DeviceInfo{DeviceID: "fp2", CookieID: "c2"})
+	useStore(t, rs)
+
+	w := httptest.NewRecorder()
+	anonymityHandler(w, httptest.NewRequest("GET", "/stats/anonymity", nil))
+	var resp struct {
+		Data AnonymityStats `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.UniqueFraction != 1 || resp.Data.Fingerprints != 2 {
+		t.Fatalf("data = %+v", resp.Data)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// 常见云服务与托管商的 ASN
+var datacenterASNs = map[uint]bool{
+	16509:  true, // Amazon AWS
+	14618:  true, // Amazon AWS
+	15169:  true, // Google
+	396982: true, // Google Cloud
+	8075:   true, // Microsoft Azure
+	14061:  true, // DigitalOcean
+	16276:  true, // OVH
+	24940:  true, // Hetzner
+	63949:  true, // Linode (Akamai)
+	20473:  true, // Vultr (Choopa)
+	45102:  true, // Alibaba Cloud
+	37963:  true, // Alibaba Cloud (中国)
+	132203: true, // Tencent Cloud
+	45090:  true, // Tencent Cloud (中国)
+	31898:  true, // Oracle Cloud
+	13335:  true, // Cloudflare
+	51167:  true, // Contabo
+	12876:  true, // Scaleway
+	9009:   true, // M247
+	60068:  true, // Datacamp (CDN77)
+}
+
+// ASN 不在表中时按组织名称关键字判断
+var datacenterOrgKeywords = []string{
+	"amazon", "google cloud", "microsoft", "digitalocean", "ovh", "hetzner", "linode", "akamai",
+	"vultr", "choopa", "alibaba", "tencent", "oracle", "contabo", "scaleway", "hosting", "datacenter",
+	"data center", "cloud",
+}
+
+// ASNResolver 基于 MaxMind ASN 数据库 (GeoLite2-ASN) 查询IP所属自治系统
+type ASNResolver struct {
+	db *geoip2.Reader
+}
+
+// 未配置 GEOIP_ASN_DB 时为 nil
+var asnResolver *ASNResolver
+
+func NewASNResolver(path string) (*ASNResolver, error) {
+	db, err := geoip2.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ASNResolver{db: db}, nil
+}
+
+// 查询IP所属的 ASN (如 AS15169) 和组织名称, 以及是否属于云服务/托管商
+func (a *ASNResolver) Lookup(ip string) (asn, org string, datacenter bool, err error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", "", false, fmt.Errorf("无效的IP地址 %q", ip)
+	}
+	record, err := a.db.ASN(parsed)
+	if err != nil {
+		return "", "", false, err
+	}
+	if record.AutonomousSystemNumber == 0 {
+		return "", "", false, nil
+	}
+	org = record.AutonomousSystemOrganization
+	return "AS" + strconv.FormatUint(uint64(record.AutonomousSystemNumber), 10), org,
+		isDatacenter(record.AutonomousSystemNumber, org), nil
+}
+
+func isDatacenter(asn uint, org string) bool {
+	if datacenterASNs[asn] {
+		return true
+	}
+	org = strings.ToLower(org)
+	for _, kw := range datacenterOrgKeywords {
+		if strings.Contains(org, kw) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *ASNResolver) Close() error {
+	return a.db.Close()
+}
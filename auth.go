@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// 读取接口的 API 密钥 (API_KEYS 环境变量, 逗号分隔), 只保存摘要
+// 为空时需要密钥的接口一律停用, 不会因漏配而对外开放
+var apiKeys [][sha256.Size]byte
+
+// 只读的汇总统计接口是否无需密钥 (PUBLIC_STATS 环境变量)
+var publicStats bool
+
+func parseAPIKeys(list string) [][sha256.Size]byte {
+	var keys [][sha256.Size]byte
+	for _, k := range strings.Split(list, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, sha256.Sum256([]byte(k)))
+		}
+	}
+	return keys
+}
+
+// 要求 Authorization: Bearer <key>; 未配置 API_KEYS 时返回 404
+func requireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(apiKeys) == 0 {
+			sendAuthDisabled(w, r)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !validAPIKey(token) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="device-info-collector"`)
+			sendUnauthorized(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// 供浏览器访问的页面: 除 Bearer 外也接受 Basic 认证, 密码为 API 密钥, 用户名任意
+// 未通过时要求 Basic 认证, 浏览器会弹出登录框; 未配置 API_KEYS 时返回 404
+func requireAdminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(apiKeys) == 0 {
+			sendAuthDisabled(w, r)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			_, token, ok = r.BasicAuth()
+		}
+		if !ok || !validAPIKey(token) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="device-info-collector", charset="UTF-8"`)
+			sendUnauthorized(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// 只读的汇总统计接口: 设置 PUBLIC_STATS 时无需密钥, 否则与 requireAPIKey 相同
+func requireStatsAuth(next http.Handler) http.Handler {
+	protected := requireAPIKey(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicStats {
+			next.ServeHTTP(w, r)
+			return
+		}
+		protected.ServeHTTP(w, r)
+	})
+}
+
+// 比较摘要而不是原文, 比较耗时与密钥长度和内容无关
+func validAPIKey(key string) bool {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(key)))
+	valid := 0
+	for i := range apiKeys {
+		valid |= subtle.ConstantTimeCompare(sum[:], apiKeys[i][:])
+	}
+	return valid == 1
+}
+
+func sendAuthDisabled(w http.ResponseWriter, r *http.Request) {
+	sendResponse(w, r, http.StatusNotFound, Response{
+		Status:  "error",
+		Code:    "not_enabled",
+		Message: "未配置 API_KEYS, 该接口已停用",
+	})
+}
+
+func sendUnauthorized(w http.ResponseWriter, r *http.Request) {
+	sendResponse(w, r, http.StatusUnauthorized, Response{
+		Status:  "error",
+		Code:    "unauthorized",
+		Message: "未授权: 缺少或无效的 API 密钥",
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handlers := map[string]http.Handler{
+		"api":   requireAPIKey(ok),
+		"admin": requireAdminAuth(ok),
+		"stats": requireStatsAuth(ok),
+	}
+
+	tests := []struct {
+		name    string
+		keys    string
+		public  bool
+		auth    func(r *http.Request)
+		handler string
+		status  int
+	}{
+		// 未配置密钥时需要密钥的接口一律停用
+		{"api without keys", "", false, nil, "api", http.StatusNotFound},
+		{"admin without keys", "", false, nil, "admin", http.StatusNotFound},
+		{"stats without keys", "", false, nil, "stats", http.StatusNotFound},
+		{"api ignores public stats", "", true, nil, "api", http.StatusNotFound},
+		{"public stats without keys", "", true, nil, "stats", http.StatusOK},
+		{"public stats with keys", "k1", true, nil, "stats", http.StatusOK},
+
+		{"api missing token", "k1,k2", false, nil, "api", http.StatusUnauthorized},
+		{"api wrong token", "k1,k2", false, bearer("k3"), "api", http.StatusUnauthorized},
+		{"api valid token", "k1,k2", false, bearer("k2"), "api", http.StatusOK},
+		{"api rejects basic", "k1", false, basic("k1"), "api", http.StatusUnauthorized},
+		{"admin basic", "k1", false, basic("k1"), "admin", http.StatusOK},
+		{"admin bearer", "k1", false, bearer("k1"), "admin", http.StatusOK},
+		{"admin wrong basic", "k1", false, basic("k2"), "admin", http.StatusUnauthorized},
+		{"stats valid token", "k1", false, bearer("k1"), "stats", http.StatusOK},
+		{"stats missing token", "k1", false, nil, "stats", http.StatusUnauthorized},
+	}
+
+	savedKeys, savedPublic := apiKeys, publicStats
+	defer func() { apiKeys, publicStats = savedKeys, savedPublic }()
+	for _, tt := range tests {
+		apiKeys, publicStats = parseAPIKeys(tt.keys), tt.public
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.auth != nil {
+			tt.auth(r)
+		}
+		w := httptest.NewRecorder()
+		handlers[tt.handler].ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
+
+func bearer(key string) func(*http.Request) {
+	return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+key) }
+}
+
+func basic(key string) func(*http.Request) {
+	return func(r *http.Request) { r.SetBasicAuth("admin", key) }
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// 单次批量提交的最大设备数
+const maxBatchSize = 100
+
+// 批量提交: 请求体为 DeviceInfo 数组, 整批只计一次限流 (在路由上套用), 共用同一时间戳和IP
+func batchCollectHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	if r.Method != "POST" {
+		sendResponse(w, r, http.StatusMethodNotAllowed, Response{
+			Status:  "error",
+			Code:    "method_not_allowed",
+			Message: "Only POST method is allowed",
+		})
+		return
+	}
+
+	ip := getClientIP(r)
+
+	raw, err := readBody(w, r, r.Body)
+	if err == nil && !verifySignature(w, r, ip, raw) {
+		return
+	}
+	var batch []DeviceInfo
+	if err == nil {
+		err = json.NewDecoder(bytes.NewReader(raw)).Decode(&batch)
+	}
+	if err != nil {
+		slog.WarnContext(r.Context(), "JSON解析错误", "event", "bad_json", "ip", ip, "error", err, "status", http.StatusBadRequest)
+		recordDeadLetter(r, ip, raw, "Invalid JSON format: "+err.Error())
+		sendResponse(w, r, http.StatusBadRequest, Response{
+			Status:  "error",
+			Code:    "bad_json",
+			Message: "Invalid JSON format: " + err.Error(),
+		})
+		return
+	}
+
+	if len(batch) > maxBatchSize {
+		slog.WarnContext(r.Context(), "批量提交过大", "event", "batch_too_large", "ip", ip, "count", len(batch),
+			"status", http.StatusRequestEntityTooLarge)
+		sendResponse(w, r, http.StatusRequestEntityTooLarge, Response{
+			Status:  "error",
+			Code:    "batch_too_large",
+			Message: fmt.Sprintf("单次最多提交 %d 台设备", maxBatchSize),
+		})
+		return
+	}
+
+	now := systemClock.Now()
+	stored, invalid := 0, 0
+	for i := range batch {
+		batch[i].Sanitize()
+		batch[i].ApplyOptOut(r.URL.Query().Get("disable"))
+		// 缺少必填字段的条目写入死信后跳过, 不影响同批其他设备
+		if err := batch[i].Validate(); err != nil {
+			item, _ := json.Marshal(batch[i])
+			recordDeadLetter(r, ip, item, fmt.Sprintf("第 %d 条设备信息不完整: %v", i, err))
+			invalid++
+			continue
+		}
+		enrichDeviceInfo(&batch[i], r, ip, now)
+		batch[i].Respected = optOutSignal(r, batch[i])
+		if batch[i].Respected != "" || (batch[i].IsBot == "是" && dropBots) {
+			continue
+		}
+		// 保存失败时停止处理, 响应 data 为已保存的条数, 客户端可只重试其余条目
+		if err := storeDeviceInfo(r.Context(), batch[i]); err != nil {
+			slog.WarnContext(r.Context(), "批量提交保存中断", "event", "batch_storage_error", "ip", ip, "count", len(batch),
+				"stored", stored, "latency_ms", latencyMs(start))
+			sendStorageError(w, r, err, stored)
+			return
+		}
+		stored++
+	}
+
+	slog.InfoContext(r.Context(), "收到批量设备信息", "event", "batch_collected", "ip", ip, "count", len(batch), "stored", stored,
+		"invalid", invalid, "status", http.StatusOK, "latency_ms", latencyMs(start))
+
+	sendResponse(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: "批量设备信息收集成功",
+		Data:    stored,
+	})
+}
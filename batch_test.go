@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 批量提交中保存的每条记录都计入独立设备估算, 重复设备只计一次
+func TestBatchCountsUniqueVisitors(t *testing.T) {
+	useStore(t, NewRingStore(100))
+	saved := uniqueVisitors
+	uniqueVisitors = NewHyperLogLog()
+	defer func() { uniqueVisitors = saved }()
+
+	device := func(screen string) string {
+		return `{"userAgent":"Mozilla/5.0","screen":"` + screen + `"}`
+	}
+	batches := []struct {
+		items  []string
+		stored string
+		unique uint64
+	}{
+		{[]string{device("800x600"), device("1024x768"), device("800x600")}, "3", 2},
+		// 缺少必填字段的条目不保存, 也不计入
+		{[]string{device("1280x720"), `{"userAgent":"Mozilla/5.0"}`}, "1", 3},
+		{[]string{device("1024x768")}, "1", 3},
+	}
+	for i, b := range batches {
+		body := "[" + strings.Join(b.items, ",") + "]"
+		w := httptest.NewRecorder()
+		batchCollectHandler(w, httptest.NewRequest("POST", "/collect/batch", strings.NewReader(body)))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"data":`+b.stored) {
+			t.Fatalf("batch %d: %d %s", i, w.Code, w.Body)
+		}
+		if got := uniqueVisitors.Count(); got != b.unique {
+			t.Errorf("batch %d: unique = %d, want %d", i, got, b.unique)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func gzipBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// 以试运行方式提交, 返回状态码和处理后的 DeviceInfo
+func dryRunCollect(t *testing.T, body []byte, encoding string) (int, DeviceInfo) {
+	t.Helper()
+	r := httptest.NewRequest("POST", "/collect?dryrun=1", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if encoding != "" {
+		r.Header.Set("Content-Encoding", encoding)
+	}
+	w := httptest.NewRecorder()
+	collectHandler(w, r)
+	var resp struct{ Data DeviceInfo }
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp.Data
+}
+
+func TestCollectGzipBody(t *testing.T) {
+	plain, _ := json.Marshal(DeviceInfo{UserAgent: "Mozilla/5.0", Screen: "1920 x 1080", CanvasFingerprint: "canvas", Language: "zh-CN"})
+	status, want := dryRunCollect(t, plain, "")
+	if status != http.StatusOK {
+		t.Fatalf("plain submission: status = %d", status)
+	}
+
+	tests := []struct {
+		name     string
+		body     []byte
+		encoding string
+		status   int
+	}{
+		{"gzip", gzipBytes(plain), "gzip", http.StatusOK},
+		{"encoding is case-insensitive", gzipBytes(plain), "GZIP", http.StatusOK},
+		{"malformed gzip", []byte("not gzip"), "gzip", http.StatusBadRequest},
+		{"truncated gzip", gzipBytes(plain)[:20], "gzip", http.StatusBadRequest},
+		{"decompressed size over limit", gzipBytes([]byte(`{"userAgent":"` + strings.Repeat("x", maxBodySize) + `"}`)), "gzip",
+			http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		status, got := dryRunCollect(t, tt.body, tt.encoding)
+		if status != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, status, tt.status)
+			continue
+		}
+		if status != http.StatusOK {
+			continue
+		}
+		// 与未压缩的提交解码结果相同
+		if got.DeviceID != want.DeviceID || got.UserAgent != want.UserAgent || got.ScreenWidth != want.ScreenWidth ||
+			got.Language != want.Language {
+			t.Errorf("%s: decoded %+v, want %+v", tt.name, got, want)
+		}
+	}
+}
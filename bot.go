@@ -0,0 +1,30 @@
+package main
+
+import "strings"
+
+// 常见爬虫、命令行工具和无头浏览器的 User-Agent 特征 (小写)
+var botTokens = []string{
+	"googlebot", "bingbot", "baiduspider", "yandexbot", "duckduckbot", "sogou", "bytespider",
+	"slurp", "ahrefsbot", "semrushbot", "mj12bot", "petalbot", "applebot", "facebookexternalhit",
+	"bot/", "crawler", "spider",
+	"curl/", "wget/", "python-requests", "python-urllib", "go-http-client", "java/", "okhttp",
+	"libwww-perl", "httpie", "postmanruntime",
+	"headlesschrome", "phantomjs", "puppeteer", "playwright", "selenium",
+}
+
+// 是否丢弃爬虫提交 (仍返回 200, 不写入存储)
+var dropBots bool
+
+// 根据 User-Agent 判断是否为爬虫或自动化工具, 空 User-Agent 也视为爬虫
+func IsBot(ua string) bool {
+	ua = strings.ToLower(strings.TrimSpace(ua))
+	if ua == "" {
+		return true
+	}
+	for _, token := range botTokens {
+		if strings.Contains(ua, token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestIsBot(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want bool
+	}{
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", true},
+		{"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)", true},
+		{"Mozilla/5.0 (compatible; Baiduspider/2.0; +http://www.baidu.com/search/spider.html)", true},
+		{"curl/8.4.0", true},
+		{"python-requests/2.31.0", true},
+		{"Go-http-client/1.1", true},
+		{"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36", true},
+		{"", true},
+		{"   ", true},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", false},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1", false},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 14.1; rv:120.0) Gecko/20100101 Firefox/120.0", false},
+	}
+	for _, tt := range tests {
+		if got := IsBot(tt.ua); got != tt.want {
+			t.Errorf("IsBot(%q) = %v, want %v", tt.ua, got, tt.want)
+		}
+	}
+}
+
+// DROP_BOTS 时爬虫提交仍返回 200 并标记 isBot, 但不保存
+// 客户端上报的和请求头中的 User-Agent 任一命中即视为爬虫
+func TestDropBots(t *testing.T) {
+	const browser = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/120.0.0.0"
+	tests := []struct {
+		name     string
+		ua       string // 客户端上报
+		headerUA string // 请求头
+		drop     bool
+		bot      bool
+		stored   int
+	}{
+		{"bot kept", "curl/8.4.0", "curl/8.4.0", false, true, 1},
+		{"bot dropped", "curl/8.4.0", "curl/8.4.0", true, true, 0},
+		{"header ua is a bot", browser, "python-requests/2.31.0", true, true, 0},
+		{"browser with drop enabled", browser, browser, true, false, 1},
+	}
+	saved := dropBots
+	defer func() { dropBots = saved }()
+	for _, tt := range tests {
+		s := NewRingStore(10)
+		useStore(t, s)
+		dropBots = tt.drop
+		w := postCollect("/collect", `{"userAgent":"`+tt.ua+`","screen":"1920 x 1080"}`, "User-Agent", tt.headerUA)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", tt.name, w.Code, w.Body)
+		}
+		if got := storedCount(t, s); got != tt.stored {
+			t.Errorf("%s: stored %d records, want %d", tt.name, got, tt.stored)
+		}
+		if strings.Contains(w.Body.String(), `"isBot":"是"`) != tt.bot {
+			t.Errorf("%s: response isBot mismatch: %s", tt.name, w.Body)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// 可信代理网段 (TRUSTED_PROXIES 环境变量), 只有来自这些地址的转发头才被采信
+var trustedProxies []*net.IPNet
+
+// 解析逗号分隔的 IP/CIDR 列表, 单个 IP 视为 /32 或 /128
+func parseCIDRList(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的地址 %q", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的网段 %q", item)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// 判断地址是否属于给定网段
+func ipInNets(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 获取客户端真实IP, 返回规范化后的地址
+// 只有直连地址属于可信代理或经 Unix 套接字连接时才采信 X-Forwarded-For / X-Real-IP, 否则使用连接的对端地址
+func getClientIP(r *http.Request) string {
+	peer := normalizeIP(r.RemoteAddr)
+	ip := net.ParseIP(peer)
+	// 经 Unix 套接字连接时对端没有IP, 只可能是本机的反向代理
+	fromUnixSocket := ip == nil && unixSocket != ""
+	if !fromUnixSocket && (ip == nil || !ipInNets(ip, trustedProxies)) {
+		return peer
+	}
+
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		if ip := clientFromForwardedFor(xff); ip != "" {
+			return ip
+		}
+	}
+	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+		return normalizeIP(ip)
+	}
+	return peer
+}
+
+// 从右向左遍历 X-Forwarded-For, 跳过可信代理, 返回第一个不可信的地址
+// 最左侧的值由客户端自行填写, 不可直接采信; 全部为可信代理时返回最左侧的地址
+func clientFromForwardedFor(xff string) string {
+	entries := strings.Split(xff, ",")
+	client := ""
+	for i := len(entries) - 1; i >= 0; i-- {
+		ip := parseHostIP(entries[i])
+		if ip == nil {
+			// 无法解析的条目之后的内容都不可信, 使用已确认的最近一跳
+			break
+		}
+		client = ip.String()
+		if !ipInNets(ip, trustedProxies) {
+			break
+		}
+	}
+	return client
+}
+
+// 解析可能带端口、方括号、zone 或空白的地址, 例如 " [2001:db8::1]:443 "、"fe80::1%eth0"、"1.2.3.4:80"
+func parseHostIP(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if i := strings.IndexByte(s, '%'); i >= 0 {
+		s = s[:i]
+	}
+	return net.ParseIP(s)
+}
+
+// 规范化地址, 保证同一设备的 IPv6 地址在各种写法下得到相同的字符串
+// IPv4 映射地址 (::ffff:1.2.3.4) 还原为点分十进制; 无法解析时原样返回
+func normalizeIP(s string) string {
+	if ip := parseHostIP(s); ip != nil {
+		return ip.String()
+	}
+	return strings.TrimSpace(s)
+}
+
+// 保存前是否对IP地址脱敏 (ANONYMIZE_IP 环境变量)
+var anonymizeIP bool
+
+// IP 地址脱敏: IPv4 清零最后一个字节, IPv6 清零后 80 位; 无法解析时原样返回
+func AnonymizeIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// 写入存储、日志、死信或告警的IP地址: 启用 ANONYMIZE_IP 时脱敏
+// 限流、封禁和地理位置查询仍使用内存中的完整地址
+func persistedIP(ip string) string {
+	if anonymizeIP {
+		return AnonymizeIP(ip)
+	}
+	return ip
+}
+
+// 日志的 ip 字段与存储一致, 启用 ANONYMIZE_IP 时脱敏
+func anonymizeLogIP(groups []string, a slog.Attr) slog.Attr {
+	if anonymizeIP && len(groups) == 0 && a.Key == "ip" && a.Value.Kind() == slog.KindString {
+		return slog.String(a.Key, AnonymizeIP(a.Value.String()))
+	}
+	return a
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var anonymizeTests = []struct {
+	ip   string
+	want string
+}{
+	{"203.0.113.77", "203.0.113.0"},
+	{"::ffff:203.0.113.77", "203.0.113.0"},
+	{"2001:db8:1234:5678:9abc:def0:1234:5678", "2001:db8:1234::"},
+	{"2001:db8::1", "2001:db8::"},
+	{"unknown", "unknown"},
+}
+
+func useAnonymizeIP(t *testing.T, enabled bool) {
+	t.Helper()
+	saved := anonymizeIP
+	anonymizeIP = enabled
+	t.Cleanup(func() { anonymizeIP = saved })
+}
+
+func TestAnonymizeIP(t *testing.T) {
+	for _, tt := range anonymizeTests {
+		if got := AnonymizeIP(tt.ip); got != tt.want {
+			t.Errorf("AnonymizeIP(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestPersistedIPAnonymized(t *testing.T) {
+	useAnonymizeIP(t, true)
+	for _, tt := range anonymizeTests {
+		r := httptest.NewRequest("GET", "/stats", nil)
+		line := combinedLogLine(r, tt.ip, time.Now(), 200, 0)
+		if !strings.HasPrefix(line, tt.want+" - - [") {
+			t.Errorf("%s: access log line = %q", tt.ip, line)
+		}
+
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{ReplaceAttr: anonymizeLogIP}))
+		logger.Info("test", "ip", tt.ip)
+		var entry map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry["ip"] != tt.want {
+			t.Errorf("%s: log ip = %v, want %s", tt.ip, entry["ip"], tt.want)
+		}
+	}
+}
+
+func TestPersistedIPDisabled(t *testing.T) {
+	useAnonymizeIP(t, false)
+	for _, tt := range anonymizeTests {
+		if got := persistedIP(tt.ip); got != tt.ip {
+			t.Errorf("persistedIP(%q) = %q, want unchanged", tt.ip, got)
+		}
+	}
+}
+
+func TestImportRecordAnonymizesIP(t *testing.T) {
+	useAnonymizeIP(t, true)
+	s := NewRingStore(10)
+	useStore(t, s)
+
+	for i, tt := range anonymizeTests[:4] {
+		line, _ := json.Marshal(DeviceInfo{
+			Timestamp: "2024-01-01 12:00:00",
+			DeviceID:  "device-" + tt.ip,
+			UserAgent: "Mozilla/5.0",
+			Screen:    "1920x1080",
+			IPAddress: tt.ip,
+		})
+		if err := importRecord(httptest.NewRequest("POST", "/import", nil), line); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+	}
+	err := s.Iterate(context.Background(), "", func(info DeviceInfo) error {
+		want := AnonymizeIP(strings.TrimPrefix(info.DeviceID, "device-"))
+		if info.IPAddress != want {
+			t.Errorf("%s: stored ip = %q, want %q", info.DeviceID, info.IPAddress, want)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeadLetterAnonymizesIP(t *testing.T) {
+	useAnonymizeIP(t, true)
+	d := useDeadLetters(t)
+
+	r := httptest.NewRequest("POST", "/collect", nil)
+	recordDeadLetter(r, "2001:db8::1", []byte("{"), "bad_json")
+	recordDeadLetter(r, "198.51.100.23", []byte("{"), "bad_json")
+	letters, err := d.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, l := range letters {
+		got = append(got, l.IPAddress)
+	}
+	for _, want := range []string{"2001:db8::", "198.51.100.0"} {
+		found := false
+		for _, ip := range got {
+			found = found || ip == want
+		}
+		if !found {
+			t.Errorf("dead letter ips = %v, want %s", got, want)
+		}
+	}
+}
+
+func TestGetClientIPTrustedProxies(t *testing.T) {
+	nets, err := parseCIDRList("10.0.0.0/8, 192.0.2.1, 2001:db8:ffff::/48")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := trustedProxies
+	trustedProxies = nets
+	defer func() { trustedProxies = saved }()
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		realIP     string
+		want       string
+	}{
+		{"untrusted peer ignores headers", "203.0.113.5:1234", "198.51.100.1", "198.51.100.2", "203.0.113.5"},
+		{"trusted peer uses forwarded for", "10.1.2.3:1234", "198.51.100.1", "", "198.51.100.1"},
+		{"single trusted address", "192.0.2.1:1234", "198.51.100.1", "", "198.51.100.1"},
+		{"adjacent address is not trusted", "192.0.2.2:1234", "198.51.100.1", "", "192.0.2.2"},
+		{"spoofed leftmost entry skipped", "10.1.2.3:1234", "1.1.1.1, 198.51.100.1, 10.9.9.9", "", "198.51.100.1"},
+		{"all entries trusted", "10.1.2.3:1234", "10.0.0.1, 10.0.0.2", "", "10.0.0.1"},
+		{"garbage entry stops the walk", "10.1.2.3:1234", "198.51.100.1, garbage, 10.0.0.2", "", "10.0.0.2"},
+		{"real ip fallback", "10.1.2.3:1234", "", "198.51.100.7", "198.51.100.7"},
+		{"trusted ipv6 proxy", "[2001:db8:ffff::1]:443", "2001:db8::42", "", "2001:db8::42"},
+		{"no headers", "10.1.2.3:1234", "", "", "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if tt.xff != "" {
+			r.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if got := getClientIP(r); got != tt.want {
+			t.Errorf("%s: getClientIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseCIDRListErrors(t *testing.T) {
+	for _, list := range []string{"10.0.0.0/33", "not-an-ip", "10.0.0.0/8, 1.2.3"} {
+		if _, err := parseCIDRList(list); err == nil {
+			t.Errorf("parseCIDRList(%q) succeeded, want error", list)
+		}
+	}
+}
+
+// 同一地址的不同写法得到相同的字符串, 限流计数不会被拆分
+func TestGetClientIPNormalizes(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{"192.0.2.1:1234", "192.0.2.1"},
+		{"[2001:db8::1]:443", "2001:db8::1"},
+		{"[2001:DB8:0:0:0:0:0:1]:443", "2001:db8::1"},
+		{"[fe80::1%eth0]:80", "fe80::1"},
+		{"fe80::1%eth0", "fe80::1"},
+		{"[::ffff:192.0.2.1]:1234", "192.0.2.1"},
+		{"::ffff:c000:201", "192.0.2.1"},
+		{" 192.0.2.1 ", "192.0.2.1"},
+		{"not-an-address", "not-an-address"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if got := getClientIP(r); got != tt.want {
+			t.Errorf("getClientIP(%q) = %q, want %q", tt.remoteAddr, got, tt.want)
+		}
+	}
+
+	// 可信代理转发的地址同样规范化
+	saved := trustedProxies
+	trustedProxies, _ = parseCIDRList("10.0.0.0/8")
+	defer func() { trustedProxies = saved }()
+	for _, header := range []string{"X-Forwarded-For", "X-Real-IP"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set(header, "[2001:DB8::0001]:8443")
+		if got := getClientIP(r); got != "2001:db8::1" {
+			t.Errorf("%s: getClientIP = %q, want 2001:db8::1", header, got)
+		}
+	}
+}
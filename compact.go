@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Compactor 支持合并重复记录的存储后端
+type Compactor interface {
+	// 将同一 DeviceID 的多条记录合并为一条, 返回删除的条数
+	Compact(ctx context.Context) (int, error)
+}
+
+// 规划合并: 同一 DeviceID 的多条记录合并到其中最新的一条, records 按从旧到新排列
+// 返回需要改写的记录 (下标 -> 合并结果) 和需要删除的记录下标 (升序); 没有 DeviceID 的记录不参与合并
+func planCompaction(records []DeviceInfo) (merged map[int]DeviceInfo, removed []int) {
+	groups := make(map[string][]int)
+	for i, info := range records {
+		if info.DeviceID != "" {
+			groups[info.DeviceID] = append(groups[info.DeviceID], i)
+		}
+	}
+
+	merged = make(map[int]DeviceInfo)
+	for _, idx := range groups {
+		if len(idx) < 2 {
+			continue
+		}
+		group := make([]DeviceInfo, len(idx))
+		for j, k := range idx {
+			group[j] = records[k]
+		}
+		merged[idx[len(idx)-1]] = mergeDeviceRecords(group)
+	}
+	for i, info := range records {
+		if idx := groups[info.DeviceID]; len(idx) > 1 && idx[len(idx)-1] != i {
+			removed = append(removed, i)
+		}
+	}
+	return merged, removed
+}
+
+// 以最新一条记录为准, 汇总首次/最近访问时间和访问次数
+// 已合并过的记录按其中保存的统计计入, 重复合并结果不变
+func mergeDeviceRecords(records []DeviceInfo) DeviceInfo {
+	merged := records[len(records)-1]
+	merged.FirstSeen, merged.LastSeen, merged.VisitCount = "", "", 0
+	for _, info := range records {
+		first, last, visits := info.FirstSeen, info.LastSeen, info.VisitCount
+		if first == "" {
+			first = info.Timestamp
+		}
+		if last == "" {
+			last = info.Timestamp
+		}
+		if visits == 0 {
+			visits = 1
+		}
+		// 时间戳为固定格式, 可按字符串比较先后
+		if merged.FirstSeen == "" || first < merged.FirstSeen {
+			merged.FirstSeen = first
+		}
+		if last > merged.LastSeen {
+			merged.LastSeen = last
+		}
+		merged.VisitCount += visits
+	}
+	return merged
+}
+
+// CompactResult 合并结果
+type CompactResult struct {
+	Merged int `json:"merged" xml:"merged"`
+}
+
+// 合并重复的设备记录: POST /devices/compact
+func compactHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if r.Method != "POST" {
+		sendResponse(w, r, http.StatusMethodNotAllowed, Response{
+			Status:  "error",
+			Code:    "method_not_allowed",
+			Message: "Only POST method is allowed",
+		})
+		return
+	}
+
+	compactor, ok := store.(Compactor)
+	if !ok {
+		sendResponse(w, r, http.StatusNotFound, Response{
+			Status:  "error",
+			Code:    "not_enabled",
+			Message: "当前存储后端不支持合并记录",
+		})
+		return
+	}
+
+	merged, err := compactor.Compact(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "合并重复记录失败", "event", "storage_error", "error", err)
+		sendResponse(w, r, http.StatusInternalServerError, Response{
+			Status:  "error",
+			Code:    "storage_error",
+			Message: "合并重复记录失败: " + err.Error(),
+		})
+		return
+	}
+
+	slog.InfoContext(r.Context(), "已合并重复记录", "event", "compact", "merged", merged, "latency_ms", latencyMs(start))
+	sendResponse(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: "合并完成",
+		Data:    CompactResult{Merged: merged},
+	})
+}
@@ -0,0 +1,525 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration 以 "15s"、"720h" 等文本形式编码的时长
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Config 全部配置项, 由 LoadConfig 在启动时读取并校验一次
+// 密钥类配置不参与序列化, 通过 redacted 只输出是否已设置
+type Config struct {
+	LogLevel       string `json:"logLevel" xml:"logLevel" yaml:"log_level"`
+	AccessLog      string `json:"accessLog" xml:"accessLog" yaml:"access_log"`
+	Port           string `json:"port" xml:"port" yaml:"port"`
+	UnixSocket     string `json:"unixSocket" xml:"unixSocket" yaml:"unix_socket"`
+	UnixSocketMode string `json:"unixSocketMode" xml:"unixSocketMode" yaml:"unix_socket_mode"`
+	TLSCert        string `json:"tlsCert" xml:"tlsCert" yaml:"tls_cert"`
+	TLSKey         string `json:"tlsKey" xml:"tlsKey" yaml:"tls_key"`
+	EnableH2C      bool   `json:"enableH2C" xml:"enableH2C" yaml:"enable_h2c"`
+	// 超时
+	ReadTimeout       Duration `json:"readTimeout" xml:"readTimeout" yaml:"read_timeout"`
+	ReadHeaderTimeout Duration `json:"readHeaderTimeout" xml:"readHeaderTimeout" yaml:"read_header_timeout"`
+	WriteTimeout      Duration `json:"writeTimeout" xml:"writeTimeout" yaml:"write_timeout"`
+	IdleTimeout       Duration `json:"idleTimeout" xml:"idleTimeout" yaml:"idle_timeout"`
+	RequestTimeout    Duration `json:"requestTimeout" xml:"requestTimeout" yaml:"request_timeout"`
+	// 限流与访问控制
+	RateLimit        int      `json:"rateLimit" xml:"rateLimit" yaml:"rate_limit"`
+	RateWindow       Duration `json:"rateWindow" xml:"rateWindow" yaml:"rate_window"`
+	DeviceRateLimit  int      `json:"deviceRateLimit" xml:"deviceRateLimit" yaml:"device_rate_limit"`
+	DeviceRateWindow Duration `json:"deviceRateWindow" xml:"deviceRateWindow" yaml:"device_rate_window"`
+	ReadRateLimit    int      `json:"readRateLimit" xml:"readRateLimit" yaml:"read_rate_limit"`
+	ReadRateWindow   Duration `json:"readRateWindow" xml:"readRateWindow" yaml:"read_rate_window"`
+	RateLimitState   string   `json:"rateLimitState" xml:"rateLimitState" yaml:"rate_limit_state"`
+	RedisURL         string   `json:"-" xml:"-" yaml:"redis_url"`
+	IdempotencyTTL   Duration `json:"idempotencyTTL" xml:"idempotencyTTL" yaml:"idempotency_ttl"`
+	TrustedProxies   []string `json:"trustedProxies" xml:"trustedProxies" yaml:"trusted_proxies"`
+	Blocklist        []string `json:"blocklist" xml:"blocklist" yaml:"blocklist"`
+	Allowlist        []string `json:"allowlist" xml:"allowlist" yaml:"allowlist"`
+	AllowedOrigins   []string `json:"allowedOrigins" xml:"allowedOrigins" yaml:"allowed_origins"`
+	APIKeys          []string `json:"-" xml:"-" yaml:"api_keys"`
+	PublicStats      bool     `json:"publicStats" xml:"publicStats" yaml:"public_stats"`
+	// 指纹轮换检测
+	FingerprintAlertThreshold int      `json:"fingerprintAlertThreshold" xml:"fingerprintAlertThreshold" yaml:"fingerprint_alert_threshold"`
+	FingerprintAlertWindow    Duration `json:"fingerprintAlertWindow" xml:"fingerprintAlertWindow" yaml:"fingerprint_alert_window"`
+	AlertWebhookURL           string   `json:"-" xml:"-" yaml:"alert_webhook_url"`
+	// 请求与响应
+	ProbeProfile        string  `json:"probeProfile" xml:"probeProfile" yaml:"probe_profile"`
+	VerboseResponse     bool    `json:"verboseResponse" xml:"verboseResponse" yaml:"verbose_response"`
+	MethodOverride      bool    `json:"methodOverride" xml:"methodOverride" yaml:"method_override"`
+	DropBots            bool    `json:"dropBots" xml:"dropBots" yaml:"drop_bots"`
+	AnonymizeIP         bool    `json:"anonymizeIP" xml:"anonymizeIP" yaml:"anonymize_ip"`
+	RedactHeaders       bool    `json:"redactHeaders" xml:"redactHeaders" yaml:"redact_headers"`
+	SecurityHeaders     bool    `json:"securityHeaders" xml:"securityHeaders" yaml:"security_headers"`
+	EnablePprof         bool    `json:"enablePprof" xml:"enablePprof" yaml:"enable_pprof"`
+	SigningSecret       string  `json:"-" xml:"-" yaml:"signing_secret"`
+	ResponseSigningKey  string  `json:"-" xml:"-" yaml:"response_signing_key"`
+	MaxFieldLength      int     `json:"maxFieldLength" xml:"maxFieldLength" yaml:"max_field_length"`
+	SimilarityThreshold float64 `json:"similarityThreshold" xml:"similarityThreshold" yaml:"similarity_threshold"`
+	AnonK               int     `json:"anonK" xml:"anonK" yaml:"anon_k"`
+	// 补充处理
+	GPUMap            string `json:"gpuMap" xml:"gpuMap" yaml:"gpu_map"`
+	MemoryLimitMB     uint64 `json:"memoryLimitMB" xml:"memoryLimitMB" yaml:"memory_limit_mb"`
+	GeoIPDB           string `json:"geoipDB" xml:"geoipDB" yaml:"geoip_db"`
+	GeoIPASNDB        string `json:"geoipASNDB" xml:"geoipASNDB" yaml:"geoip_asn_db"`
+	ReverseGeocode    bool   `json:"reverseGeocode" xml:"reverseGeocode" yaml:"reverse_geocode"`
+	GeocoderURL       string `json:"geocoderURL" xml:"geocoderURL" yaml:"geocoder_url"`
+	GeocoderRateLimit int    `json:"geocoderRateLimit" xml:"geocoderRateLimit" yaml:"geocoder_rate_limit"`
+	// 存储与转发
+	Storage             string   `json:"storage" xml:"storage" yaml:"storage"`
+	LogFile             string   `json:"logFile" xml:"logFile" yaml:"log_file"`
+	LogMaxSize          int      `json:"logMaxSize" xml:"logMaxSize" yaml:"log_max_size"`
+	LogRotateDaily      bool     `json:"logRotateDaily" xml:"logRotateDaily" yaml:"log_rotate_daily"`
+	LogMaxBackups       int      `json:"logMaxBackups" xml:"logMaxBackups" yaml:"log_max_backups"`
+	LogCompress         bool     `json:"logCompress" xml:"logCompress" yaml:"log_compress"`
+	SQLitePath          string   `json:"sqlitePath" xml:"sqlitePath" yaml:"sqlite_path"`
+	MemoryCapacity      int      `json:"memoryCapacity" xml:"memoryCapacity" yaml:"memory_capacity"`
+	Retention           Duration `json:"retention" xml:"retention" yaml:"retention"`
+	DeadLetterFile      string   `json:"deadLetterFile" xml:"deadLetterFile" yaml:"deadletter_file"`
+	DeadLetterRetention Duration `json:"deadLetterRetention" xml:"deadLetterRetention" yaml:"deadletter_retention"`
+	DeadLetterMaxSize   int      `json:"deadLetterMaxSize" xml:"deadLetterMaxSize" yaml:"deadletter_max_size"`
+	WebhookURL          string   `json:"-" xml:"-" yaml:"webhook_url"`
+	WebhookDLQ          string   `json:"webhookDLQ" xml:"webhookDLQ" yaml:"webhook_dlq"`
+	// 链路追踪
+	OTLPEndpoint string `json:"otlpEndpoint" xml:"otlpEndpoint" yaml:"otel_exporter_otlp_endpoint"`
+}
+
+// 启动时加载的配置, 供 /debug/config 查看
+var config Config
+
+// 默认配置
+func defaultConfig() Config {
+	return Config{
+		LogLevel:               "INFO",
+		Port:                   "8080",
+		UnixSocketMode:         "660",
+		ReadTimeout:            Duration(15 * time.Second),
+		ReadHeaderTimeout:      Duration(5 * time.Second),
+		WriteTimeout:           Duration(30 * time.Second),
+		IdleTimeout:            Duration(120 * time.Second),
+		RequestTimeout:         Duration(10 * time.Second),
+		RateLimit:              30,
+		RateWindow:             Duration(time.Minute),
+		DeviceRateWindow:       Duration(time.Minute),
+		ReadRateLimit:          300,
+		ReadRateWindow:         Duration(time.Minute),
+		FingerprintAlertWindow: Duration(10 * time.Minute),
+		IdempotencyTTL:         Duration(10 * time.Minute),
+		ProbeProfile:           "standard",
+		RedactHeaders:          true,
+		SecurityHeaders:        true,
+		MaxFieldLength:         2048,
+		SimilarityThreshold:    0.7,
+		AnonK:                  5,
+		ReverseGeocode:         true,
+		GeocoderURL:            defaultGeocoderURL,
+		GeocoderRateLimit:      60,
+		SQLitePath:             "devices.db",
+		MemoryCapacity:         defaultMemoryCapacity,
+		DeadLetterRetention:    Duration(7 * 24 * time.Hour),
+		DeadLetterMaxSize:      100,
+	}
+}
+
+// 读取并校验配置, 优先级从低到高: 默认值、配置文件 (path 为空时跳过)、环境变量
+// 所有无效的配置项一并返回, 而不是只报告第一个
+func LoadConfig(path string) (Config, error) {
+	cfg := defaultConfig()
+	if path != "" {
+		if err := loadConfigFile(path, &cfg); err != nil {
+			return Config{}, err
+		}
+	}
+	env := &envReader{}
+	env.apply(&cfg)
+	// 格式错误的配置项保留默认值, 继续校验其余配置项
+	if err := errors.Join(append(env.errs, cfg.validate())...); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// 读取 YAML 或 JSON 配置文件覆盖到 cfg, 键名为小写的环境变量名 (如 rate_window)
+// 未知的键视为错误, 避免拼写错误的配置项被静默忽略
+func loadConfigFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// JSON 是 YAML 的子集, 两种格式使用同一个解码器
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && err != io.EOF {
+		return fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+	}
+	return nil
+}
+
+// 将已设置的环境变量覆盖到 cfg, 格式错误记录到 errs
+type envReader struct {
+	errs []error
+}
+
+func (e *envReader) apply(cfg *Config) {
+	e.str("LOG_LEVEL", &cfg.LogLevel)
+	e.str("ACCESS_LOG", &cfg.AccessLog)
+	e.str("PORT", &cfg.Port)
+	e.str("UNIX_SOCKET", &cfg.UnixSocket)
+	e.str("UNIX_SOCKET_MODE", &cfg.UnixSocketMode)
+	e.str("TLS_CERT", &cfg.TLSCert)
+	e.str("TLS_KEY", &cfg.TLSKey)
+	e.boolean("ENABLE_H2C", &cfg.EnableH2C)
+
+	e.duration("READ_TIMEOUT", &cfg.ReadTimeout)
+	e.duration("READ_HEADER_TIMEOUT", &cfg.ReadHeaderTimeout)
+	e.duration("WRITE_TIMEOUT", &cfg.WriteTimeout)
+	e.duration("IDLE_TIMEOUT", &cfg.IdleTimeout)
+	e.duration("REQUEST_TIMEOUT", &cfg.RequestTimeout)
+
+	e.integer("RATE_LIMIT", &cfg.RateLimit)
+	e.duration("RATE_WINDOW", &cfg.RateWindow)
+	e.integer("DEVICE_RATE_LIMIT", &cfg.DeviceRateLimit)
+	e.duration("DEVICE_RATE_WINDOW", &cfg.DeviceRateWindow)
+	e.integer("READ_RATE_LIMIT", &cfg.ReadRateLimit)
+	e.duration("READ_RATE_WINDOW", &cfg.ReadRateWindow)
+	e.str("RATE_LIMIT_STATE", &cfg.RateLimitState)
+	e.integer("FINGERPRINT_ALERT_THRESHOLD", &cfg.FingerprintAlertThreshold)
+	e.duration("FINGERPRINT_ALERT_WINDOW", &cfg.FingerprintAlertWindow)
+	e.str("ALERT_WEBHOOK_URL", &cfg.AlertWebhookURL)
+	e.str("REDIS_URL", &cfg.RedisURL)
+	e.duration("IDEMPOTENCY_TTL", &cfg.IdempotencyTTL)
+	e.list("TRUSTED_PROXIES", &cfg.TrustedProxies)
+	e.list("BLOCKLIST", &cfg.Blocklist)
+	e.list("ALLOWLIST", &cfg.Allowlist)
+	e.list("ALLOWED_ORIGINS", &cfg.AllowedOrigins)
+	e.list("API_KEYS", &cfg.APIKeys)
+	e.boolean("PUBLIC_STATS", &cfg.PublicStats)
+
+	e.str("PROBE_PROFILE", &cfg.ProbeProfile)
+	e.boolean("VERBOSE_RESPONSE", &cfg.VerboseResponse)
+	e.boolean("METHOD_OVERRIDE", &cfg.MethodOverride)
+	e.boolean("DROP_BOTS", &cfg.DropBots)
+	e.boolean("ANONYMIZE_IP", &cfg.AnonymizeIP)
+	e.boolean("REDACT_HEADERS", &cfg.RedactHeaders)
+	e.boolean("SECURITY_HEADERS", &cfg.SecurityHeaders)
+	e.boolean("ENABLE_PPROF", &cfg.EnablePprof)
+	e.str("SIGNING_SECRET", &cfg.SigningSecret)
+	e.str("RESPONSE_SIGNING_KEY", &cfg.ResponseSigningKey)
+	e.integer("MAX_FIELD_LENGTH", &cfg.MaxFieldLength)
+	e.float("SIMILARITY_THRESHOLD", &cfg.SimilarityThreshold)
+	e.integer("ANON_K", &cfg.AnonK)
+
+	e.str("GPU_MAP", &cfg.GPUMap)
+	e.uint("MEMORY_LIMIT_MB", &cfg.MemoryLimitMB)
+	e.str("GEOIP_DB", &cfg.GeoIPDB)
+	e.str("GEOIP_ASN_DB", &cfg.GeoIPASNDB)
+	e.boolean("REVERSE_GEOCODE", &cfg.ReverseGeocode)
+	e.str("GEOCODER_URL", &cfg.GeocoderURL)
+	e.integer("GEOCODER_RATE_LIMIT", &cfg.GeocoderRateLimit)
+
+	e.str("STORAGE", &cfg.Storage)
+	e.str("LOG_FILE", &cfg.LogFile)
+	e.integer("LOG_MAX_SIZE", &cfg.LogMaxSize)
+	e.boolean("LOG_ROTATE_DAILY", &cfg.LogRotateDaily)
+	e.integer("LOG_MAX_BACKUPS", &cfg.LogMaxBackups)
+	e.boolean("LOG_COMPRESS", &cfg.LogCompress)
+	e.str("SQLITE_PATH", &cfg.SQLitePath)
+	e.integer("MEMORY_CAPACITY", &cfg.MemoryCapacity)
+	e.duration("RETENTION", &cfg.Retention)
+	e.str("DEADLETTER_FILE", &cfg.DeadLetterFile)
+	e.duration("DEADLETTER_RETENTION", &cfg.DeadLetterRetention)
+	e.integer("DEADLETTER_MAX_SIZE", &cfg.DeadLetterMaxSize)
+	e.str("WEBHOOK_URL", &cfg.WebhookURL)
+	e.str("WEBHOOK_DLQ", &cfg.WebhookDLQ)
+	e.str("OTEL_EXPORTER_OTLP_ENDPOINT", &cfg.OTLPEndpoint)
+}
+
+func (e *envReader) str(name string, dst *string) {
+	if v, ok := os.LookupEnv(name); ok && v != "" {
+		*dst = v
+	}
+}
+
+func (e *envReader) list(name string, dst *[]string) {
+	if v, ok := os.LookupEnv(name); ok && v != "" {
+		*dst = splitList(v)
+	}
+}
+
+func (e *envReader) boolean(name string, dst *bool) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("无效的 %s %q: 应为 true 或 false", name, v))
+		return
+	}
+	*dst = b
+}
+
+func (e *envReader) integer(name string, dst *int) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("无效的 %s %q: 应为整数", name, v))
+		return
+	}
+	*dst = n
+}
+
+func (e *envReader) uint(name string, dst *uint64) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("无效的 %s %q: 应为非负整数", name, v))
+		return
+	}
+	*dst = n
+}
+
+func (e *envReader) float(name string, dst *float64) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("无效的 %s %q: 应为数字", name, v))
+		return
+	}
+	*dst = f
+}
+
+func (e *envReader) duration(name string, dst *Duration) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("无效的 %s %q: 应为时长, 如 30s、1m、720h", name, v))
+		return
+	}
+	*dst = Duration(d)
+}
+
+// 校验取值范围和配置项之间的依赖, 并补全由其他配置项推导的默认值
+func (c *Config) validate() error {
+	var errs []error
+	invalid := func(name string, value any, reason string) {
+		errs = append(errs, fmt.Errorf("无效的 %s %v: %s", name, value, reason))
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		invalid("LOG_LEVEL", c.LogLevel, "可选 DEBUG/INFO/WARN/ERROR")
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		errs = append(errs, errors.New("TLS_CERT 和 TLS_KEY 必须同时设置"))
+	}
+	if m, err := strconv.ParseUint(c.UnixSocketMode, 8, 32); err != nil || m > 0o777 {
+		invalid("UNIX_SOCKET_MODE", c.UnixSocketMode, "应为八进制权限, 如 660")
+	}
+
+	positive := []struct {
+		name string
+		d    Duration
+	}{
+		{"READ_TIMEOUT", c.ReadTimeout},
+		{"READ_HEADER_TIMEOUT", c.ReadHeaderTimeout},
+		{"WRITE_TIMEOUT", c.WriteTimeout},
+		{"IDLE_TIMEOUT", c.IdleTimeout},
+		{"REQUEST_TIMEOUT", c.RequestTimeout},
+		{"RATE_WINDOW", c.RateWindow},
+		{"DEVICE_RATE_WINDOW", c.DeviceRateWindow},
+		{"READ_RATE_WINDOW", c.ReadRateWindow},
+		{"FINGERPRINT_ALERT_WINDOW", c.FingerprintAlertWindow},
+		{"IDEMPOTENCY_TTL", c.IdempotencyTTL},
+	}
+	for _, p := range positive {
+		if p.d <= 0 {
+			invalid(p.name, p.d, "必须大于 0")
+		}
+	}
+	if c.Retention < 0 {
+		invalid("RETENTION", c.Retention, "不能为负")
+	}
+	if c.DeadLetterRetention < 0 {
+		invalid("DEADLETTER_RETENTION", c.DeadLetterRetention, "不能为负")
+	}
+	if c.DeadLetterMaxSize <= 0 {
+		invalid("DEADLETTER_MAX_SIZE", c.DeadLetterMaxSize, "必须大于 0")
+	}
+
+	nets := []struct {
+		name string
+		list []string
+	}{
+		{"TRUSTED_PROXIES", c.TrustedProxies},
+		{"BLOCKLIST", c.Blocklist},
+		{"ALLOWLIST", c.Allowlist},
+	}
+	for _, n := range nets {
+		if _, err := parseCIDRList(strings.Join(n.list, ",")); err != nil {
+			invalid(n.name, strings.Join(n.list, ","), err.Error())
+		}
+	}
+
+	if !probeProfiles[c.ProbeProfile] {
+		invalid("PROBE_PROFILE", c.ProbeProfile, "可选 minimal/standard/full")
+	}
+	if c.MaxFieldLength <= 0 {
+		invalid("MAX_FIELD_LENGTH", c.MaxFieldLength, "必须大于 0")
+	}
+	if c.SimilarityThreshold <= 0 || c.SimilarityThreshold > 1 {
+		invalid("SIMILARITY_THRESHOLD", c.SimilarityThreshold, "取值 0~1")
+	}
+	if c.AnonK < 2 {
+		invalid("ANON_K", c.AnonK, "不能小于 2")
+	}
+	if c.GeocoderRateLimit <= 0 {
+		invalid("GEOCODER_RATE_LIMIT", c.GeocoderRateLimit, "必须大于 0")
+	}
+
+	// 未设置 STORAGE 时, 配置了 LOG_FILE 则使用 jsonl, 否则使用内存
+	if c.Storage == "" {
+		c.Storage = "memory"
+		if c.LogFile != "" {
+			c.Storage = "jsonl"
+		}
+	}
+	switch c.Storage {
+	case "memory", "sqlite":
+	case "jsonl":
+		if c.LogFile == "" {
+			errs = append(errs, errors.New("STORAGE=jsonl 需要设置 LOG_FILE"))
+		}
+	default:
+		invalid("STORAGE", c.Storage, "可选 memory/jsonl/sqlite")
+	}
+	if c.MemoryCapacity <= 0 {
+		invalid("MEMORY_CAPACITY", c.MemoryCapacity, "必须大于 0")
+	}
+	if c.LogMaxSize < 0 {
+		invalid("LOG_MAX_SIZE", c.LogMaxSize, "不能为负")
+	}
+	if c.LogMaxBackups < 0 {
+		invalid("LOG_MAX_BACKUPS", c.LogMaxBackups, "不能为负")
+	}
+
+	if c.WebhookURL != "" {
+		u, err := url.Parse(c.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			// 地址中可能带有凭据, 不写入错误信息
+			errs = append(errs, errors.New("无效的 WEBHOOK_URL: 应为 http(s) 地址"))
+		}
+	}
+	if c.AlertWebhookURL != "" {
+		u, err := url.Parse(c.AlertWebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, errors.New("无效的 ALERT_WEBHOOK_URL: 应为 http(s) 地址"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LOG_FILE 和 ACCESS_LOG 共用的轮转策略
+func (c Config) rotateConfig() RotateConfig {
+	return RotateConfig{
+		MaxSizeMB:  c.LogMaxSize,
+		Daily:      c.LogRotateDaily,
+		MaxBackups: c.LogMaxBackups,
+		Compress:   c.LogCompress,
+	}
+}
+
+// 调试输出的配置: 密钥以及可能内嵌凭据的地址只显示是否已设置
+type redactedConfig struct {
+	Config
+	RedisURL           bool `json:"redisURL" xml:"redisURL"`
+	APIKeys            bool `json:"apiKeys" xml:"apiKeys"`
+	SigningSecret      bool `json:"signingSecret" xml:"signingSecret"`
+	ResponseSigningKey bool `json:"responseSigningKey" xml:"responseSigningKey"`
+	WebhookURL         bool `json:"webhookURL" xml:"webhookURL"`
+	AlertWebhookURL    bool `json:"alertWebhookURL" xml:"alertWebhookURL"`
+}
+
+func (c Config) redacted() redactedConfig {
+	return redactedConfig{
+		Config:             c,
+		RedisURL:           c.RedisURL != "",
+		APIKeys:            len(c.APIKeys) > 0,
+		SigningSecret:      c.SigningSecret != "",
+		ResponseSigningKey: c.ResponseSigningKey != "",
+		WebhookURL:         c.WebhookURL != "",
+		AlertWebhookURL:    c.AlertWebhookURL != "",
+	}
+}
+
+// 拆分逗号分隔的列表, 去掉空项
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// 查看生效的配置: GET /debug/config
+func debugConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		sendResponse(w, r, http.StatusMethodNotAllowed, Response{
+			Status:  "error",
+			Code:    "method_not_allowed",
+			Message: "Only GET method is allowed",
+		})
+		return
+	}
+
+	sendResponse(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: "获取配置成功",
+		Data:    config.redacted(),
+	})
+}
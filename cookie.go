@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	deviceCookieName   = "device_id"
+	deviceCookieMaxAge = 365 * 24 * time.Hour
+)
+
+// 读取第一方设备 Cookie, 不存在时生成新的 UUID 并通过 Set-Cookie 下发
+func deviceCookie(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(deviceCookieName); err == nil && c.Value != "" {
+		return c.Value
+	}
+
+	id := newUUID()
+	http.SetCookie(w, &http.Cookie{
+		Name:     deviceCookieName,
+		Value:    id,
+		Path:     "/",
+		Expires:  systemClock.Now().Add(deviceCookieMaxAge),
+		MaxAge:   int(deviceCookieMaxAge / time.Second),
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id
+}
+
+// 生成随机 UUID (版本 4)
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CORS 允许的请求头
+const corsAllowHeaders = "Authorization, Content-Type, Content-Encoding, X-HTTP-Method-Override, X-Payload, X-Signature, Idempotency-Key, X-Request-ID, X-Dry-Run"
+
+// 允许跨域访问的来源 (ALLOWED_ORIGINS), 为空时允许任意来源但不携带凭据
+var allowedOrigins map[string]bool
+
+// 解析逗号分隔的来源列表, 忽略空项和末尾的斜杠
+func parseOriginList(list string) map[string]bool {
+	origins := make(map[string]bool)
+	for _, o := range strings.Split(list, ",") {
+		o = strings.TrimRight(strings.TrimSpace(o), "/")
+		if o != "" {
+			origins[o] = true
+		}
+	}
+	return origins
+}
+
+// 设置 CORS 响应头并处理预检请求
+// 配置了允许列表时只回显列表中的 Origin 并允许携带凭据, 绝不返回 *
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		if len(allowedOrigins) == 0 {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Add("Vary", "Origin")
+			if origin := r.Header.Get("Origin"); allowedOrigins[origin] {
+				h.Set("Access-Control-Allow-Origin", origin)
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+		h.Set("Access-Control-Allow-Methods", "POST, GET, DELETE, OPTIONS")
+		h.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
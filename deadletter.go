@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// DeadLetter 被拒绝的提交
+type DeadLetter struct {
+	Timestamp   string `json:"timestamp" xml:"timestamp"`
+	IPAddress   string `json:"ipAddress" xml:"ipAddress"`
+	UserAgent   string `json:"userAgent" xml:"userAgent"`
+	ContentType string `json:"contentType" xml:"contentType"`
+	Reason      string `json:"reason" xml:"reason"`
+	Payload     string `json:"payload" xml:"payload"`
+}
+
+// DeadLetterStore 死信存储, 以 JSON Lines 格式写入独立文件
+// 超过保留时长的死信由后台定期清理; 文件超过大小上限时先清理过期的, 仍超出则删除最旧的
+type DeadLetterStore struct {
+	path      string
+	retention time.Duration
+	maxSize   int64 // 文件大小上限 (字节)
+	size      int64 // 当前文件大小
+	clock     Clock
+	mutex     sync.Mutex
+}
+
+// 未配置 DEADLETTER_FILE 时为 nil
+var deadLetters *DeadLetterStore
+
+// 死信过期清理间隔
+var deadLetterSweepInterval = time.Hour
+
+// 超出大小上限时删除最旧的死信, 直到文件不超过上限的该比例, 避免此后每次写入都要改写
+const deadLetterTrimRatio = 0.8
+
+// maxSizeMB 为文件大小上限 (MB)
+func NewDeadLetterStore(path string, retention time.Duration, maxSizeMB int) *DeadLetterStore {
+	d := &DeadLetterStore{path: path, retention: retention, maxSize: int64(maxSizeMB) << 20, clock: systemClock}
+	if st, err := os.Stat(path); err == nil {
+		d.size = st.Size()
+	}
+	return d
+}
+
+// 追加一条死信, 写入后超过大小上限时先清理
+func (d *DeadLetterStore) Add(entry DeadLetter) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.size+int64(len(line)) > d.maxSize {
+		if err := d.trim(int64(len(line))); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(d.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	n, err := f.Write(line)
+	d.size += int64(n)
+	return err
+}
+
+// 为即将写入的 incoming 字节腾出空间: 删除过期的死信, 仍超出上限时按从旧到新删除, 调用方需持有锁
+func (d *DeadLetterStore) trim(incoming int64) error {
+	entries, _, err := d.load()
+	if err != nil {
+		return err
+	}
+	sizes := make([]int64, len(entries))
+	var total int64
+	for i, entry := range entries {
+		line, _ := json.Marshal(entry)
+		sizes[i] = int64(len(line)) + 1
+		total += sizes[i]
+	}
+	dropped := 0
+	target := int64(float64(d.maxSize) * deadLetterTrimRatio)
+	for dropped < len(entries) && total+incoming > target {
+		total -= sizes[dropped]
+		dropped++
+	}
+	if dropped > 0 {
+		slog.Warn("死信文件超过大小上限, 删除最旧的死信", "event", "deadletter_trim", "dropped", dropped)
+	}
+	return d.rewrite(entries[dropped:])
+}
+
+// 读取未过期的死信, 返回过期的条数, 调用方需持有锁
+func (d *DeadLetterStore) load() ([]DeadLetter, int, error) {
+	f, err := os.Open(d.path)
+	if os.IsNotExist(err) {
+		return []DeadLetter{}, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	entries := make([]DeadLetter, 0)
+	expired := 0
+	now := d.clock.Now()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 2*maxBodySize)
+	for scanner.Scan() {
+		var entry DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if d.retention > 0 {
+			t, err := time.ParseInLocation("2006-01-02 15:04:05", entry.Timestamp, time.Local)
+			if err == nil && now.Sub(t) > d.retention {
+				expired++
+				continue
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	return entries, expired, nil
+}
+
+// 读取全部死信, 同时清理超过保留时长的记录
+func (d *DeadLetterStore) List() ([]DeadLetter, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	entries, expired, err := d.load()
+	if err != nil {
+		return nil, err
+	}
+	if expired > 0 {
+		if err := d.rewrite(entries); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// 清理超过保留时长的死信, 返回清理的条数
+func (d *DeadLetterStore) Sweep() (int, error) {
+	if d.retention <= 0 {
+		return 0, nil
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	entries, expired, err := d.load()
+	if err != nil || expired == 0 {
+		return 0, err
+	}
+	return expired, d.rewrite(entries)
+}
+
+// 删除符合条件的死信, 返回删除的条数; 同时清理过期的死信
+func (d *DeadLetterStore) Remove(match func(DeadLetter) bool) (int, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	entries, expired, err := d.load()
+	if err != nil {
+		return 0, err
+	}
+	kept := entries[:0]
+	for _, entry := range entries {
+		if !match(entry) {
+			kept = append(kept, entry)
+		}
+	}
+	removed := len(entries) - len(kept)
+	if removed == 0 && expired == 0 {
+		return 0, nil
+	}
+	return removed, d.rewrite(kept)
+}
+
+// 启动后台清理, 未设置保留时长时不启动
+func (d *DeadLetterStore) StartSweeper(interval time.Duration) {
+	if d.retention <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := d.Sweep(); err != nil {
+				slog.Error("清理过期死信失败", "event", "deadletter_error", "error", err)
+			}
+		}
+	}()
+}
+
+// 用保留的记录重写文件, 调用方需持有锁
+func (d *DeadLetterStore) rewrite(entries []DeadLetter) error {
+	tmp := d.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, d.path); err != nil {
+		return err
+	}
+	d.size = st.Size()
+	return nil
+}
+
+// 查看死信
+func deadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		sendResponse(w, r, http.StatusMethodNotAllowed, Response{
+			Status:  "error",
+			Code:    "method_not_allowed",
+			Message: "Only GET method is allowed",
+		})
+		return
+	}
+
+	if deadLetters == nil {
+		sendResponse(w, r, http.StatusNotFound, Response{
+			Status:  "error",
+			Code:    "not_enabled",
+			Message: "死信存储未启用",
+		})
+		return
+	}
+
+	entries, err := deadLetters.List()
+	if err != nil {
+		sendResponse(w, r, http.StatusInternalServerError, Response{
+			Status:  "error",
+			Code:    "storage_error",
+			Message: "读取死信失败: " + err.Error(),
+		})
+		return
+	}
+
+	sendResponse(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: "获取死信成功",
+		Data:    entries,
+	})
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestDeadLetterStore(t *testing.T, retention time.Duration, maxSizeMB int) (*DeadLetterStore, *fakeClock) {
+	t.Helper()
+	clock := newFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local))
+	d := NewDeadLetterStore(filepath.Join(t.TempDir(), "deadletter.jsonl"), retention, maxSizeMB)
+	d.clock = clock
+	return d, clock
+}
+
+// 替换全局死信存储, 测试结束后恢复
+func useDeadLetters(t *testing.T) *DeadLetterStore {
+	t.Helper()
+	d, _ := newTestDeadLetterStore(t, time.Hour, 1)
+	saved := deadLetters
+	deadLetters = d
+	t.Cleanup(func() { deadLetters = saved })
+	return d
+}
+
+func addDeadLetter(t *testing.T, d *DeadLetterStore, clock Clock, reason string, payloadSize int) {
+	t.Helper()
+	err := d.Add(DeadLetter{
+		Timestamp: clock.Now().Format("2006-01-02 15:04:05"),
+		Reason:    reason,
+		Payload:   strings.Repeat("x", payloadSize),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeadLetterSweep(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention time.Duration
+		advance   time.Duration
+		swept     int
+		remaining int
+	}{
+		{"not expired", 24 * time.Hour, 12 * time.Hour, 0, 2},
+		{"first expired", 24 * time.Hour, 25 * time.Hour, 1, 1},
+		{"kept forever", 0, 1000 * time.Hour, 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, clock := newTestDeadLetterStore(t, tt.retention, 1)
+			addDeadLetter(t, d, clock, "old", 10)
+			clock.Advance(2 * time.Hour)
+			addDeadLetter(t, d, clock, "new", 10)
+
+			clock.Advance(tt.advance - 2*time.Hour)
+			swept, err := d.Sweep()
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries, _ := d.List()
+			if swept != tt.swept || len(entries) != tt.remaining {
+				t.Fatalf("清理 %d 条, 剩余 %d 条, want %d %d", swept, len(entries), tt.swept, tt.remaining)
+			}
+		})
+	}
+}
+
+func TestDeadLetterSizeCap(t *testing.T) {
+	d, clock := newTestDeadLetterStore(t, 0, 1)
+	const payload = 100 * 1024
+	for i := 0; i < 30; i++ {
+		addDeadLetter(t, d, clock, string(rune('a'+i%26)), payload)
+		clock.Advance(time.Second)
+	}
+
+	st, err := os.Stat(d.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Size() > 1<<20 || st.Size() != d.size {
+		t.Fatalf("文件大小 %d, 记录的大小 %d", st.Size(), d.size)
+	}
+	entries, _ := d.List()
+	if len(entries) == 0 || len(entries) >= 10 {
+		t.Fatalf("剩余 %d 条", len(entries))
+	}
+	// 保留的是最新的
+	if last := entries[len(entries)-1].Reason; last != string(rune('a'+29%26)) {
+		t.Fatalf("最后一条为 %q", last)
+	}
+}
+
+func TestDeadLetterSizeCapDropsExpiredFirst(t *testing.T) {
+	d, clock := newTestDeadLetterStore(t, time.Hour, 1)
+	addDeadLetter(t, d, clock, "expired", 600*1024)
+	clock.Advance(2 * time.Hour)
+	addDeadLetter(t, d, clock, "fresh", 100*1024)
+	addDeadLetter(t, d, clock, "large", 500*1024)
+
+	entries, _ := d.List()
+	if len(entries) != 2 || entries[0].Reason != "fresh" || entries[1].Reason != "large" {
+		t.Fatalf("剩余 %+v", len(entries))
+	}
+}
+
+// 被拒绝的提交写入死信: JSON 错误、签名无效、缺少必填字段 (批量提交按条目记录)
+func TestRejectedSubmissionsDeadLettered(t *testing.T) {
+	const secret = "test-secret"
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	valid := `{"userAgent":"Mozilla/5.0","screen":"1920x1080"}`
+	invalid := `{"userAgent":"Mozilla/5.0"}`
+
+	tests := []struct {
+		name      string
+		handler   http.HandlerFunc
+		target    string
+		body      string
+		signature string // 为空时使用正确的签名
+		status    int
+		reasons   []string
+		payload   string
+	}{
+		{"bad json", collectHandler, "/collect", `{`, "", http.StatusBadRequest, []string{"Invalid JSON format"}, `{`},
+		{"bad signature", collectHandler, "/collect", valid, "00", http.StatusUnauthorized, []string{"请求签名无效"}, valid},
+		{"invalid device", collectHandler, "/collect", invalid, "", http.StatusBadRequest, []string{"设备信息不完整"}, invalid},
+		{"dry run", collectHandler, "/collect?dryrun=1", invalid, "", http.StatusBadRequest, nil, ""},
+		{"dry run bad signature", collectHandler, "/collect?dryrun=1", valid, "00", http.StatusUnauthorized, nil, ""},
+		{"batch bad signature", batchCollectHandler, "/collect/batch", "[" + valid + "]", "00", http.StatusUnauthorized,
+			[]string{"请求签名无效"}, "[" + valid + "]"},
+		{"batch invalid items", batchCollectHandler, "/collect/batch", "[" + invalid + "," + invalid + "]", "", http.StatusOK,
+			[]string{"第 0 条设备信息不完整", "第 1 条设备信息不完整"}, ""},
+	}
+
+	saved := signingSecret
+	signingSecret = []byte(secret)
+	defer func() { signingSecret = saved }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := useDeadLetters(t)
+			r := httptest.NewRequest("POST", tt.target, strings.NewReader(tt.body))
+			signature := tt.signature
+			if signature == "" {
+				signature = sign(tt.body)
+			}
+			r.Header.Set("X-Signature", signature)
+			w := httptest.NewRecorder()
+			tt.handler(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+
+			letters, err := d.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(letters) != len(tt.reasons) {
+				t.Fatalf("dead letters = %+v, want %d", letters, len(tt.reasons))
+			}
+			for i, want := range tt.reasons {
+				if !strings.HasPrefix(letters[i].Reason, want) {
+					t.Errorf("reason[%d] = %q, want prefix %q", i, letters[i].Reason, want)
+				}
+				if tt.payload != "" && letters[i].Payload != tt.payload {
+					t.Errorf("payload[%d] = %q, want %q", i, letters[i].Payload, tt.payload)
+				}
+			}
+		})
+	}
+}
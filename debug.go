@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// 在 mux 上注册 /debug/pprof/ 性能分析接口, 仅在 ENABLE_PPROF=true 时调用
+// 不经过限流和 API 密钥鉴权, 生产环境不要开启
+//
+// 排查延迟问题时常用的几项:
+//   - /debug/pprof/profile?seconds=30  CPU 采样
+//   - /debug/pprof/heap                堆内存分配 (配合内存看门狗排查降级)
+//   - /debug/pprof/goroutine?debug=2   全部 goroutine 堆栈 (SSE 连接泄漏、Webhook 积压)
+//   - /debug/pprof/mutex, /block       锁竞争与阻塞 (需要设置采样率才有数据)
+//   - /debug/pprof/trace?seconds=5     调度与 GC 追踪
+func registerPprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// 同时到达的相同提交 (如网络重试) 合并为一次补充处理和保存, 结果由各请求共享
+var submissionGroup singleflight.Group
+
+// 合并键: 设备ID + 客户端IP + 原始请求体、查询参数及影响处理结果的请求头的摘要
+// 设备ID只覆盖部分指纹字段, 加上请求体摘要保证内容不同的提交不会被合并
+func submissionKey(r *http.Request, ip, deviceID string, raw []byte) string {
+	h := sha256.New()
+	h.Write(raw)
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.RawQuery))
+	for _, name := range []string{"User-Agent", "DNT", "Sec-GPC"} {
+		h.Write([]byte{0})
+		h.Write([]byte(r.Header.Get(name)))
+	}
+	return deviceID + "|" + ip + "|" + hex.EncodeToString(h.Sum(nil))
+}
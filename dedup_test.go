@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 保存时阻塞直到 release 关闭, 用来让两个提交同时处于处理中
+type blockingStore struct {
+	Store
+	inserts atomic.Int32
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStore) Insert(ctx context.Context, info DeviceInfo) error {
+	s.inserts.Add(1)
+	s.entered <- struct{}{}
+	<-s.release
+	return s.Store.Insert(ctx, info)
+}
+
+func TestConcurrentSubmissionsMerged(t *testing.T) {
+	const body = `{"userAgent":"Mozilla/5.0","screen":"1920x1080"}`
+	tests := []struct {
+		name    string
+		second  string // 第二个请求的请求体
+		ip      string // 第二个请求的客户端地址
+		inserts int32
+	}{
+		{"identical", body, "192.0.2.1:1234", 1},
+		{"different body", `{"userAgent":"Mozilla/5.0","screen":"1280x720"}`, "192.0.2.1:1234", 2},
+		{"different client", body, "198.51.100.7:1234", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &blockingStore{Store: NewRingStore(10), entered: make(chan struct{}, 2), release: make(chan struct{})}
+			useStore(t, s)
+
+			var wg sync.WaitGroup
+			codes := make([]int, 2)
+			submit := func(i int, body, remoteAddr string) {
+				defer wg.Done()
+				r := httptest.NewRequest("POST", "/collect", strings.NewReader(body))
+				r.RemoteAddr = remoteAddr
+				r.Header.Set("Content-Type", "application/json")
+				r.Header.Set("User-Agent", "Mozilla/5.0")
+				w := httptest.NewRecorder()
+				collectHandler(w, r)
+				codes[i] = w.Code
+			}
+			wg.Add(2)
+			go submit(0, body, "192.0.2.1:1234")
+			<-s.entered
+			go submit(1, tt.second, tt.ip)
+			// 相同的提交在首个请求保存期间加入合并, 不同的提交各自进入保存
+			select {
+			case <-s.entered:
+			case <-time.After(200 * time.Millisecond):
+			}
+			close(s.release)
+			wg.Wait()
+
+			for i, code := range codes {
+				if code != http.StatusOK {
+					t.Errorf("request %d: status = %d", i+1, code)
+				}
+			}
+			if got := s.inserts.Load(); got != tt.inserts {
+				t.Errorf("inserts = %d, want %d", got, tt.inserts)
+			}
+			if got := storedCount(t, s); got != int(tt.inserts) {
+				t.Errorf("stored = %d, want %d", got, tt.inserts)
+			}
+		})
+	}
+}
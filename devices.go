@@ -0,0 +1,158 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 分页参数
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// DeviceFilter /devices 的字段过滤条件, 为空的条件不限制, 多个条件需同时满足
+// 操作系统和浏览器按前缀匹配 (os=windows 可匹配 "Windows 10/11"), 其余精确匹配, 均不区分大小写
+type DeviceFilter struct {
+	OS         string // osVersion 前缀
+	Browser    string // browserVersion 前缀
+	Country    string // geoCountry
+	DeviceType string // deviceType
+	IP         string // ipAddress, 开启 ANONYMIZE_IP 时需按脱敏后的地址查询
+}
+
+// /devices 接受的查询参数, 其余参数视为未知的过滤条件
+var devicesQueryParams = map[string]bool{
+	"limit": true, "offset": true,
+	"os": true, "browser": true, "country": true, "deviceType": true, "ip": true,
+}
+
+// 从查询参数解析过滤条件, 出现未知参数时返回其名称
+func parseDeviceFilter(r *http.Request) (DeviceFilter, string) {
+	q := r.URL.Query()
+	for name := range q {
+		if !devicesQueryParams[name] {
+			return DeviceFilter{}, name
+		}
+	}
+	return DeviceFilter{
+		OS:         strings.TrimSpace(q.Get("os")),
+		Browser:    strings.TrimSpace(q.Get("browser")),
+		Country:    strings.TrimSpace(q.Get("country")),
+		DeviceType: strings.TrimSpace(q.Get("deviceType")),
+		IP:         strings.TrimSpace(q.Get("ip")),
+	}, ""
+}
+
+func (f DeviceFilter) Match(info DeviceInfo) bool {
+	return hasPrefixFold(info.OSVersion, f.OS) &&
+		hasPrefixFold(info.BrowserVersion, f.Browser) &&
+		(f.Country == "" || strings.EqualFold(info.GeoCountry, f.Country)) &&
+		(f.DeviceType == "" || strings.EqualFold(info.DeviceType, f.DeviceType)) &&
+		(f.IP == "" || info.IPAddress == f.IP)
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// 按条件过滤后分页, 供逐条扫描的存储后端使用; records 按时间从新到旧排列
+func findRecords(records []DeviceInfo, filter DeviceFilter, limit, offset int) []DeviceInfo {
+	matched := make([]DeviceInfo, 0)
+	for _, info := range records {
+		if filter.Match(info) {
+			matched = append(matched, info)
+		}
+	}
+	return paginate(matched, limit, offset)
+}
+
+// 列出已保存的设备信息, 支持 limit/offset 分页和字段过滤, 按时间从新到旧
+func devicesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		sendResponse(w, r, http.StatusMethodNotAllowed, Response{
+			Status:  "error",
+			Code:    "method_not_allowed",
+			Message: "Only GET method is allowed",
+		})
+		return
+	}
+
+	limit, err := queryInt(r, "limit", defaultPageLimit)
+	if err != nil {
+		sendResponse(w, r, http.StatusBadRequest, Response{
+			Status:  "error",
+			Code:    "invalid_param",
+			Message: "limit 必须是非负整数",
+		})
+		return
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		sendResponse(w, r, http.StatusBadRequest, Response{
+			Status:  "error",
+			Code:    "invalid_param",
+			Message: "offset 必须是非负整数",
+		})
+		return
+	}
+
+	filter, unknown := parseDeviceFilter(r)
+	if unknown != "" {
+		sendResponse(w, r, http.StatusBadRequest, Response{
+			Status:  "error",
+			Code:    "invalid_param",
+			Message: "未知的过滤条件 " + unknown + ", 可选 os/browser/country/deviceType/ip",
+		})
+		return
+	}
+
+	if store == nil {
+		sendResponse(w, r, http.StatusNotFound, Response{
+			Status:  "error",
+			Code:    "not_enabled",
+			Message: "设备存储未启用",
+		})
+		return
+	}
+
+	// limit=0 对存储后端表示不限制, 这里按字面返回空页
+	records := []DeviceInfo{}
+	if limit > 0 {
+		records, err = store.Find(r.Context(), filter, limit, offset)
+	}
+	if err != nil {
+		sendResponse(w, r, http.StatusInternalServerError, Response{
+			Status:  "error",
+			Code:    "storage_error",
+			Message: "读取设备信息失败: " + err.Error(),
+		})
+		return
+	}
+
+	sendResponse(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: "获取设备信息成功",
+		Data:    records,
+	})
+}
+
+// 读取非负整数查询参数, 缺省时返回默认值
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, strconv.ErrRange
+	}
+	return n, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 试运行: /collect?dryrun=1 或带 X-Dry-Run: 1 请求头, 取值按 strconv.ParseBool 解析
+func isDryRun(r *http.Request) bool {
+	for _, v := range []string{r.URL.Query().Get("dryrun"), r.Header.Get("X-Dry-Run")} {
+		if dry, err := strconv.ParseBool(v); err == nil && dry {
+			return true
+		}
+	}
+	return false
+}
+
+// 按正常提交的流程补充处理后直接返回完整的 DeviceInfo, 用于调试客户端接入
+// 不保存、不推送 Webhook 和事件、不计入统计和指纹轮换检测, 也不下发设备 Cookie; 限流照常生效
+func dryRunSubmission(w http.ResponseWriter, r *http.Request, ip string, info *DeviceInfo, start time.Time) {
+	enrichSubmission(r, ip, info)
+	if info.Respected == "" {
+		if c, err := r.Cookie(deviceCookieName); err == nil {
+			info.CookieID = c.Value
+		}
+	}
+
+	slog.InfoContext(r.Context(), "试运行提交", "event", "dry_run", "ip", info.IPAddress, "device_id", info.DeviceID,
+		"status", http.StatusOK, "latency_ms", latencyMs(start))
+	sendResponse(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: "试运行完成，未保存",
+		Data:    *info,
+	})
+}
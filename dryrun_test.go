@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIsDryRun(t *testing.T) {
+	tests := []struct {
+		target string
+		header string
+		want   bool
+	}{
+		{"/collect", "", false},
+		{"/collect?dryrun=1", "", true},
+		{"/collect?dryrun=true", "", true},
+		{"/collect?dryrun=0", "", false},
+		{"/collect?dryrun=yes", "", false},
+		{"/collect", "1", true},
+		{"/collect", "TRUE", true},
+		{"/collect?dryrun=0", "1", true},
+		{"/collect", "false", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", tt.target, nil)
+		if tt.header != "" {
+			r.Header.Set("X-Dry-Run", tt.header)
+		}
+		if got := isDryRun(r); got != tt.want {
+			t.Errorf("isDryRun(%s, X-Dry-Run: %q) = %v, want %v", tt.target, tt.header, got, tt.want)
+		}
+	}
+}
+
+// 提交涉及的全部状态, 测试期间替换为新的实例
+type submissionState struct {
+	store     Store
+	delivered atomic.Int32 // Webhook 收到的请求数
+	dlq       string
+	closeOnce sync.Once
+}
+
+// 关闭 Webhook 发送器, 等待队列中的记录投递完毕
+func (st *submissionState) flushWebhook() {
+	st.closeOnce.Do(func() { webhook.Close(context.Background()) })
+}
+
+func useSubmissionState(t *testing.T) *submissionState {
+	t.Helper()
+	st := &submissionState{store: NewRingStore(10), dlq: filepath.Join(t.TempDir(), "webhook-dlq.jsonl")}
+	useStore(t, st.store)
+	useIdempotencyCache(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st.delivered.Add(1)
+	}))
+	t.Cleanup(server.Close)
+
+	savedStats, savedHLL, savedPopulation, savedWebhook, savedMonitor := deviceStats, uniqueVisitors, fingerprintPopulation, webhook, fingerprintMonitor
+	deviceStats, uniqueVisitors, fingerprintPopulation = NewDeviceStatsStore(), NewHyperLogLog(), NewFingerprintPopulation()
+	webhook = NewWebhookSender(server.URL, st.dlq)
+	fingerprintMonitor = &FingerprintMonitor{
+		seen:      make(map[string]map[string]time.Time),
+		alerted:   make(map[string]time.Time),
+		clock:     systemClock,
+		window:    10 * time.Minute,
+		threshold: 100,
+	}
+	t.Cleanup(func() {
+		st.flushWebhook()
+		deviceStats, uniqueVisitors, fingerprintPopulation, webhook, fingerprintMonitor = savedStats, savedHLL, savedPopulation, savedWebhook, savedMonitor
+	})
+	return st
+}
+
+// 试运行返回补充处理后的结果, 但不保存, 也不改变统计、指纹总体、轮换检测、幂等缓存和 Webhook
+func TestDryRunLeavesStateUntouched(t *testing.T) {
+	const body = `{"userAgent":"Mozilla/5.0","screen":"1920x1080","canvasFingerprint":"canvas"}`
+	tests := []struct {
+		name    string
+		target  string
+		headers []string
+		dryRun  bool
+	}{
+		{"query", "/collect?dryrun=1", nil, true},
+		{"header", "/collect", []string{"X-Dry-Run", "true"}, true},
+		{"with idempotency key", "/collect?dryrun=1", []string{"Idempotency-Key", "k1"}, true},
+		// 对照: 正常提交会改变上述全部状态
+		{"normal submission", "/collect", []string{"Idempotency-Key", "k1"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := useSubmissionState(t)
+			w := postCollect(tt.target, body, append([]string{"User-Agent", "Mozilla/5.0"}, tt.headers...)...)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var resp struct{ Data DeviceInfo }
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if resp.Data.DeviceID == "" || resp.Data.IPAddress == "" || resp.Data.IsBot == "" {
+				t.Errorf("response not enriched: %+v", resp.Data)
+			}
+			deviceID := resp.Data.DeviceID
+			st.flushWebhook()
+
+			changed := map[string]bool{
+				"store":              storedCount(t, st.store) != 0,
+				"device stats":       func() bool { _, ok := deviceStats.Get(deviceID); return ok }(),
+				"unique visitors":    uniqueVisitors.Count() != 0,
+				"fingerprint totals": fingerprintPopulation.total != 0,
+				"rotation monitor":   len(fingerprintMonitor.seen) != 0,
+				"idempotency cache":  len(idempotencyCache.entries) != 0,
+				"webhook":            st.delivered.Load() != 0 || len(dlqRequestIDs(t, st.dlq)) != 0,
+				"device cookie":      w.Header().Get("Set-Cookie") != "",
+			}
+			for what, got := range changed {
+				if got == tt.dryRun {
+					t.Errorf("%s changed = %v, want %v", what, got, !tt.dryRun)
+				}
+			}
+		})
+	}
+}
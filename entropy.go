@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math"
+	"sync"
+)
+
+// 参与唯一性评估的指纹属性
+func fingerprintAttributes(info DeviceInfo) []string {
+	return []string{
+		info.CanvasFingerprint,
+		info.WebGLFingerprint,
+		info.FontFingerprint,
+		info.Screen,
+		info.Timezone,
+		info.LanguageFingerprint,
+		// 媒体设备数按 音频输入/视频输入/音频输出 合为一个属性, 浏览器禁止枚举时为空
+		info.AudioInputs + "/" + info.VideoInputs + "/" + info.AudioOutputs,
+	}
+}
+
+// FingerprintPopulation 已保存记录中各指纹属性取值的出现次数
+type FingerprintPopulation struct {
+	counts []map[string]int
+	total  int
+	mutex  sync.RWMutex
+}
+
+var fingerprintPopulation = NewFingerprintPopulation()
+
+func NewFingerprintPopulation() *FingerprintPopulation {
+	n := len(fingerprintAttributes(DeviceInfo{}))
+	p := &FingerprintPopulation{counts: make([]map[string]int, n)}
+	for i := range p.counts {
+		p.counts[i] = make(map[string]int)
+	}
+	return p
+}
+
+// 将一条记录计入总体
+func (p *FingerprintPopulation) Add(info DeviceInfo) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for i, v := range fingerprintAttributes(info) {
+		p.counts[i][v]++
+	}
+	p.total++
+}
+
+// 从总体中移除一条此前计入的记录
+func (p *FingerprintPopulation) Remove(info DeviceInfo) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for i, v := range fingerprintAttributes(info) {
+		if p.counts[i][v] <= 1 {
+			delete(p.counts[i], v)
+		} else {
+			p.counts[i][v]--
+		}
+	}
+	if p.total > 0 {
+		p.total--
+	}
+}
+
+// 清空总体
+func (p *FingerprintPopulation) Reset() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for i := range p.counts {
+		p.counts[i] = make(map[string]int)
+	}
+	p.total = 0
+}
+
+// 计算本次提交相对于总体的识别信息量 (比特)
+// 各属性的自信息 -log2(P(取值)) 按相互独立累加; 总体中视为已包含本次提交,
+// 结果不超过 log2(总数), 即在当前总体中唯一确定一台设备所需的信息量
+func (p *FingerprintPopulation) UniquenessBits(info DeviceInfo) float64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	total := float64(p.total + 1)
+	bits := 0.0
+	for i, v := range fingerprintAttributes(info) {
+		bits -= math.Log2(float64(p.counts[i][v]+1) / total)
+	}
+	bits = math.Min(bits, math.Log2(total))
+	return math.Round(bits*100) / 100
+}
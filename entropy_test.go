@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestUniquenessBits(t *testing.T) {
+	common := DeviceInfo{
+		CanvasFingerprint:   "c1",
+		WebGLFingerprint:    "w1",
+		FontFingerprint:     "f1",
+		Screen:              "1920x1080",
+		Timezone:            "Asia/Shanghai",
+		LanguageFingerprint: languageFingerprint([]string{"zh-CN", "en"}),
+		AudioInputs:         "1",
+		VideoInputs:         "1",
+		AudioOutputs:        "2",
+	}
+	p := NewFingerprintPopulation()
+	for i := 0; i < 7; i++ {
+		p.Add(common)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*DeviceInfo)
+		want   float64
+	}{
+		// 总体 7 条加本次共 8 条, 每个属性取值都已出现 7 次
+		{"common", func(*DeviceInfo) {}, 0},
+		// 一个属性从未出现: -log2(1/8) = 3, 不超过 log2(8)
+		{"new canvas", func(i *DeviceInfo) { i.CanvasFingerprint = "c2" }, 3},
+		{"media counts", func(i *DeviceInfo) { i.VideoInputs = "0" }, 3},
+		{"language order", func(i *DeviceInfo) { i.LanguageFingerprint = languageFingerprint([]string{"en", "zh-CN"}) }, 3},
+		{"enumeration blocked", func(i *DeviceInfo) { i.AudioInputs, i.VideoInputs, i.AudioOutputs = "", "", "" }, 3},
+		{"all new", func(i *DeviceInfo) { *i = DeviceInfo{CanvasFingerprint: "x"} }, 3},
+	}
+	for _, tt := range tests {
+		info := common
+		tt.modify(&info)
+		if got := p.UniquenessBits(info); got != tt.want {
+			t.Errorf("%s: UniquenessBits = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// EraseResult 删除结果: 存储中的记录数, 以及死信文件和 Webhook 死信文件中的条数
+type EraseResult struct {
+	Deleted     int `json:"deleted" xml:"deleted"`
+	DeadLetters int `json:"deadLetters" xml:"deadLetters"`
+	WebhookDLQ  int `json:"webhookDLQ" xml:"webhookDLQ"`
+}
+
+// 属于该设备的记录: DeviceID 相同, 或给出 cookieID 时 CookieID 相同
+func deviceMatcher(deviceID, cookieID string) func(DeviceInfo) bool {
+	return func(info DeviceInfo) bool {
+		return info.DeviceID == deviceID || (cookieID != "" && info.CookieID == cookieID)
+	}
+}
+
+// 死信的原始请求体是否属于该设备: 请求体中出现设备ID或 Cookie, 或解析后 (批量提交逐条) 计算出的设备ID相同
+// 无法解析的请求体只能按文本判断
+func deadLetterMatcher(deviceID, cookieID string, match func(DeviceInfo) bool) func(DeadLetter) bool {
+	return func(letter DeadLetter) bool {
+		if (deviceID != "" && strings.Contains(letter.Payload, deviceID)) || (cookieID != "" && strings.Contains(letter.Payload, cookieID)) {
+			return true
+		}
+		var batch []DeviceInfo
+		var info DeviceInfo
+		if json.Unmarshal([]byte(letter.Payload), &info) == nil {
+			batch = []DeviceInfo{info}
+		} else {
+			json.Unmarshal([]byte(letter.Payload), &batch)
+		}
+		for _, info := range batch {
+			info.Sanitize()
+			if info.DeviceID == "" {
+				info.DeviceID = ComputeDeviceID(info)
+			}
+			if match(info) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// 删除设备的全部数据 (GDPR 删除权): DELETE /devices/{id}?cookieId=...
+// 包括各存储后端中的记录 (JSONL 包括已轮转的分段)、访问统计、指纹总体、幂等缓存、Webhook 死信和被拒绝提交的死信,
+// 以及按设备ID限流的计数 (内存、Redis 和 RATE_LIMIT_STATE 文件) 和指纹轮换检测中的记录
+// 给出 cookieId 时同时删除该 Cookie 的记录; 重复删除返回的计数为 0, 不视为错误
+// 独立设备估算 (HyperLogLog) 不保存设备ID, 无需也无法删除
+// 每次请求都写一条审计日志, 不论是否删除了记录
+func eraseDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if r.Method != "DELETE" {
+		sendResponse(w, r, http.StatusMethodNotAllowed, Response{
+			Status:  "error",
+			Code:    "method_not_allowed",
+			Message: "Only DELETE method is allowed",
+		})
+		return
+	}
+
+	if store == nil {
+		sendResponse(w, r, http.StatusNotFound, Response{
+			Status:  "error",
+			Code:    "not_enabled",
+			Message: "设备存储未启用",
+		})
+		return
+	}
+
+	deviceID := r.PathValue("id")
+	cookieID := r.URL.Query().Get("cookieId")
+	match := deviceMatcher(deviceID, cookieID)
+	fail := func(err error) {
+		slog.ErrorContext(r.Context(), "删除设备记录失败", "event", "storage_error", "device_id", deviceID, "error", err)
+		sendResponse(w, r, http.StatusInternalServerError, Response{
+			Status:  "error",
+			Code:    "storage_error",
+			Message: "删除设备记录失败: " + err.Error(),
+		})
+	}
+
+	// 先读出要删除的记录, 用于从指纹总体中扣除, 并找出按 Cookie 匹配到的其他设备ID
+	var erased []DeviceInfo
+	err := store.Iterate(r.Context(), "", func(info DeviceInfo) error {
+		if match(info) {
+			erased = append(erased, info)
+		}
+		return nil
+	})
+	if err != nil {
+		fail(err)
+		return
+	}
+	deleted, err := store.Delete(r.Context(), deviceID, cookieID)
+	if err != nil {
+		fail(err)
+		return
+	}
+	deviceIDs := []string{deviceID}
+	for _, info := range erased {
+		if info.DeviceID != deviceID {
+			deviceIDs = append(deviceIDs, info.DeviceID)
+		}
+		// 降级期间总体已清空, 恢复后从存储重建
+		if !cachesShed.Load() {
+			fingerprintPopulation.Remove(info)
+		}
+	}
+	for _, id := range deviceIDs {
+		deviceStats.Delete(id)
+		if err := deviceLimiter.Forget(id); err != nil {
+			fail(err)
+			return
+		}
+	}
+	fingerprintMonitor.Forget(deviceIDs...)
+	idempotencyCache.Forget(match)
+	if rateLimitStatePath != "" {
+		if err := eraseRateLimitState(rateLimitStatePath, deviceIDs); err != nil {
+			fail(err)
+			return
+		}
+	}
+
+	result := EraseResult{Deleted: deleted}
+	if webhook != nil {
+		if result.WebhookDLQ, err = webhook.Erase(match); err != nil {
+			fail(err)
+			return
+		}
+	}
+	if deadLetters != nil {
+		if result.DeadLetters, err = deadLetters.Remove(deadLetterMatcher(deviceID, cookieID, match)); err != nil {
+			fail(err)
+			return
+		}
+	}
+
+	slog.InfoContext(r.Context(), "已删除设备记录", "event", "erasure", "device_id", deviceID, "cookie_id", cookieID,
+		"deleted", deleted, "dead_letters", result.DeadLetters, "webhook_dlq", result.WebhookDLQ,
+		"requester_ip", getClientIP(r), "latency_ms", latencyMs(start))
+	sendResponse(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: "删除完成",
+		Data:    result,
+	})
+}
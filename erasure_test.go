@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 删除设备时一并清除访问统计、指纹总体、幂等缓存、Webhook 死信和被拒绝提交的死信
+func TestEraseDevice(t *testing.T) {
+	target := DeviceInfo{UserAgent: "Mozilla/5.0", Screen: "1920x1080", CanvasFingerprint: "canvas-a", CookieID: "cookie-a"}
+	target.DeviceID = ComputeDeviceID(target)
+	// 另一台设备使用了同一个 Cookie, 按 cookieId 删除
+	sameCookie := DeviceInfo{DeviceID: "device-c", Screen: "800x600", CanvasFingerprint: "canvas-c", CookieID: "cookie-a"}
+	other := DeviceInfo{DeviceID: "device-b", Screen: "1024x768", CanvasFingerprint: "canvas-b", CookieID: "cookie-b"}
+	records := []DeviceInfo{target, other, target, sameCookie}
+	for i := range records {
+		records[i].Timestamp = "2024-01-01 10:00:0" + string(rune('0'+i))
+	}
+
+	for name, s := range newTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			useStore(t, s)
+			useIdempotencyCache(t)
+			dead := useDeadLetters(t)
+			savedStats, savedPopulation, savedWebhook := deviceStats, fingerprintPopulation, webhook
+			deviceStats, fingerprintPopulation = NewDeviceStatsStore(), NewFingerprintPopulation()
+			dlq := filepath.Join(t.TempDir(), "webhook-dlq.jsonl")
+			webhook = NewWebhookSender("http://127.0.0.1:0", dlq)
+			savedLimiter, savedMonitor, savedStatePath := deviceLimiter, fingerprintMonitor, rateLimitStatePath
+			limiter := newTestFallback(10, time.Minute)
+			deviceLimiter = limiter
+			fingerprintMonitor = &FingerprintMonitor{
+				seen:      make(map[string]map[string]time.Time),
+				alerted:   make(map[string]time.Time),
+				clock:     systemClock,
+				window:    10 * time.Minute,
+				threshold: 100,
+			}
+			rateLimitStatePath = filepath.Join(t.TempDir(), "ratelimit.json")
+			defer func() {
+				webhook.Close(context.Background())
+				deviceStats, fingerprintPopulation, webhook = savedStats, savedPopulation, savedWebhook
+				deviceLimiter, fingerprintMonitor, rateLimitStatePath = savedLimiter, savedMonitor, savedStatePath
+			}()
+
+			for _, info := range records {
+				if err := s.Insert(context.Background(), info); err != nil {
+					t.Fatal(err)
+				}
+				countRecord(info)
+				entry, _ := idempotencyCache.Begin(info.Timestamp, [32]byte{})
+				idempotencyCache.Complete(entry, info)
+				webhook.writeDLQ(info)
+				deviceLimiter.Allow(info.DeviceID)
+				fingerprintMonitor.Observe("192.0.2.1", info.DeviceID)
+			}
+			// 上次关闭时保存的限流状态
+			saved := rateLimitState{Limiters: map[string]map[string][]time.Time{"device": {}}}
+			for _, info := range records {
+				saved.Limiters["device"][info.DeviceID] = []time.Time{time.Now()}
+			}
+			data, _ := json.Marshal(saved)
+			if err := os.WriteFile(rateLimitStatePath, data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			payload, _ := json.Marshal(DeviceInfo{UserAgent: target.UserAgent, Screen: target.Screen, CanvasFingerprint: target.CanvasFingerprint})
+			for _, p := range []string{
+				string(payload),                        // 设备ID由服务端计算
+				"[" + string(payload) + "]",            // 批量提交
+				`{"cookieId":"cookie-a",`,              // 无法解析, 按文本匹配
+				`{"screen":"1024x768","platform":"x"}`, // 其他设备
+			} {
+				if err := dead.Add(DeadLetter{Timestamp: "2024-01-01 12:00:00", Reason: "test", Payload: p}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := httptest.NewRequest("DELETE", "/devices/"+target.DeviceID+"?cookieId=cookie-a", nil)
+			r.SetPathValue("id", target.DeviceID)
+			w := httptest.NewRecorder()
+			eraseDeviceHandler(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var resp struct{ Data EraseResult }
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if want := (EraseResult{Deleted: 3, DeadLetters: 3, WebhookDLQ: 3}); resp.Data != want {
+				t.Errorf("result = %+v, want %+v", resp.Data, want)
+			}
+
+			if ids := iterateIDs(t, s, ""); !equalStrings(ids, []string{other.DeviceID}) {
+				t.Errorf("stored = %v, want only %s", ids, other.DeviceID)
+			}
+			for _, id := range []string{target.DeviceID, sameCookie.DeviceID} {
+				if _, ok := deviceStats.Get(id); ok {
+					t.Errorf("stats for %s not erased", id)
+				}
+			}
+			if _, ok := deviceStats.Get(other.DeviceID); !ok {
+				t.Error("stats for other device erased")
+			}
+
+			// 指纹总体与只计入其他设备时相同
+			remaining := NewFingerprintPopulation()
+			remaining.Add(other)
+			if fingerprintPopulation.total != remaining.total ||
+				fingerprintPopulation.UniquenessBits(target) != remaining.UniquenessBits(target) {
+				t.Errorf("population total = %d, want %d", fingerprintPopulation.total, remaining.total)
+			}
+
+			// 按设备ID限流的计数 (内存和状态文件) 及指纹轮换检测中只剩其他设备
+			wantIDs := []string{other.DeviceID}
+			if got := sortedKeys(limiter.requests); !equalStrings(got, wantIDs) {
+				t.Errorf("device limiter keys = %v, want %v", got, wantIDs)
+			}
+			if got := sortedKeys(fingerprintMonitor.seen["192.0.2.1"]); !equalStrings(got, wantIDs) {
+				t.Errorf("rotation monitor = %v, want %v", got, wantIDs)
+			}
+			data, _ = os.ReadFile(rateLimitStatePath)
+			var state rateLimitState
+			if err := json.Unmarshal(data, &state); err != nil {
+				t.Fatal(err)
+			}
+			if got := sortedKeys(state.Limiters["device"]); !equalStrings(got, wantIDs) {
+				t.Errorf("saved device limiter keys = %v, want %v", got, wantIDs)
+			}
+
+			if len(idempotencyCache.entries) != 1 {
+				t.Errorf("idempotency entries = %d, want 1", len(idempotencyCache.entries))
+			}
+			data, err := os.ReadFile(dlq)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 1 || !strings.Contains(lines[0], other.DeviceID) {
+				t.Errorf("webhook dlq = %q", data)
+			}
+			letters, err := dead.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(letters) != 1 || !strings.Contains(letters[0].Payload, "1024x768") {
+				t.Errorf("dead letters = %+v", letters)
+			}
+
+			// 重复删除不是错误
+			w = httptest.NewRecorder()
+			eraseDeviceHandler(w, r)
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"deleted":0`) {
+				t.Errorf("repeat erase: %d %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+// JSONL 存储的删除覆盖已轮转 (包括已压缩) 的分段
+func TestEraseDeviceRotatedSegments(t *testing.T) {
+	jw, _ := newSegmentedJSONLStore(t)
+	useStore(t, jw)
+
+	r := httptest.NewRequest("DELETE", "/devices/a", nil)
+	r.SetPathValue("id", "a")
+	w := httptest.NewRecorder()
+	eraseDeviceHandler(w, r)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"deleted":3`) {
+		t.Fatalf("erase: %d %s", w.Code, w.Body)
+	}
+	if ids := iterateIDs(t, jw, ""); !equalStrings(ids, []string{"b", "c", "d"}) {
+		t.Errorf("stored = %v, want [b c d]", ids)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
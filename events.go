@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 每个 SSE 客户端的缓冲区大小, 写满后丢弃新事件
+const eventBufferSize = 16
+
+// 保活注释间隔, 便于及时发现断开的连接
+const eventKeepAlive = 30 * time.Second
+
+// EventHub 将新提交的设备信息分发给所有已连接的 SSE 客户端
+type EventHub struct {
+	clients map[chan []byte]struct{}
+	closed  bool
+	mutex   sync.Mutex
+}
+
+var eventHub = NewEventHub()
+
+func NewEventHub() *EventHub {
+	return &EventHub{clients: make(map[chan []byte]struct{})}
+}
+
+// 注册客户端, 返回的通道在取消注册或关闭 hub 时被关闭
+func (h *EventHub) Subscribe() chan []byte {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	ch := make(chan []byte, eventBufferSize)
+	if h.closed {
+		close(ch)
+		return ch
+	}
+	h.clients[ch] = struct{}{}
+	return ch
+}
+
+func (h *EventHub) Unsubscribe(ch chan []byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, ok := h.clients[ch]; ok {
+		delete(h.clients, ch)
+		close(ch)
+	}
+}
+
+// 发布一条设备信息, 不阻塞: 客户端缓冲区已满时丢弃该客户端的这条事件
+func (h *EventHub) Publish(info DeviceInfo) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if len(h.clients) == 0 {
+		return
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		slog.Error("序列化事件失败", "event", "sse_error", "error", err)
+		return
+	}
+	for ch := range h.clients {
+		select {
+		case ch <- data:
+		default:
+			slog.Warn("SSE 客户端消费过慢, 丢弃事件", "event", "sse_dropped")
+		}
+	}
+}
+
+// 关闭所有客户端连接, 服务器关闭时调用
+func (h *EventHub) Close() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.closed = true
+	for ch := range h.clients {
+		delete(h.clients, ch)
+		close(ch)
+	}
+}
+
+// 新提交的实时事件流 (Server-Sent Events)
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		sendResponse(w, r, http.StatusMethodNotAllowed, Response{
+			Status:  "error",
+			Code:    "method_not_allowed",
+			Message: "Only GET method is allowed",
+		})
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		sendResponse(w, r, http.StatusInternalServerError, Response{
+			Status:  "error",
+			Code:    "internal_error",
+			Message: "当前连接不支持事件流",
+		})
+		return
+	}
+
+	// 事件流是长连接, 不受服务器 WriteTimeout 限制
+	clearDeadlines(w, r)
+
+	ch := eventHub.Subscribe()
+	defer eventHub.Unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data, ok := <-ch:
+			if !ok {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: device\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 每写入多少行刷新一次, 大量导出时不在内存中积压
+const csvFlushRows = 100
+
+// CSV 列: DeviceInfo 中带 JSON 名称的字段, 顺序与结构体一致
+var csvColumns = func() []csvColumn {
+	var cols []csvColumn
+	t := reflect.TypeOf(DeviceInfo{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		cols = append(cols, csvColumn{name: name, index: i})
+	}
+	return cols
+}()
+
+type csvColumn struct {
+	name  string
+	index int
+}
+
+// 校验只读请求的方法、since 参数 (RFC3339) 和存储后端, 返回换算为本地时间的 since (未指定时为空)
+// 出错时写入错误响应并返回 false
+func sinceQuery(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if r.Method != "GET" {
+		sendResponse(w, r, http.StatusMethodNotAllowed, Response{
+			Status:  "error",
+			Code:    "method_not_allowed",
+			Message: "Only GET method is allowed",
+		})
+		return "", false
+	}
+
+	// 记录的 timestamp 为本地时间, since 换算到本地时间后按字符串比较
+	var since string
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Status:  "error",
+				Code:    "invalid_param",
+				Message: "since 必须是 RFC3339 格式的时间",
+			})
+			return "", false
+		}
+		since = t.In(time.Local).Format("2006-01-02 15:04:05")
+	}
+
+	if store == nil {
+		sendResponse(w, r, http.StatusNotFound, Response{
+			Status:  "error",
+			Code:    "not_enabled",
+			Message: "设备存储未启用",
+		})
+		return "", false
+	}
+	return since, true
+}
+
+// 逐条导出记录 (按写入顺序从旧到新): 第一条记录之前 (没有记录时在最后) 调用一次 begin 写入响应头, 每条记录调用一次 write
+// 读到第一条记录前出错时返回错误响应; 已开始输出后出错只能中断输出
+func streamRecords(w http.ResponseWriter, r *http.Request, since, format string, begin func(), write func(DeviceInfo) error) {
+	rows := 0
+	err := store.Iterate(r.Context(), since, func(info DeviceInfo) error {
+		if rows == 0 {
+			begin()
+		}
+		rows++
+		return write(info)
+	})
+	if err == nil && rows == 0 {
+		begin()
+	}
+	if err != nil && rows == 0 {
+		sendResponse(w, r, http.StatusInternalServerError, Response{
+			Status:  "error",
+			Code:    "storage_error",
+			Message: "读取设备信息失败: " + err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		slog.WarnContext(r.Context(), "导出中断", "event", "export_error", "format", format, "rows", rows, "error", err)
+		return
+	}
+	slog.InfoContext(r.Context(), "导出设备信息", "event", "export", "format", format, "rows", rows)
+}
+
+// 导出设备信息为 CSV: GET /devices.csv?since=RFC3339, 表头为 JSON 字段名
+func devicesCSVHandler(w http.ResponseWriter, r *http.Request) {
+	since, ok := sinceQuery(w, r)
+	if !ok {
+		return
+	}
+
+	// 导出可能很大, 不受服务器 WriteTimeout 限制
+	clearDeadlines(w, r)
+
+	flusher, _ := w.(http.Flusher)
+	cw := csv.NewWriter(w)
+	row := make([]string, len(csvColumns))
+	begin := func() {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", "attachment; filename=devices.csv")
+		for i, col := range csvColumns {
+			row[i] = col.name
+		}
+		cw.Write(row)
+	}
+	rows := 0
+	streamRecords(w, r, since, "csv", begin, func(info DeviceInfo) error {
+		v := reflect.ValueOf(info)
+		for i, col := range csvColumns {
+			row[i] = csvValue(v.Field(col.index))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+		rows++
+		if rows%csvFlushRows == 0 {
+			cw.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return nil
+	})
+	cw.Flush()
+}
+
+// 导出设备信息为 NDJSON: GET /devices.ndjson?since=RFC3339, 每行一个 JSON 对象, 逐条刷新
+func devicesNDJSONHandler(w http.ResponseWriter, r *http.Request) {
+	since, ok := sinceQuery(w, r)
+	if !ok {
+		return
+	}
+
+	// 导出可能很大, 不受服务器 WriteTimeout 限制
+	clearDeadlines(w, r)
+
+	flusher, _ := w.(http.Flusher)
+	begin := func() {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+
+	// Encoder 每次 Encode 后自动追加换行
+	enc := json.NewEncoder(w)
+	streamRecords(w, r, since, "ndjson", begin, func(info DeviceInfo) error {
+		if err := enc.Encode(info); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+}
+
+// 字段值转为单元格文本: 列表以分号连接, 映射编码为 JSON
+func csvValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return csvSafe(v.String())
+	case reflect.Int:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = v.Index(i).String()
+		}
+		return csvSafe(strings.Join(items, ";"))
+	case reflect.Map:
+		if v.Len() == 0 {
+			return ""
+		}
+		data, _ := json.Marshal(v.Interface())
+		return csvSafe(string(data))
+	}
+	return ""
+}
+
+// 客户端提交的文本以 = + - @ 开头时加单引号前缀, 防止在电子表格中被当作公式执行
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportHandlers(t *testing.T) {
+	local := func(s string) string {
+		ts, _ := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local)
+		return ts.Format(time.RFC3339)
+	}
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"all", "", []string{"a", "b", "c"}},
+		{"since", "?since=" + local("2024-01-02 00:00:00"), []string{"b", "c"}},
+		{"none", "?since=" + local("2025-01-01 00:00:00"), []string{}},
+	}
+
+	for name, s := range newTestStores(t) {
+		for _, info := range []DeviceInfo{
+			{DeviceID: "a", Timestamp: "2024-01-01 10:00:00", UserAgent: "=cmd"},
+			{DeviceID: "b", Timestamp: "2024-01-02 10:00:00"},
+			{DeviceID: "c", Timestamp: "2024-01-03 10:00:00"},
+		} {
+			s.Insert(context.Background(), info)
+		}
+		useStore(t, s)
+
+		for _, tt := range tests {
+			w := httptest.NewRecorder()
+			devicesNDJSONHandler(w, httptest.NewRequest("GET", "/devices.ndjson"+tt.query, nil))
+			if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+				t.Errorf("%s/%s: ndjson Content-Type = %q", name, tt.name, ct)
+			}
+			got := []string{}
+			dec := json.NewDecoder(w.Body)
+			for dec.More() {
+				var info DeviceInfo
+				if err := dec.Decode(&info); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, info.DeviceID)
+			}
+			if !equalStrings(got, tt.want) {
+				t.Errorf("%s/%s: ndjson = %v, want %v", name, tt.name, got, tt.want)
+			}
+
+			w = httptest.NewRecorder()
+			devicesCSVHandler(w, httptest.NewRequest("GET", "/devices.csv"+tt.query, nil))
+			rows, err := csv.NewReader(w.Body).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != len(tt.want)+1 || rows[0][0] != csvColumns[0].name {
+				t.Errorf("%s/%s: csv 有 %d 行, want 表头加 %d 行", name, tt.name, len(rows), len(tt.want))
+			}
+		}
+	}
+}
+
+func TestExportCSVFormulaEscape(t *testing.T) {
+	useStore(t, NewRingStore(10))
+	store.Insert(context.Background(), DeviceInfo{DeviceID: "a", UserAgent: "=HYPERLINK(\"x\")"})
+
+	w := httptest.NewRecorder()
+	devicesCSVHandler(w, httptest.NewRequest("GET", "/devices.csv", nil))
+	if !strings.Contains(w.Body.String(), `'=HYPERLINK`) {
+		t.Fatalf("公式未转义: %s", w.Body.String())
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != "attachment; filename=devices.csv" {
+		t.Fatalf("Content-Disposition = %q", cd)
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		query  string
+		store  Store
+		status int
+	}{
+		{"method", "POST", "", NewRingStore(1), http.StatusMethodNotAllowed},
+		{"bad since", "GET", "?since=yesterday", NewRingStore(1), http.StatusBadRequest},
+		{"no store", "GET", "", nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		useStore(t, tt.store)
+		w := httptest.NewRecorder()
+		devicesNDJSONHandler(w, httptest.NewRequest(tt.method, "/devices.ndjson"+tt.query, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
+
+// 每读出一条记录暂停一会儿, 模拟大量导出
+type slowStore struct {
+	Store
+	delay time.Duration
+}
+
+func (s slowStore) Iterate(ctx context.Context, since string, fn func(DeviceInfo) error) error {
+	return s.Store.Iterate(ctx, since, func(info DeviceInfo) error {
+		time.Sleep(s.delay)
+		return fn(info)
+	})
+}
+
+// 导出耗时超过服务器 WriteTimeout 时仍然完整输出
+func TestExportIgnoresWriteTimeout(t *testing.T) {
+	const records = 10
+	s := NewRingStore(records)
+	for i := 0; i < records; i++ {
+		s.Insert(context.Background(), DeviceInfo{DeviceID: fmt.Sprintf("d%d", i), Timestamp: "2024-01-01 10:00:00"})
+	}
+	useStore(t, slowStore{Store: s, delay: 20 * time.Millisecond})
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		lines   int
+	}{
+		{"csv", devicesCSVHandler, records + 1},
+		{"ndjson", devicesNDJSONHandler, records},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewUnstartedServer(tt.handler)
+		srv.Config.WriteTimeout = 50 * time.Millisecond
+		srv.Start()
+		defer srv.Close()
+
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: 读取响应: %v", tt.name, err)
+		}
+		if got := strings.Count(string(body), "\n"); got != tt.lines {
+			t.Errorf("%s: %d lines, want %d", tt.name, got, tt.lines)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FingerprintMonitor 统计每个IP在滑动窗口内提交的不同设备ID数量
+// 同一IP背后不断变换指纹是爬虫轮换指纹的典型特征, 超过阈值时告警
+type FingerprintMonitor struct {
+	seen      map[string]map[string]time.Time // IP -> 设备ID -> 最近一次出现时间
+	alerted   map[string]time.Time            // IP -> 最近一次告警时间, 窗口内只告警一次
+	mutex     sync.Mutex
+	clock     Clock
+	window    time.Duration
+	threshold int // <= 0 表示不启用
+}
+
+var fingerprintMonitor = &FingerprintMonitor{
+	seen:    make(map[string]map[string]time.Time),
+	alerted: make(map[string]time.Time),
+	clock:   systemClock,
+	window:  10 * time.Minute,
+}
+
+// 告警 Webhook 地址 (ALERT_WEBHOOK_URL 环境变量), 为空时只记录日志
+var alertWebhookURL string
+
+var alertClient = &http.Client{Timeout: 10 * time.Second}
+
+// 记录一次提交, 返回该IP窗口内的不同设备ID数量
+// 数量首次超过阈值时返回 alert 为 true, 同一IP在窗口内不重复告警
+func (m *FingerprintMonitor) Observe(ip, deviceID string) (count int, alert bool) {
+	if m.threshold <= 0 || deviceID == "" {
+		return 0, false
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.clock.Now()
+	devices := m.seen[ip]
+	if devices == nil {
+		devices = make(map[string]time.Time)
+		m.seen[ip] = devices
+	}
+	devices[deviceID] = now
+	for id, t := range devices {
+		if now.Sub(t) >= m.window {
+			delete(devices, id)
+		}
+	}
+
+	count = len(devices)
+	if count <= m.threshold {
+		return count, false
+	}
+	if t, ok := m.alerted[ip]; ok && now.Sub(t) < m.window {
+		return count, false
+	}
+	m.alerted[ip] = now
+	return count, true
+}
+
+// IPFingerprints 单个IP在窗口内提交的设备ID
+type IPFingerprints struct {
+	IP        string   `json:"ip" xml:"ip"`
+	Count     int      `json:"count" xml:"count"`
+	DeviceIDs []string `json:"deviceIds" xml:"deviceIds"`
+}
+
+// 窗口内不同设备ID数量不少于 minCount 的IP, 按数量从多到少排列
+func (m *FingerprintMonitor) Snapshot(minCount int) []IPFingerprints {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.clock.Now()
+	result := []IPFingerprints{}
+	for ip, devices := range m.seen {
+		entry := IPFingerprints{IP: ip, DeviceIDs: []string{}}
+		for id, t := range devices {
+			if now.Sub(t) < m.window {
+				entry.DeviceIDs = append(entry.DeviceIDs, id)
+			}
+		}
+		entry.Count = len(entry.DeviceIDs)
+		if entry.Count == 0 || entry.Count < minCount {
+			continue
+		}
+		sort.Strings(entry.DeviceIDs)
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].IP < result[j].IP
+	})
+	return result
+}
+
+// 清理窗口之外的记录, 删除已无记录的IP
+func (m *FingerprintMonitor) Sweep() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.clock.Now()
+	for ip, devices := range m.seen {
+		for id, t := range devices {
+			if now.Sub(t) >= m.window {
+				delete(devices, id)
+			}
+		}
+		if len(devices) == 0 {
+			delete(m.seen, ip)
+		}
+	}
+	for ip, t := range m.alerted {
+		if now.Sub(t) >= m.window {
+			delete(m.alerted, ip)
+		}
+	}
+}
+
+// 删除这些设备ID在各IP下的记录 (删除设备数据时调用), 删除已无记录的IP
+func (m *FingerprintMonitor) Forget(deviceIDs ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for ip, devices := range m.seen {
+		for _, id := range deviceIDs {
+			delete(devices, id)
+		}
+		if len(devices) == 0 {
+			delete(m.seen, ip)
+		}
+	}
+}
+
+// 启动后台清理
+func (m *FingerprintMonitor) StartSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			m.Sweep()
+		}
+	}()
+}
+
+// 记录提交的设备ID, 超过阈值时记录警告并异步发送告警
+func checkFingerprintRotation(r *http.Request, ip, deviceID string) {
+	count, alert := fingerprintMonitor.Observe(ip, deviceID)
+	if !alert {
+		return
+	}
+	slog.WarnContext(r.Context(), "同一IP提交了大量不同指纹", "event", "fingerprint_rotation", "ip", ip,
+		"distinct_devices", count, "window", fingerprintMonitor.window.String())
+	if alertWebhookURL != "" {
+		text := fmt.Sprintf("设备信息收集器: IP %s 在 %s 内提交了 %d 个不同的设备指纹", persistedIP(ip), fingerprintMonitor.window, count)
+		go sendAlert(text)
+	}
+}
+
+// 以 Slack 兼容的 {"text": ...} 格式发送告警, 失败只记录日志
+func sendAlert(text string) {
+	body, _ := json.Marshal(map[string]string{"text": text})
+	resp, err := alertClient.Post(alertWebhookURL, "application/json", bytes.NewReader(body))
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			err = fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+	}
+	if err != nil {
+		slog.Error("发送告警失败", "event", "alert_failed", "error", err)
+	}
+}
+
+// 查看各IP在窗口内提交的不同设备ID: GET /admin/fingerprints?min=N
+func fingerprintMonitorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		sendResponse(w, r, http.StatusMethodNotAllowed, Response{
+			Status:  "error",
+			Code:    "method_not_allowed",
+			Message: "Only GET method is allowed",
+		})
+		return
+	}
+
+	if fingerprintMonitor.threshold <= 0 {
+		sendResponse(w, r, http.StatusNotFound, Response{
+			Status:  "error",
+			Code:    "not_enabled",
+			Message: "指纹轮换检测未启用",
+		})
+		return
+	}
+
+	minCount, err := queryInt(r, "min", 2)
+	if err != nil {
+		sendResponse(w, r, http.StatusBadRequest, Response{
+			Status:  "error",
+			Code:    "invalid_param",
+			Message: "min 必须是非负整数",
+		})
+		return
+	}
+
+	sendResponse(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: "获取指纹统计成功",
+		Data:    fingerprintMonitor.Snapshot(minCount),
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// GeoResolver 基于 MaxMind .mmdb 数据库的IP地理位置查询
+type GeoResolver struct {
+	db      *geoip2.Reader
+	hasCity bool
+}
+
+// 未配置 GEOIP_DB 时为 nil
+var geoResolver *GeoResolver
+
+func NewGeoResolver(path string) (*GeoResolver, error) {
+	db, err := geoip2.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	// Country 版数据库不支持城市查询
+	hasCity := strings.Contains(db.Metadata().DatabaseType, "City")
+	return &GeoResolver{db: db, hasCity: hasCity}, nil
+}
+
+// 查询IP所在国家 (ISO 3166 代码) 和城市, 数据库中没有记录时返回空字符串
+func (g *GeoResolver) Lookup(ip string) (country, city string, err error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", "", fmt.Errorf("无效的IP地址 %q", ip)
+	}
+
+	if !g.hasCity {
+		record, err := g.db.Country(parsed)
+		if err != nil {
+			return "", "", err
+		}
+		return record.Country.IsoCode, "", nil
+	}
+
+	record, err := g.db.City(parsed)
+	if err != nil {
+		return "", "", err
+	}
+	city = record.City.Names["zh-CN"]
+	if city == "" {
+		city = record.City.Names["en"]
+	}
+	return record.Country.IsoCode, city, nil
+}
+
+func (g *GeoResolver) Close() error {
+	return g.db.Close()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 默认的反向地理编码服务 (Nominatim 兼容接口)
+const defaultGeocoderURL = "https://nominatim.openstreetmap.org/reverse"
+
+// 缓存的最大条目数, 写满后清空重来
+const geocodeCacheSize = 1000
+
+var errGeocodeRateLimited = errors.New("超出外部调用频率限制")
+
+// Geocoder 服务端反向地理编码, 坐标只发给服务端配置的地理编码服务
+// 坐标保留 4 位小数 (约 11 米) 后再查询, 同时作为缓存键
+type Geocoder struct {
+	url     string
+	client  *http.Client
+	limiter *RateLimiter
+	cache   map[string]string
+	mutex   sync.Mutex
+}
+
+// 未启用反向地理编码时为 nil
+var geocoder *Geocoder
+
+// perMinute 为每分钟最多调用外部服务的次数, Nominatim 公共服务要求不超过每秒 1 次
+func NewGeocoder(providerURL string, perMinute int) *Geocoder {
+	return &Geocoder{
+		url:    providerURL,
+		client: &http.Client{Timeout: 3 * time.Second},
+		limiter: &RateLimiter{
+			requests: make(map[string][]time.Time),
+			clock:    systemClock,
+			limit:    perMinute,
+			window:   time.Minute,
+		},
+		cache: make(map[string]string),
+	}
+}
+
+// 将客户端上报的经纬度解析为地址, 坐标无效时返回错误
+func (g *Geocoder) Reverse(lat, lng string) (string, error) {
+	la, err1 := strconv.ParseFloat(lat, 64)
+	lo, err2 := strconv.ParseFloat(lng, 64)
+	if err1 != nil || err2 != nil || la < -90 || la > 90 || lo < -180 || lo > 180 {
+		return "", fmt.Errorf("无效的坐标 %q, %q", lat, lng)
+	}
+	lat, lng = strconv.FormatFloat(la, 'f', 4, 64), strconv.FormatFloat(lo, 'f', 4, 64)
+	key := lat + "," + lng
+
+	g.mutex.Lock()
+	address, ok := g.cache[key]
+	g.mutex.Unlock()
+	if ok {
+		return address, nil
+	}
+
+	if !g.limiter.Allow("geocoder") {
+		return "", errGeocodeRateLimited
+	}
+	address, err := g.query(lat, lng)
+	if err != nil {
+		return "", err
+	}
+
+	g.mutex.Lock()
+	if len(g.cache) >= geocodeCacheSize {
+		clear(g.cache)
+	}
+	g.cache[key] = address
+	g.mutex.Unlock()
+	return address, nil
+}
+
+func (g *Geocoder) query(lat, lng string) (string, error) {
+	q := url.Values{
+		"format":         {"json"},
+		"lat":            {lat},
+		"lon":            {lng},
+		"zoom":           {"18"},
+		"addressdetails": {"0"},
+	}
+	req, err := http.NewRequest("GET", g.url+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	// Nominatim 使用政策要求标明应用身份
+	req.Header.Set("User-Agent", "device-info-collector")
+	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	var result struct {
+		DisplayName string `json:"display_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	return result.DisplayName, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// GPURule 显卡归一化规则
+// Pattern 匹配清理后的 renderer 字符串, Model 中可用 $1 等引用捕获组
+type GPURule struct {
+	Pattern string `json:"pattern"`
+	Vendor  string `json:"vendor"`
+	Model   string `json:"model"`
+
+	re *regexp.Regexp
+}
+
+// 内置规则, 按顺序匹配
+var defaultGPURules = []GPURule{
+	{Pattern: `(?i)geforce\s+((?:rtx|gtx|gt|mx)\s*\d+\w*(?:\s+(?:ti|super))*)`, Vendor: "NVIDIA", Model: "GeForce $1"},
+	{Pattern: `(?i)quadro\s+(\w+)`, Vendor: "NVIDIA", Model: "Quadro $1"},
+	{Pattern: `(?i)(?:nvidia\s+)?(rtx\s+a\d+)`, Vendor: "NVIDIA", Model: "$1"},
+	{Pattern: `(?i)radeon\s+((?:rx\s+)?(?:vega\s+)?\w+(?:\s+(?:xt|xtx|pro))?)`, Vendor: "AMD", Model: "Radeon $1"},
+	{Pattern: `(?i)radeon`, Vendor: "AMD", Model: "Radeon"},
+	{Pattern: `(?i)((?:uhd|hd|iris(?:\s+(?:xe|plus|pro))?)\s+graphics(?:\s+\d+)?)`, Vendor: "Intel", Model: "Intel $1"},
+	{Pattern: `(?i)intel.*?(arc\s+\w+)`, Vendor: "Intel", Model: "Intel $1"},
+	{Pattern: `(?i)apple\s+(m\d+(?:\s+(?:pro|max|ultra))?)`, Vendor: "Apple", Model: "Apple $1"},
+	{Pattern: `(?i)apple\s+gpu`, Vendor: "Apple", Model: "Apple GPU"},
+	{Pattern: `(?i)adreno\D*(\d+)`, Vendor: "Qualcomm", Model: "Adreno $1"},
+	{Pattern: `(?i)mali-?\s*(\w+)`, Vendor: "ARM", Model: "Mali-$1"},
+	{Pattern: `(?i)powervr\s+(.+)`, Vendor: "Imagination", Model: "PowerVR $1"},
+	{Pattern: `(?i)(swiftshader|llvmpipe|softpipe)`, Vendor: "Software", Model: "$1"},
+}
+
+// 生效的规则: GPU_MAP 中的自定义规则优先于内置规则
+var gpuRules []GPURule
+
+// 清理 renderer 中的驱动/图形接口等噪声
+var gpuNoise = []*regexp.Regexp{
+	regexp.MustCompile(`\((?:TM|R)\)`),
+	regexp.MustCompile(`\(0x[0-9A-Fa-f]+\)`),
+	regexp.MustCompile(`(?i)\s*direct3d\d*.*$`),
+	regexp.MustCompile(`(?i)\s*(?:opengl|vulkan|metal)\b.*$`),
+	regexp.MustCompile(`/PCIe/SSE2.*$`),
+	regexp.MustCompile(`(?i)\s*mesa\s+[\d.]+.*$`),
+	regexp.MustCompile(`\s*\(.*?LLVM.*?\)`),
+}
+
+// 加载显卡归一化规则, path 为空时只使用内置规则
+func loadGPURules(path string) error {
+	rules := make([]GPURule, 0, len(defaultGPURules))
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &rules); err != nil {
+			return fmt.Errorf("解析 %s 失败: %w", path, err)
+		}
+	}
+	rules = append(rules, defaultGPURules...)
+
+	for i := range rules {
+		re, err := regexp.Compile(rules[i].Pattern)
+		if err != nil {
+			return fmt.Errorf("无效的显卡规则 %q: %w", rules[i].Pattern, err)
+		}
+		rules[i].re = re
+	}
+	gpuRules = rules
+	return nil
+}
+
+// 去掉 ANGLE 包装, 取出真实的显卡描述
+// 例如 "ANGLE (NVIDIA, NVIDIA GeForce RTX 3060 Direct3D11 vs_5_0 ps_5_0, D3D11)"
+func unwrapANGLE(renderer string) string {
+	if !strings.HasPrefix(renderer, "ANGLE (") || !strings.HasSuffix(renderer, ")") {
+		return renderer
+	}
+	inner := renderer[len("ANGLE (") : len(renderer)-1]
+	if parts := strings.Split(inner, ", "); len(parts) >= 3 {
+		inner = parts[1]
+	}
+	// macOS 上的 Metal 后端: "ANGLE Metal Renderer: Apple M2"
+	return strings.TrimPrefix(inner, "ANGLE Metal Renderer: ")
+}
+
+// 将原始 WebGL 厂商与渲染器字符串归一化为显卡厂商和型号
+// 未匹配任何规则时返回清理后的字符串, ok 为 false
+func normalizeGPU(rawVendor, rawRenderer string) (vendor, model string, ok bool) {
+	cleaned := unwrapANGLE(strings.TrimSpace(rawRenderer))
+	for _, re := range gpuNoise {
+		cleaned = re.ReplaceAllString(cleaned, "")
+	}
+	cleaned = strings.Join(strings.Fields(cleaned), " ")
+
+	for _, rule := range gpuRules {
+		match := rule.re.FindStringSubmatchIndex(cleaned)
+		if match == nil {
+			continue
+		}
+		model := string(rule.re.ExpandString(nil, rule.Model, cleaned, match))
+		return rule.Vendor, strings.Join(strings.Fields(model), " "), true
+	}
+	return rawVendor, cleaned, false
+}
+
+// GPUStats 显卡分布, 按当前生效的归一化规则对记录中的原始 WebGL 字符串重新归一化
+type GPUStats struct {
+	Total     int        `json:"total" xml:"total"`
+	Unknown   int        `json:"unknown" xml:"unknown"`     // 未上报 WebGL 渲染器的记录数
+	Unmatched int        `json:"unmatched" xml:"unmatched"` // 未匹配任何规则的记录数, 不逐个列出
+	Models    []GPUCount `json:"models" xml:"models>model"`
+}
+
+// GPUCount 一个显卡型号的记录数
+type GPUCount struct {
+	Vendor string `json:"vendor" xml:"vendor"`
+	Model  string `json:"model" xml:"model"`
+	Count  int    `json:"count" xml:"count"`
+}
+
+// 汇总显卡分布, 型号按记录数从多到少排列
+// 统计时重新归一化, 修改 GPU_MAP 后历史记录也按新规则分组, 内存压力下跳过归一化的记录同样计入
+func aggregateGPUStats(ctx context.Context, s Store, since string) (GPUStats, error) {
+	type key struct{ vendor, model string }
+	counts := make(map[key]int)
+	stats := GPUStats{Models: []GPUCount{}}
+	err := s.Iterate(ctx, since, func(info DeviceInfo) error {
+		stats.Total++
+		if info.WebGLRenderer == "" {
+			stats.Unknown++
+			return nil
+		}
+		vendor, model, ok := normalizeGPU(info.WebGLVendor, info.WebGLRenderer)
+		if !ok {
+			stats.Unmatched++
+			return nil
+		}
+		counts[key{vendor, model}]++
+		return nil
+	})
+	if err != nil {
+		return GPUStats{}, err
+	}
+
+	for k, n := range counts {
+		stats.Models = append(stats.Models, GPUCount{Vendor: k.vendor, Model: k.model, Count: n})
+	}
+	sort.Slice(stats.Models, func(i, j int) bool {
+		a, b := stats.Models[i], stats.Models[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Vendor != b.Vendor {
+			return a.Vendor < b.Vendor
+		}
+		return a.Model < b.Model
+	})
+	return stats, nil
+}
+
+// 显卡分布: GET /stats/gpu?since=RFC3339
+func gpuStatsHandler(w http.ResponseWriter, r *http.Request) {
+	since, ok := sinceQuery(w, r)
+	if !ok {
+		return
+	}
+
+	stats, err := aggregateGPUStats(r.Context(), store, since)
+	if err != nil {
+		sendResponse(w, r, http.StatusInternalServerError, Response{
+			Status:  "error",
+			Code:    "storage_error",
+			Message: "读取设备信息失败: " + err.Error(),
+		})
+		return
+	}
+
+	sendResponse(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: "获取显卡分布成功",
+		Data:    stats,
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeGPU(t *testing.T) {
+	if err := loadGPURules(""); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		renderer string
+		vendor   string
+		model    string
+		ok       bool
+	}{
+		{"ANGLE (NVIDIA, NVIDIA GeForce RTX 3060 Direct3D11 vs_5_0 ps_5_0, D3D11)", "NVIDIA", "GeForce RTX 3060", true},
+		{"NVIDIA GeForce GTX 1050 Ti/PCIe/SSE2", "NVIDIA", "GeForce GTX 1050 Ti", true},
+		{"ANGLE (Intel, Intel(R) UHD Graphics 620 (0x00005917) Direct3D11 vs_5_0 ps_5_0, D3D11)", "Intel", "Intel UHD Graphics 620", true},
+		{"ANGLE (Apple, ANGLE Metal Renderer: Apple M2, Unspecified Version)", "Apple", "Apple M2", true},
+		{"Adreno (TM) 650", "Qualcomm", "Adreno 650", true},
+		{"Mali-G78 MP14", "ARM", "Mali-G78", true},
+		{"Some Unknown GPU", "Raw Vendor", "Some Unknown GPU", false},
+	}
+	for _, tt := range tests {
+		vendor, model, ok := normalizeGPU("Raw Vendor", tt.renderer)
+		if vendor != tt.vendor || model != tt.model || ok != tt.ok {
+			t.Errorf("normalizeGPU(%q) = %q, %q, %v, want %q, %q, %v", tt.renderer, vendor, model, ok, tt.vendor, tt.model, tt.ok)
+		}
+	}
+}
+
+func TestGPUStats(t *testing.T) {
+	rules := filepath.Join(t.TempDir(), "gpu.json")
+	os.WriteFile(rules, []byte(`[{"pattern": "(?i)acme\\s+(\\d+)", "vendor": "Acme", "model": "Acme $1"}]`), 0o644)
+	if err := loadGPURules(rules); err != nil {
+		t.Fatal(err)
+	}
+	defer loadGPURules("")
+
+	rs := NewRingStore(10)
+	for _, renderer := range []string{
+		"ANGLE (NVIDIA, NVIDIA GeForce RTX 3060 Direct3D11 vs_5_0 ps_5_0, D3D11)",
+		"NVIDIA GeForce RTX 3060/PCIe/SSE2",
+		"Acme 42 driver 1.2",
+		"Unknown Renderer",
+		"",
+	} {
+		rs.Insert(context.Background(), DeviceInfo{WebGLRenderer: renderer})
+	}
+
+	stats, err := aggregateGPUStats(context.Background(), rs, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []GPUCount{{"NVIDIA", "GeForce RTX 3060", 2}, {"Acme", "Acme 42", 1}}
+	if stats.Total != 5 || stats.Unknown != 1 || stats.Unmatched != 1 || len(stats.Models) != len(want) {
+		t.Fatalf("stats = %+v", stats)
+	}
+	for i := range want {
+		if stats.Models[i] != want[i] {
+			t.Errorf("models[%d] = %+v, want %+v", i, stats.Models[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// 以 prior knowledge 方式在明文连接上发起 HTTP/2 的客户端
+func h2cClient() *http.Client {
+	return &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		},
+	}
+}
+
+func TestH2C(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		client  *http.Client
+		proto   int // 0 表示请求应失败
+	}{
+		{"h2c client", true, h2cClient(), 2},
+		{"http/1.1 client", true, &http.Client{Timeout: 5 * time.Second}, 1},
+		{"h2c disabled", false, h2cClient(), 0},
+		{"http/1.1 without h2c", false, &http.Client{Timeout: 5 * time.Second}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewRingStore(10)
+			useStore(t, s)
+			cfg := Config{EnableH2C: tt.enabled, RequestTimeout: Duration(5 * time.Second)}
+			server := httptest.NewServer(newHandler(newMux(cfg), cfg))
+			defer server.Close()
+
+			req, _ := http.NewRequest("POST", server.URL+"/collect", strings.NewReader(`{"userAgent":"Mozilla/5.0","screen":"1920x1080"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("User-Agent", "Mozilla/5.0")
+			resp, err := tt.client.Do(req)
+			if tt.proto == 0 {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("request succeeded with %s, want failure", resp.Proto)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.ProtoMajor != tt.proto {
+				t.Errorf("proto = %s, want HTTP/%d", resp.Proto, tt.proto)
+			}
+			var body struct {
+				Status string
+				Data   DeviceInfo
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusOK || body.Data.DeviceID == "" {
+				t.Fatalf("status = %d, response = %+v", resp.StatusCode, body)
+			}
+			if ids := iterateIDs(t, s, ""); !equalStrings(ids, []string{body.Data.DeviceID}) {
+				t.Errorf("stored = %v, want [%s]", ids, body.Data.DeviceID)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// 保存的请求头总大小上限 (名称加值的字节数)
+const maxRecordedHeaderBytes = 8 << 10
+
+// 逐跳请求头, 只对单个连接有意义, 不保存
+var hopByHopHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Proxy-Connection":    true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	// 方法覆盖时携带的提交数据本身
+	"X-Payload": true,
+}
+
+// 保存时隐去值的敏感请求头
+var sensitiveHeaders = map[string]bool{
+	"Authorization": true,
+	"Cookie":        true,
+}
+
+// 携带客户端或代理地址的请求头, 启用 ANONYMIZE_IP 时其中的地址与 ipAddress 一样脱敏
+var forwardingHeaders = map[string]bool{
+	"X-Forwarded-For":  true,
+	"X-Real-Ip":        true,
+	"X-Client-Ip":      true,
+	"True-Client-Ip":   true,
+	"Cf-Connecting-Ip": true,
+	"Forwarded":        true,
+}
+
+// 是否隐去敏感请求头的值 (REDACT_HEADERS 环境变量, 默认开启)
+var redactHeaders = true
+
+// 整理要保存的请求头: 去掉逐跳头, 按需隐去敏感值, 多个值以 ", " 连接
+// 按名称顺序累加, 超过大小上限后的请求头丢弃
+func recordHeaders(h http.Header) map[string]string {
+	// Connection 中列出的请求头同样是逐跳的
+	connHeaders := make(map[string]bool)
+	for _, v := range h.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			connHeaders[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+		}
+	}
+
+	names := make([]string, 0, len(h))
+	for name := range h {
+		if !hopByHopHeaders[name] && !connHeaders[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	headers := make(map[string]string, len(names))
+	size := 0
+	for _, name := range names {
+		value := strings.Join(h[name], ", ")
+		if redactHeaders && sensitiveHeaders[name] {
+			value = "[REDACTED]"
+		}
+		if anonymizeIP && forwardingHeaders[name] {
+			value = anonymizeForwarding(name, value)
+		}
+		size += len(name) + len(value)
+		if size > maxRecordedHeaderBytes {
+			break
+		}
+		headers[name] = value
+	}
+	return headers
+}
+
+// 对转发头中的每个地址脱敏; 无法解析的地址整体隐去, 以免泄露完整地址
+func anonymizeForwarding(name, value string) string {
+	if name != "Forwarded" {
+		entries := strings.Split(value, ",")
+		for i, entry := range entries {
+			entries[i] = anonymizeHost(entry)
+		}
+		return strings.Join(entries, ", ")
+	}
+
+	// RFC 7239: Forwarded: for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8:cafe::17]:4711"
+	elements := strings.Split(value, ",")
+	for i, element := range elements {
+		pairs := strings.Split(strings.TrimSpace(element), ";")
+		for j, pair := range pairs {
+			key, node, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok {
+				continue
+			}
+			switch strings.ToLower(key) {
+			case "for", "by":
+				node = strings.Trim(node, `"`)
+				// unknown 和以下划线开头的混淆标识不是地址, 原样保留
+				if node != "unknown" && !strings.HasPrefix(node, "_") {
+					node = anonymizeHost(node)
+					if strings.Contains(node, ":") {
+						node = `"[` + node + `]"`
+					}
+				}
+				pairs[j] = key + "=" + node
+			}
+		}
+		elements[i] = strings.Join(pairs, ";")
+	}
+	return strings.Join(elements, ", ")
+}
+
+// 单个可能带端口的地址脱敏, 端口一并去掉
+func anonymizeHost(s string) string {
+	ip := parseHostIP(s)
+	if ip == nil {
+		return "[REDACTED]"
+	}
+	return AnonymizeIP(ip.String())
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRecordHeadersAnonymizesForwarding(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"X-Forwarded-For", "203.0.113.77, 10.0.0.1:8080", "203.0.113.0, 10.0.0.0"},
+		{"X-Forwarded-For", "2001:db8:1:2::9, [2001:db8:1:2::a]:443", "2001:db8:1::, 2001:db8:1::"},
+		{"X-Forwarded-For", "203.0.113.77, garbage", "203.0.113.0, [REDACTED]"},
+		{"X-Real-IP", "198.51.100.23", "198.51.100.0"},
+		{"CF-Connecting-IP", "::ffff:198.51.100.23", "198.51.100.0"},
+		{"True-Client-IP", "2001:db8::1", "2001:db8::"},
+		{"Forwarded", "for=192.0.2.60;proto=http;by=203.0.113.43", "for=192.0.2.0;proto=http;by=203.0.113.0"},
+		{"Forwarded", `For="[2001:db8:cafe::17]:4711", for=unknown;by=_hidden`, `For="[2001:db8:cafe::]", for=unknown;by=_hidden`},
+		{"Forwarded", `for="bogus"`, `for=[REDACTED]`},
+		// 其他请求头不受影响
+		{"Referer", "http://203.0.113.77/", "http://203.0.113.77/"},
+	}
+
+	for _, enabled := range []bool{true, false} {
+		useAnonymizeIP(t, enabled)
+		for _, tt := range tests {
+			h := http.Header{}
+			h.Set(tt.name, tt.value)
+			got := recordHeaders(h)[http.CanonicalHeaderKey(tt.name)]
+			want := tt.want
+			if !enabled {
+				want = tt.value
+			}
+			if got != want {
+				t.Errorf("anonymize=%v %s: %q -> %q, want %q", enabled, tt.name, tt.value, got, want)
+			}
+		}
+	}
+}
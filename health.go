@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 存储写入失败后报告未就绪的时长, 同时作为 503 响应的 Retry-After
+const storageRetryAfter = 5 * time.Second
+
+// StorageHealth 跟踪存储是否可用: 写入失败后在 storageRetryAfter 内报告未就绪,
+// 期间的提交仍会尝试写入, 一旦成功立即恢复; 冷却期过后也恢复, 由下一次写入重新判断
+type StorageHealth struct {
+	failedAt time.Time // 最近一次写入失败的时间, 零值表示正常
+	lastErr  error
+	mutex    sync.Mutex
+	clock    Clock
+}
+
+var storageHealth = &StorageHealth{clock: systemClock}
+
+// 根据写入结果更新状态
+func (h *StorageHealth) Observe(err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if err != nil {
+		h.failedAt, h.lastErr = h.clock.Now(), err
+	} else {
+		h.failedAt, h.lastErr = time.Time{}, nil
+	}
+}
+
+// 存储是否就绪; 未就绪时返回距恢复的剩余时间和最近一次错误
+func (h *StorageHealth) Ready() (ready bool, retryAfter time.Duration, lastErr error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.failedAt.IsZero() {
+		return true, 0, nil
+	}
+	remaining := storageRetryAfter - h.clock.Now().Sub(h.failedAt)
+	if remaining <= 0 {
+		return true, 0, nil
+	}
+	return false, remaining, h.lastErr
+}
+
+// 写入一条记录并更新存储状态
+func insertRecord(ctx context.Context, info DeviceInfo) error {
+	err := store.Insert(ctx, info)
+	storageHealth.Observe(err)
+	return err
+}
+
+// 写入存储失败的响应: 可重试的错误返回 503 和 Retry-After, 其余返回 500
+func sendStorageError(w http.ResponseWriter, r *http.Request, err error, data interface{}) {
+	if errors.Is(err, ErrStorageUnavailable) {
+		_, retryAfter, _ := storageHealth.Ready()
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfter)))
+		sendResponse(w, r, http.StatusServiceUnavailable, Response{
+			Status:  "error",
+			Code:    "storage_unavailable",
+			Message: "存储暂时不可用，请稍后重试",
+			Data:    data,
+		})
+		return
+	}
+	sendResponse(w, r, http.StatusInternalServerError, Response{
+		Status:  "error",
+		Code:    "storage_error",
+		Message: "保存设备信息失败",
+		Data:    data,
+	})
+}
+
+// 存活检查: GET /healthz, 只反映进程本身能否处理请求, 不检查任何依赖
+// 依赖故障时不应让编排系统重启进程, 应通过 /readyz 暂时摘除流量
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		sendResponse(w, r, http.StatusMethodNotAllowed, Response{
+			Status:  "error",
+			Code:    "method_not_allowed",
+			Message: "Only GET method is allowed",
+		})
+		return
+	}
+	sendResponse(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: "ok",
+	})
+}
+
+// 单个依赖检查的超时
+const readinessTimeout = 2 * time.Second
+
+// DependencyStatus 单个依赖的检查结果
+type DependencyStatus struct {
+	Name string `json:"name" xml:"name"`
+	// ok: 正常; degraded: 不可用但有降级方案, 不影响就绪; unavailable: 不可用
+	Status string `json:"status" xml:"status"`
+	Error  string `json:"error,omitempty" xml:"error,omitempty"`
+}
+
+// 检查已启用的依赖: 存储 (最近写入结果和 Ping)、GeoIP/ASN 数据库、Redis 限流
+func checkDependencies(ctx context.Context) []DependencyStatus {
+	deps := []DependencyStatus{}
+	if store != nil {
+		dep := DependencyStatus{Name: "storage", Status: "ok"}
+		ready, _, err := storageHealth.Ready()
+		if ready {
+			if pinger, ok := store.(Pinger); ok {
+				pingCtx, cancel := context.WithTimeout(ctx, readinessTimeout)
+				err = pinger.Ping(pingCtx)
+				cancel()
+			}
+		}
+		if err != nil {
+			dep.Status, dep.Error = "unavailable", err.Error()
+		}
+		deps = append(deps, dep)
+	}
+	if geoResolver != nil {
+		deps = append(deps, DependencyStatus{Name: "geoip", Status: "ok"})
+	}
+	if asnResolver != nil {
+		deps = append(deps, DependencyStatus{Name: "geoip_asn", Status: "ok"})
+	}
+	if rl, ok := requestLimiter.(*RedisLimiter); ok {
+		// Redis 不可用时退回内存限流, 只标记为降级
+		dep := DependencyStatus{Name: "redis", Status: "ok"}
+		if err := rl.Ping(ctx); err != nil {
+			dep.Status, dep.Error = "degraded", err.Error()
+		}
+		deps = append(deps, dep)
+	}
+	return deps
+}
+
+// 就绪检查: GET /readyz, 任一依赖不可用时返回 503, 供负载均衡暂时摘除实例
+// 响应 data 列出每个依赖的状态
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		sendResponse(w, r, http.StatusMethodNotAllowed, Response{
+			Status:  "error",
+			Code:    "method_not_allowed",
+			Message: "Only GET method is allowed",
+		})
+		return
+	}
+
+	deps := checkDependencies(r.Context())
+	for _, dep := range deps {
+		if dep.Status == "unavailable" {
+			sendResponse(w, r, http.StatusServiceUnavailable, Response{
+				Status:  "error",
+				Code:    "not_ready",
+				Message: "依赖不可用: " + dep.Name,
+				Data:    deps,
+			})
+			return
+		}
+	}
+	sendResponse(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: "ready",
+		Data:    deps,
+	})
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestHyperLogLogEstimate(t *testing.T) {
+	tests := []struct {
+		distinct int
+		repeats  int
+	}{
+		{0, 1},
+		{1, 5},
+		{100, 3},
+		{10000, 2},
+		{200000, 2},
+	}
+	stdErr := 1.04 / math.Sqrt(1<<hllPrecision)
+	for _, tt := range tests {
+		h := NewHyperLogLog()
+		// 重复加入同一元素不影响估算
+		for r := 0; r < tt.repeats; r++ {
+			for i := 0; i < tt.distinct; i++ {
+				h.Add(fmt.Sprintf("device-%d", i))
+			}
+		}
+		h.Add("")
+
+		got := float64(h.Count())
+		// 三倍标准误差内, 另留 1 个的取整余量
+		bound := 3*stdErr*float64(tt.distinct) + 1
+		if math.Abs(got-float64(tt.distinct)) > bound {
+			t.Errorf("distinct=%d repeats=%d: estimate = %.0f, want within ±%.0f", tt.distinct, tt.repeats, got, bound)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Idempotency-Key 的最大长度
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyCache 记录近期处理过的 Idempotency-Key 及首次提交的结果
+// 客户端超时重试时直接返回首次结果, 不重复保存
+// 键由提交方 (API 密钥或客户端IP) 和 Idempotency-Key 组成, 不同客户端使用相同的 key 互不影响
+type IdempotencyCache struct {
+	entries map[string]*idempotentEntry
+	mutex   sync.Mutex
+	clock   Clock
+	ttl     time.Duration
+}
+
+type idempotentEntry struct {
+	bodyHash [sha256.Size]byte // 首次提交的请求体摘要, 创建后不再修改
+	done     chan struct{}     // 首个请求处理结束时关闭
+	result   *DeviceInfo       // 首个请求未成功完成时为 nil
+	expires  time.Time
+}
+
+var idempotencyCache = &IdempotencyCache{
+	entries: make(map[string]*idempotentEntry),
+	clock:   systemClock,
+	ttl:     10 * time.Minute,
+}
+
+// 占用 key: 首次出现时返回 owner 为 true, 调用方处理完后须调用 Complete 或 Abort
+// key 已被占用时返回已有记录, 调用方先比较 bodyHash, 一致时等待 done 关闭后读取结果
+func (c *IdempotencyCache) Begin(key string, bodyHash [sha256.Size]byte) (entry *idempotentEntry, owner bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if e, ok := c.entries[key]; ok && c.clock.Now().Before(e.expires) {
+		return e, false
+	}
+	e := &idempotentEntry{bodyHash: bodyHash, done: make(chan struct{}), expires: c.clock.Now().Add(c.ttl)}
+	c.entries[key] = e
+	return e, true
+}
+
+// 保存首次处理的结果并唤醒等待中的重复请求
+func (c *IdempotencyCache) Complete(entry *idempotentEntry, info DeviceInfo) {
+	c.mutex.Lock()
+	entry.result = &info
+	entry.expires = c.clock.Now().Add(c.ttl)
+	c.mutex.Unlock()
+	close(entry.done)
+}
+
+// 首次处理未成功完成时释放 key, 等待中的重复请求将重新处理
+func (c *IdempotencyCache) Abort(key string, entry *idempotentEntry) {
+	c.mutex.Lock()
+	if c.entries[key] == entry {
+		delete(c.entries, key)
+	}
+	c.mutex.Unlock()
+	close(entry.done)
+}
+
+// 清理已过期的 key
+func (c *IdempotencyCache) Sweep() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.clock.Now()
+	for key, e := range c.entries {
+		if e.result != nil && !now.Before(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// 清理全部已完成的 key, 处理中的 key 仍有请求在等待, 保留
+func (c *IdempotencyCache) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for key, e := range c.entries {
+		if e.result != nil {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// 删除结果符合条件的已完成 key, 返回删除的个数
+func (c *IdempotencyCache) Forget(match func(DeviceInfo) bool) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	forgotten := 0
+	for key, e := range c.entries {
+		if e.result != nil && match(*e.result) {
+			delete(c.entries, key)
+			forgotten++
+		}
+	}
+	return forgotten
+}
+
+// 启动后台清理
+func (c *IdempotencyCache) StartSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			c.Sweep()
+		}
+	}()
+}
+
+// Idempotency-Key 的作用范围: 携带有效 API 密钥时按密钥, 否则按客户端IP
+func idempotencyScope(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && validAPIKey(token) {
+		sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+		return "key:" + hex.EncodeToString(sum[:8])
+	}
+	return "ip:" + getClientIP(r)
+}
+
+// 处理 Idempotency-Key 请求头, raw 为原始请求体
+// key 重复且首次提交已完成时直接写入首次结果并返回 false; 请求体与首次提交不同时返回 422
+// 否则返回 finish, 调用方须在处理结束时调用: 成功时传入结果, 失败时传 nil
+func idempotencyGuard(w http.ResponseWriter, r *http.Request, raw []byte) (finish func(*DeviceInfo), ok bool) {
+	key := r.Header.Get("Idempotency-Key")
+	// 内存压力降级时不缓存结果
+	if key == "" || degraded.Load() {
+		return func(*DeviceInfo) {}, true
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		sendResponse(w, r, http.StatusBadRequest, Response{
+			Status:  "error",
+			Code:    "invalid_param",
+			Message: fmt.Sprintf("Idempotency-Key 不能超过 %d 个字符", maxIdempotencyKeyLength),
+		})
+		return nil, false
+	}
+
+	key = idempotencyScope(r) + "\n" + key
+	bodyHash := sha256.Sum256(raw)
+	for {
+		entry, owner := idempotencyCache.Begin(key, bodyHash)
+		if owner {
+			return func(info *DeviceInfo) {
+				if info == nil {
+					idempotencyCache.Abort(key, entry)
+				} else {
+					idempotencyCache.Complete(entry, *info)
+				}
+			}, true
+		}
+
+		if entry.bodyHash != bodyHash {
+			slog.WarnContext(r.Context(), "同一 Idempotency-Key 的提交内容不同", "event", "idempotency_mismatch", "ip", getClientIP(r),
+				"status", http.StatusUnprocessableEntity)
+			sendResponse(w, r, http.StatusUnprocessableEntity, Response{
+				Status:  "error",
+				Code:    "idempotency_mismatch",
+				Message: "Idempotency-Key 已用于内容不同的提交",
+			})
+			return nil, false
+		}
+
+		// 同一 key 的请求正在处理, 等待其结束
+		select {
+		case <-entry.done:
+		case <-r.Context().Done():
+			return nil, false
+		}
+		if entry.result != nil {
+			slog.InfoContext(r.Context(), "重复提交, 返回首次结果", "event", "idempotent_replay", "ip", getClientIP(r), "status", http.StatusOK)
+			w.Header().Set("Idempotent-Replayed", "true")
+			sendResponse(w, r, http.StatusOK, Response{
+				Status:  "success",
+				Message: "设备信息收集成功",
+				Data:    responseData(*entry.result),
+			})
+			return nil, false
+		}
+		// 首次处理失败, 重新占用 key
+	}
+}
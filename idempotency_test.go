@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyCacheTTL(t *testing.T) {
+	clock := newFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local))
+	cache := &IdempotencyCache{
+		entries: make(map[string]*idempotentEntry),
+		clock:   clock,
+		ttl:     10 * time.Minute,
+	}
+
+	entry, owner := cache.Begin("k", [32]byte{})
+	if !owner {
+		t.Fatal("首次出现的 key 应由调用方处理")
+	}
+	cache.Complete(entry, DeviceInfo{DeviceID: "d1"})
+
+	clock.Advance(9 * time.Minute)
+	dup, owner := cache.Begin("k", [32]byte{})
+	if owner || dup.result == nil || dup.result.DeviceID != "d1" {
+		t.Fatal("TTL 内的重复 key 应返回首次结果")
+	}
+	cache.Sweep()
+	if len(cache.entries) != 1 {
+		t.Fatal("未过期的 key 不应被清理")
+	}
+
+	clock.Advance(time.Minute)
+	if _, owner := cache.Begin("k", [32]byte{}); !owner {
+		t.Fatal("过期的 key 应重新处理")
+	}
+
+	// 已完成的过期记录被清理, 处理中的不清理
+	done, _ := cache.Begin("done", [32]byte{})
+	cache.Complete(done, DeviceInfo{})
+	cache.Begin("pending", [32]byte{})
+	clock.Advance(11 * time.Minute)
+	cache.Sweep()
+	if _, ok := cache.entries["done"]; ok {
+		t.Fatal("过期的 key 未被清理")
+	}
+	if _, ok := cache.entries["pending"]; !ok {
+		t.Fatal("处理中的 key 不应被清理")
+	}
+}
+
+func useIdempotencyCache(t *testing.T) {
+	t.Helper()
+	saved := idempotencyCache
+	idempotencyCache = &IdempotencyCache{
+		entries: make(map[string]*idempotentEntry),
+		clock:   systemClock,
+		ttl:     10 * time.Minute,
+	}
+	t.Cleanup(func() { idempotencyCache = saved })
+}
+
+// 以 idempotencyGuard 处理一次提交; 成为首个请求时在 release 关闭后以 deviceID 完成
+func guardedSubmit(remoteAddr, auth, key, body string, release <-chan struct{}, owners *atomic.Int32) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/collect", nil)
+	r.RemoteAddr = remoteAddr
+	r.Header.Set("Idempotency-Key", key)
+	if auth != "" {
+		r.Header.Set("Authorization", "Bearer "+auth)
+	}
+	w := httptest.NewRecorder()
+	finish, ok := idempotencyGuard(w, r, []byte(body))
+	if ok {
+		owners.Add(1)
+		<-release
+		finish(&DeviceInfo{DeviceID: "d-" + remoteAddr})
+		w.WriteHeader(http.StatusCreated)
+	}
+	return w
+}
+
+func TestIdempotencyGuard(t *testing.T) {
+	savedKeys := apiKeys
+	apiKeys = parseAPIKeys("k1,k2")
+	defer func() { apiKeys = savedKeys }()
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		auth       string
+		body       string
+		status     int
+		replayed   bool
+	}{
+		{"same client same body", "192.0.2.1:1000", "", "a", http.StatusOK, true},
+		{"same client other port", "192.0.2.1:2000", "", "a", http.StatusOK, true},
+		{"same client different body", "192.0.2.1:1000", "", "b", http.StatusUnprocessableEntity, false},
+		{"other client", "192.0.2.2:1000", "", "a", http.StatusCreated, false},
+		{"other client different body", "192.0.2.3:1000", "", "b", http.StatusCreated, false},
+		{"api key scope", "192.0.2.1:1000", "k1", "a", http.StatusCreated, false},
+		{"invalid api key falls back to ip", "192.0.2.1:1000", "bogus", "a", http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useIdempotencyCache(t)
+			release := make(chan struct{})
+			close(release)
+			var owners atomic.Int32
+			guardedSubmit("192.0.2.1:1000", "", "key-1", "a", release, &owners)
+
+			w := guardedSubmit(tt.remoteAddr, tt.auth, "key-1", tt.body, release, &owners)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("Idempotent-Replayed") == "true"; got != tt.replayed {
+				t.Errorf("replayed = %v, want %v", got, tt.replayed)
+			}
+		})
+	}
+}
+
+// 同时到达的重复提交只有一个被处理, 其余等待后返回首次结果; 内容不同的立即返回 422
+func TestIdempotencyGuardConcurrent(t *testing.T) {
+	useIdempotencyCache(t)
+	release := make(chan struct{})
+	var owners atomic.Int32
+
+	const duplicates = 20
+	codes := make(chan int, duplicates)
+	var wg sync.WaitGroup
+	for i := 0; i < duplicates; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- guardedSubmit("192.0.2.1:1000", "", "key-1", "a", release, &owners).Code
+		}()
+	}
+
+	// 首个请求处理期间, 内容不同的提交不等待
+	deadline := time.Now().Add(5 * time.Second)
+	for owners.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if w := guardedSubmit("192.0.2.1:1000", "", "key-1", "b", release, &owners); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("mismatched body status = %d, want 422", w.Code)
+	}
+
+	close(release)
+	wg.Wait()
+	close(codes)
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	if owners.Load() != 1 || counts[http.StatusCreated] != 1 || counts[http.StatusOK] != duplicates-1 {
+		t.Errorf("owners = %d, status counts = %v", owners.Load(), counts)
+	}
+}
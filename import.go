@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 导入文件中单行超过提交大小上限
+var errLineTooLong = errors.New("行超过长度上限")
+
+// ImportResult 导入结果
+type ImportResult struct {
+	Imported int `json:"imported" xml:"imported"`
+	Failed   int `json:"failed" xml:"failed"`
+}
+
+// 批量导入历史记录: POST /import, 请求体为 NDJSON (可 gzip 压缩), 每行一个 DeviceInfo
+// 逐行读取写入存储, 保留原有 timestamp; 无法解析或缺少必填字段的行记录日志后跳过
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if r.Method != "POST" {
+		sendResponse(w, r, http.StatusMethodNotAllowed, Response{
+			Status:  "error",
+			Code:    "method_not_allowed",
+			Message: "Only POST method is allowed",
+		})
+		return
+	}
+
+	if store == nil {
+		sendResponse(w, r, http.StatusNotFound, Response{
+			Status:  "error",
+			Code:    "not_enabled",
+			Message: "设备存储未启用",
+		})
+		return
+	}
+
+	// 导入文件可能很大, 不受服务器读写超时限制
+	clearDeadlines(w, r)
+
+	var body io.Reader = r.Body
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Status:  "error",
+				Code:    "bad_json",
+				Message: "Invalid gzip body: " + err.Error(),
+			})
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	var result ImportResult
+	br := bufio.NewReaderSize(body, maxBodySize)
+	for lineNo := 1; ; lineNo++ {
+		line, err := readLine(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != errLineTooLong {
+			slog.WarnContext(r.Context(), "导入中断", "event", "import_error", "line", lineNo, "error", err,
+				"imported", result.Imported, "failed", result.Failed, "status", http.StatusBadRequest)
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Status:  "error",
+				Code:    "bad_json",
+				Message: "读取导入数据失败: " + err.Error(),
+				Data:    result,
+			})
+			return
+		}
+		if err == nil && len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if err == nil {
+			err = importRecord(r, line)
+		}
+		if errors.Is(err, ErrStorageUnavailable) {
+			// 存储暂时不可用时后续行也会失败, 中断导入; 已导入的行数随响应返回, 可从该处续传
+			slog.WarnContext(r.Context(), "导入中断", "event", "import_error", "line", lineNo, "error", err,
+				"imported", result.Imported, "failed", result.Failed, "status", http.StatusServiceUnavailable)
+			sendStorageError(w, r, err, result)
+			return
+		}
+		if err != nil {
+			slog.WarnContext(r.Context(), "跳过无效的导入记录", "event", "import_skipped", "line", lineNo, "error", err)
+			result.Failed++
+			continue
+		}
+		result.Imported++
+	}
+
+	slog.InfoContext(r.Context(), "导入设备信息", "event", "import", "imported", result.Imported, "failed", result.Failed,
+		"status", http.StatusOK, "latency_ms", latencyMs(start))
+	sendResponse(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: "导入完成",
+		Data:    result,
+	})
+}
+
+// 解析并保存一条导入记录, 同时更新访问统计和指纹总体; 历史记录不推送事件和 Webhook
+func importRecord(r *http.Request, line []byte) error {
+	var info DeviceInfo
+	if err := json.Unmarshal(line, &info); err != nil {
+		return err
+	}
+	info.Sanitize()
+	if err := info.Validate(); err != nil {
+		return err
+	}
+	if _, err := time.ParseInLocation("2006-01-02 15:04:05", info.Timestamp, time.Local); err != nil {
+		return errors.New("timestamp 应为 2006-01-02 15:04:05 格式")
+	}
+	if info.DeviceID == "" {
+		info.DeviceID = ComputeDeviceID(info)
+	}
+	// 其他实例导出的记录可能未脱敏
+	info.IPAddress = persistedIP(info.IPAddress)
+
+	if err := insertRecord(r.Context(), info); err != nil {
+		return err
+	}
+	countRecord(info)
+	uniqueVisitors.Add(info.DeviceID)
+	return nil
+}
+
+// 读取一行 (不含换行符); 超过缓冲区大小的行读完丢弃并返回 errLineTooLong
+func readLine(br *bufio.Reader) ([]byte, error) {
+	line, err := br.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		for err == bufio.ErrBufferFull {
+			_, err = br.ReadSlice('\n')
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		return nil, errLineTooLong
+	}
+	if err == io.EOF && len(line) > 0 {
+		// 最后一行没有换行符
+		err = nil
+	}
+	return bytes.TrimSuffix(line, []byte("\n")), err
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 以底层连接为键保存 TLS 握手时计算的 JA3, 连接关闭时删除
+// GetConfigForClient 拿到的是底层连接, 与 (*tls.Conn).NetConn() 相同
+var ja3ByConn sync.Map // net.Conn -> string
+
+// 请求上下文中保存所属的底层连接
+type tlsConnKey struct{}
+
+// 直接提供 HTTPS 服务时使用的 TLS 配置: 在握手中计算客户端的 JA3, 其余沿用默认配置
+func ja3TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			ja3ByConn.Store(hello.Conn, JA3(hello))
+			return nil, nil
+		},
+	}
+}
+
+// http.Server.ConnContext: 记录请求所属的连接, HTTP/2 的多个请求共用同一连接
+func ja3ConnContext(ctx context.Context, c net.Conn) context.Context {
+	if tc, ok := c.(*tls.Conn); ok {
+		return context.WithValue(ctx, tlsConnKey{}, tc.NetConn())
+	}
+	return ctx
+}
+
+// http.Server.ConnState: 连接关闭或被接管后删除其 JA3
+func ja3ConnState(c net.Conn, state http.ConnState) {
+	if state != http.StateClosed && state != http.StateHijacked {
+		return
+	}
+	if tc, ok := c.(*tls.Conn); ok {
+		ja3ByConn.Delete(tc.NetConn())
+	}
+}
+
+// 请求所属 TLS 连接的 JA3; 明文连接或 TLS 在反向代理终止时为空
+func requestJA3(r *http.Request) string {
+	conn := r.Context().Value(tlsConnKey{})
+	if conn == nil {
+		return ""
+	}
+	if v, ok := ja3ByConn.Load(conn); ok {
+		return v.(string)
+	}
+	return ""
+}
+
+// 计算 ClientHello 的 JA3: 版本,密码套件,扩展,椭圆曲线,点格式 各字段内以 - 连接, 取 MD5
+// 版本为 ClientHello 中的 legacy_version: 带 supported_versions 扩展的客户端固定为 TLS 1.2 (771)
+// 按规范忽略 GREASE 值 (RFC 8701), 否则同一浏览器每次连接得到不同的结果
+func JA3(hello *tls.ClientHelloInfo) string {
+	version := uint16(tls.VersionTLS12)
+	hasSupportedVersions := false
+	for _, ext := range hello.Extensions {
+		if ext == 43 {
+			hasSupportedVersions = true
+		}
+	}
+	if !hasSupportedVersions && len(hello.SupportedVersions) > 0 {
+		version = hello.SupportedVersions[0]
+	}
+
+	curves := make([]uint16, len(hello.SupportedCurves))
+	for i, c := range hello.SupportedCurves {
+		curves[i] = uint16(c)
+	}
+	points := make([]uint16, len(hello.SupportedPoints))
+	for i, p := range hello.SupportedPoints {
+		points[i] = uint16(p)
+	}
+
+	s := strconv.Itoa(int(version)) + "," + joinJA3(hello.CipherSuites) + "," + joinJA3(hello.Extensions) + "," +
+		joinJA3(curves) + "," + joinJA3(points)
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func joinJA3(values []uint16) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		if isGREASE(v) {
+			continue
+		}
+		parts = append(parts, strconv.Itoa(int(v)))
+	}
+	return strings.Join(parts, "-")
+}
+
+// GREASE 值形如 0x0a0a、0x1a1a ... 0xfafa
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
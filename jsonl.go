@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// lumberjack 轮转出的旧文件名 name-<时间>.ext 中的时间格式
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// JSONLStore 以 JSON Lines 格式追加写入设备信息, 每条记录一行
+// 启用轮转时新记录只写入当前文件, 查询、清理、删除和合并同时作用于轮转出的旧文件 (包括 gzip 压缩的)
+type JSONLStore struct {
+	path   string
+	rotate RotateConfig
+	clock  Clock
+	out    io.WriteCloser
+	mutex  sync.Mutex
+}
+
+// clock 决定按天轮转的时间点
+func NewJSONLStore(path string, rotate RotateConfig, clock Clock) (*JSONLStore, error) {
+	out, err := openLogFile(path, rotate, clock)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLStore{path: path, rotate: rotate, clock: clock, out: out}, nil
+}
+
+// 文件被改写替换后重新打开以继续追加, 调用方需持有锁
+func (jw *JSONLStore) reopen() error {
+	out, err := openLogFile(jw.path, jw.rotate, jw.clock)
+	if err != nil {
+		return err
+	}
+	jw.out.Close()
+	jw.out = out
+	return nil
+}
+
+// 写入一条记录
+// 整行一次性写入且不经过用户态缓冲, 加锁保证并发请求的行不会交错
+func (jw *JSONLStore) Insert(ctx context.Context, info DeviceInfo) error {
+	line, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	jw.mutex.Lock()
+	defer jw.mutex.Unlock()
+	if _, err := jw.out.Write(line); err != nil {
+		// 磁盘已满、超出配额或 I/O 错误可能在清理或恢复后消失
+		if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT) || errors.Is(err, syscall.EIO) {
+			return transientStorageError(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// 检查文件仍在原路径: 被删除或移走后继续追加的数据无法再从路径读到
+// 启用轮转时文件按设计会被替换, 只检查文件存在
+func (jw *JSONLStore) Ping(ctx context.Context) error {
+	jw.mutex.Lock()
+	defer jw.mutex.Unlock()
+
+	current, err := os.Stat(jw.path)
+	if err != nil {
+		return err
+	}
+	f, ok := jw.out.(*os.File)
+	if !ok {
+		return nil
+	}
+	opened, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(opened, current) {
+		return errors.New(jw.path + " 已被替换")
+	}
+	return nil
+}
+
+// 全部数据文件: 轮转出的旧文件按时间从旧到新, 最后是当前文件, 调用方需持有锁
+// 旧文件正在被压缩时同时存在压缩和未压缩的版本, 此时压缩版本尚未写完, 取未压缩的
+func (jw *JSONLStore) files() ([]string, error) {
+	dir, base := filepath.Split(jw.path)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil, err
+	}
+	segments := make(map[string]string) // 时间 -> 文件名
+	for _, e := range entries {
+		plain := strings.TrimSuffix(e.Name(), ".gz")
+		if e.IsDir() || !strings.HasPrefix(plain, prefix) || !strings.HasSuffix(plain, ext) || len(plain) < len(prefix)+len(ext) {
+			continue
+		}
+		stamp := plain[len(prefix) : len(plain)-len(ext)]
+		if _, err := time.Parse(backupTimeFormat, stamp); err != nil {
+			continue
+		}
+		if existing, ok := segments[stamp]; ok && !strings.HasSuffix(existing, ".gz") {
+			continue
+		}
+		segments[stamp] = e.Name()
+	}
+
+	stamps := make([]string, 0, len(segments))
+	for stamp := range segments {
+		stamps = append(stamps, stamp)
+	}
+	sort.Strings(stamps)
+	paths := make([]string, 0, len(stamps)+1)
+	for _, stamp := range stamps {
+		paths = append(paths, filepath.Join(dir, segments[stamp]))
+	}
+	return append(paths, jw.path), nil
+}
+
+// 打开数据文件, .gz 文件解压读取
+func openSegment(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return gzipFile{zr, f}, nil
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g gzipFile) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+// 逐行读取 r, 行内容只在 fn 调用期间有效
+func scanLines(r io.Reader, fn func(line []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 2*maxBodySize)
+	for scanner.Scan() {
+		if err := fn(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// 读取一个数据文件的全部行
+func readSegment(path string) ([][]byte, error) {
+	f, err := openSegment(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines [][]byte
+	err = scanLines(f, func(line []byte) error {
+		lines = append(lines, bytes.Clone(line))
+		return nil
+	})
+	return lines, err
+}
+
+// 以 lines 替换数据文件的内容: 写入临时文件后改名, .gz 文件重新压缩; 当前文件被替换后重新打开以继续追加
+// 调用方需持有锁
+// 旧文件刚轮转出、lumberjack 仍在后台压缩时改写未压缩的版本, 改写结果会被压缩完成后的删除覆盖, 窗口只有压缩所需的时间
+func (jw *JSONLStore) rewriteSegment(path string, lines [][]byte) error {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var zw *gzip.Writer
+	if strings.HasSuffix(path, ".gz") {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+	for _, line := range lines {
+		w.Write(line)
+		w.Write([]byte{'\n'})
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if path == jw.path {
+		return jw.reopen()
+	}
+	return nil
+}
+
+// 读取记录, 按时间从新到旧排列, 无法解析的行跳过
+func (jw *JSONLStore) List(ctx context.Context, limit, offset int) ([]DeviceInfo, error) {
+	records := make([]DeviceInfo, 0)
+	err := jw.Iterate(ctx, "", func(info DeviceInfo) error {
+		records = append(records, info)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 文件按写入顺序追加, 先反转使同一秒内的记录也保持从新到旧
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Timestamp > records[j].Timestamp
+	})
+	return paginate(records, limit, offset), nil
+}
+
+func (jw *JSONLStore) Find(ctx context.Context, filter DeviceFilter, limit, offset int) ([]DeviceInfo, error) {
+	records, err := jw.List(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return findRecords(records, filter, limit, offset), nil
+}
+
+// 在锁内打开全部数据文件并记下当前文件的大小, 之后在锁外逐行读取, 当前文件只读到记下的位置
+// 读取期间文件被改写或轮转不影响已打开的文件, 新追加的记录不会被读到
+func (jw *JSONLStore) Iterate(ctx context.Context, since string, fn func(DeviceInfo) error) error {
+	jw.mutex.Lock()
+	readers, err := jw.openAll()
+	jw.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, r := range readers {
+			r.Close()
+		}
+	}()
+
+	for _, r := range readers {
+		err := scanLines(r, func(line []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var info DeviceInfo
+			if err := json.Unmarshal(line, &info); err != nil {
+				return nil
+			}
+			if since != "" && info.Timestamp < since {
+				return nil
+			}
+			return fn(info)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 打开全部数据文件, 当前文件限制在打开时的大小; 调用方需持有锁
+func (jw *JSONLStore) openAll() ([]io.ReadCloser, error) {
+	paths, err := jw.files()
+	if err != nil {
+		return nil, err
+	}
+	readers := make([]io.ReadCloser, 0, len(paths))
+	closeAll := func() {
+		for _, r := range readers {
+			r.Close()
+		}
+	}
+	for _, path := range paths {
+		if path != jw.path {
+			r, err := openSegment(path)
+			if errors.Is(err, os.ErrNotExist) {
+				// 超出 MaxBackups 的旧文件已被删除
+				continue
+			}
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			readers = append(readers, r)
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		st, err := f.Stat()
+		if err != nil {
+			f.Close()
+			closeAll()
+			return nil, err
+		}
+		readers = append(readers, limitedFile{io.LimitReader(f, st.Size()), f})
+	}
+	return readers, nil
+}
+
+type limitedFile struct {
+	io.Reader
+	io.Closer
+}
+
+func (jw *JSONLStore) Delete(ctx context.Context, deviceID, cookieID string) (int, error) {
+	return jw.Purge(ctx, deviceMatcher(deviceID, cookieID))
+}
+
+// 删除 expired 返回 true 的记录, 返回删除的条数
+// 逐个检查全部数据文件, 有记录被删除的文件改写为保留的行, 无法解析的行保留
+func (jw *JSONLStore) Purge(ctx context.Context, expired func(DeviceInfo) bool) (int, error) {
+	jw.mutex.Lock()
+	defer jw.mutex.Unlock()
+
+	paths, err := jw.files()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, path := range paths {
+		lines, err := readSegment(path)
+		if errors.Is(err, os.ErrNotExist) && path != jw.path {
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		kept := lines[:0]
+		for _, line := range lines {
+			var info DeviceInfo
+			if err := json.Unmarshal(line, &info); err == nil && expired(info) {
+				continue
+			}
+			kept = append(kept, line)
+		}
+		if len(kept) == len(lines) {
+			continue
+		}
+		if err := jw.rewriteSegment(path, kept); err != nil {
+			return removed, err
+		}
+		removed += len(lines) - len(kept)
+	}
+	return removed, nil
+}
+
+// 合并同一 DeviceID 的记录, 跨全部数据文件按写入顺序以最后一条为准; 无法解析的行原样保留
+func (jw *JSONLStore) Compact(ctx context.Context) (int, error) {
+	jw.mutex.Lock()
+	defer jw.mutex.Unlock()
+
+	paths, err := jw.files()
+	if err != nil {
+		return 0, err
+	}
+	type position struct{ file, line int }
+	files := make([][][]byte, len(paths))
+	var records []DeviceInfo
+	var positions []position // records[i] 所在的文件和行号
+	for i, path := range paths {
+		lines, err := readSegment(path)
+		if errors.Is(err, os.ErrNotExist) && path != jw.path {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		for j, line := range lines {
+			var info DeviceInfo
+			if err := json.Unmarshal(line, &info); err == nil {
+				records = append(records, info)
+				positions = append(positions, position{i, j})
+			}
+		}
+		files[i] = lines
+	}
+
+	merged, removed := planCompaction(records)
+	if len(removed) == 0 {
+		return 0, nil
+	}
+	dirty := make(map[int]bool)
+	for i, info := range merged {
+		line, err := json.Marshal(info)
+		if err != nil {
+			return 0, err
+		}
+		p := positions[i]
+		files[p.file][p.line] = line
+		dirty[p.file] = true
+	}
+	for _, i := range removed {
+		p := positions[i]
+		files[p.file][p.line] = nil
+		dirty[p.file] = true
+	}
+
+	for i, path := range paths {
+		if !dirty[i] {
+			continue
+		}
+		kept := files[i][:0]
+		for _, line := range files[i] {
+			if line != nil {
+				kept = append(kept, line)
+			}
+		}
+		if err := jw.rewriteSegment(path, kept); err != nil {
+			return 0, err
+		}
+	}
+	return len(removed), nil
+}
+
+func (jw *JSONLStore) Close() error {
+	jw.mutex.Lock()
+	defer jw.mutex.Unlock()
+	return jw.out.Close()
+}
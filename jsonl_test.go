@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 在 dir 中准备两个轮转出的旧文件 (一个 gzip 压缩) 和当前文件
+func newSegmentedJSONLStore(t *testing.T) (*JSONLStore, string) {
+	t.Helper()
+	dir := t.TempDir()
+	writeSegment := func(name string, compress bool, records ...DeviceInfo) {
+		var buf bytes.Buffer
+		for _, info := range records {
+			line, _ := json.Marshal(info)
+			buf.Write(append(line, '\n'))
+		}
+		data := buf.Bytes()
+		if compress {
+			var zbuf bytes.Buffer
+			zw := gzip.NewWriter(&zbuf)
+			zw.Write(data)
+			zw.Close()
+			data = zbuf.Bytes()
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeSegment("devices-2024-01-01T00-00-00.000.jsonl", false,
+		DeviceInfo{DeviceID: "a", CookieID: "ca", Timestamp: "2024-01-01 10:00:00", VisitCount: 1},
+		DeviceInfo{DeviceID: "b", Timestamp: "2024-01-01 11:00:00"})
+	writeSegment("devices-2024-01-02T00-00-00.000.jsonl.gz", true,
+		DeviceInfo{DeviceID: "a", Timestamp: "2024-01-02 10:00:00", VisitCount: 1},
+		DeviceInfo{DeviceID: "c", Timestamp: "2024-01-02 11:00:00"})
+	// 不属于该存储的文件
+	writeSegment("devices-backup.jsonl", false, DeviceInfo{DeviceID: "x"})
+	writeSegment("other-2024-01-01T00-00-00.000.jsonl", false, DeviceInfo{DeviceID: "x"})
+
+	jw, err := NewJSONLStore(filepath.Join(dir, "devices.jsonl"), RotateConfig{Daily: true}, systemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { jw.Close() })
+	jw.Insert(context.Background(), DeviceInfo{DeviceID: "d", Timestamp: "2024-01-03 10:00:00"})
+	jw.Insert(context.Background(), DeviceInfo{DeviceID: "a", Timestamp: "2024-01-03 11:00:00", VisitCount: 1})
+	return jw, dir
+}
+
+func listIDs(t *testing.T, s Store) []string {
+	t.Helper()
+	records, err := s.List(context.Background(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(records))
+	for i, info := range records {
+		ids[i] = info.DeviceID
+	}
+	return ids
+}
+
+func TestJSONLStoreSegments(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      func(jw *JSONLStore) (int, error)
+		removed int
+		want    []string // 操作后 List 的结果, 从新到旧
+	}{
+		{
+			name:    "read all",
+			op:      func(jw *JSONLStore) (int, error) { return 0, nil },
+			removed: 0,
+			want:    []string{"a", "d", "c", "a", "b", "a"},
+		},
+		{
+			name:    "delete",
+			op:      func(jw *JSONLStore) (int, error) { return jw.Delete(context.Background(), "a", "") },
+			removed: 3,
+			want:    []string{"d", "c", "b"},
+		},
+		{
+			name:    "delete by cookie",
+			op:      func(jw *JSONLStore) (int, error) { return jw.Delete(context.Background(), "c", "ca") },
+			removed: 2,
+			want:    []string{"a", "d", "a", "b"},
+		},
+		{
+			name: "purge",
+			op: func(jw *JSONLStore) (int, error) {
+				return jw.Purge(context.Background(), func(info DeviceInfo) bool { return info.Timestamp < "2024-01-02 11:00:00" })
+			},
+			removed: 3,
+			want:    []string{"a", "d", "c"},
+		},
+		{
+			name:    "compact",
+			op:      func(jw *JSONLStore) (int, error) { return jw.Compact(context.Background()) },
+			removed: 2,
+			want:    []string{"a", "d", "c", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jw, dir := newSegmentedJSONLStore(t)
+			removed, err := tt.op(jw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed != tt.removed {
+				t.Errorf("删除 %d 条, want %d", removed, tt.removed)
+			}
+			if got := listIDs(t, jw); !equalStrings(got, tt.want) {
+				t.Errorf("List = %v, want %v", got, tt.want)
+			}
+
+			// 压缩的旧文件改写后仍是有效的 gzip, 不相关的文件不受影响
+			f, err := os.Open(filepath.Join(dir, "devices-2024-01-02T00-00-00.000.jsonl.gz"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if _, err := gzip.NewReader(f); err != nil {
+				t.Errorf("压缩文件损坏: %v", err)
+			}
+			for _, name := range []string{"devices-backup.jsonl", "other-2024-01-01T00-00-00.000.jsonl"} {
+				data, _ := os.ReadFile(filepath.Join(dir, name))
+				if !bytes.Contains(data, []byte(`"x"`)) {
+					t.Errorf("%s 被改写", name)
+				}
+			}
+
+			// 改写后仍可继续追加
+			if err := jw.Insert(context.Background(), DeviceInfo{DeviceID: "e", Timestamp: "2024-01-04 10:00:00"}); err != nil {
+				t.Fatal(err)
+			}
+			if got := listIDs(t, jw); got[0] != "e" {
+				t.Errorf("追加后 List = %v", got)
+			}
+		})
+	}
+}
+
+func TestJSONLStoreCompactMergesAcrossSegments(t *testing.T) {
+	jw, _ := newSegmentedJSONLStore(t)
+	if _, err := jw.Compact(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	found, err := jw.Find(context.Background(), DeviceFilter{}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, info := range found {
+		if info.DeviceID == "a" && (info.VisitCount != 3 || info.FirstSeen != "2024-01-01 10:00:00") {
+			t.Fatalf("合并结果 visitCount=%d firstSeen=%q", info.VisitCount, info.FirstSeen)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// 持久化的限流状态: 各内存限流器中每个键在窗口内的请求时间
+type rateLimitState struct {
+	SavedAt  time.Time                         `json:"savedAt"`
+	Limiters map[string]map[string][]time.Time `json:"limiters"`
+}
+
+// RATE_LIMIT_STATE 文件路径, 为空时不保存限流状态
+var rateLimitStatePath string
+
+// 保存和删除设备记录时都会重写状态文件
+var rateLimitStateMutex sync.Mutex
+
+// 需要持久化的内存限流器, 名称用作状态文件中的键
+// 配置 REDIS_URL 时计数保存在 Redis 中, 这些限流器只在 Redis 不可用时使用
+func persistentLimiters() map[string]*RateLimiter {
+	return map[string]*RateLimiter{
+		"ip":     rateLimiter,
+		"device": deviceRateLimiter,
+		"read":   readRateLimiter,
+	}
+}
+
+// 以客户端IP为键的限流器
+var ipKeyedLimiters = map[string]bool{"ip": true, "read": true}
+
+// 窗口内的请求时间副本
+func (rl *RateLimiter) Snapshot() map[string][]time.Time {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	now := rl.clock.Now()
+	snapshot := make(map[string][]time.Time, len(rl.requests))
+	for key, requests := range rl.requests {
+		if valid := pruneRequests(requests, now, rl.window); len(valid) > 0 {
+			snapshot[key] = valid
+		}
+	}
+	return snapshot
+}
+
+// 合并保存的请求时间, 丢弃已在窗口之外的记录, 返回恢复的键数
+func (rl *RateLimiter) Restore(saved map[string][]time.Time) int {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	now := rl.clock.Now()
+	restored := 0
+	for key, requests := range saved {
+		valid := pruneRequests(requests, now, rl.window)
+		if len(valid) == 0 {
+			continue
+		}
+		rl.requests[key] = append(valid, rl.requests[key]...)
+		restored++
+	}
+	return restored
+}
+
+// 关闭时保存限流状态: 先写临时文件再替换, 中途退出不会留下损坏的文件
+func saveRateLimitState(path string) error {
+	rateLimitStateMutex.Lock()
+	defer rateLimitStateMutex.Unlock()
+
+	state := rateLimitState{SavedAt: time.Now(), Limiters: make(map[string]map[string][]time.Time)}
+	for name, rl := range persistentLimiters() {
+		// 启用 ANONYMIZE_IP 时不把按IP计数的状态写入磁盘, 重启后这些计数从零开始
+		if anonymizeIP && ipKeyedLimiters[name] {
+			continue
+		}
+		state.Limiters[name] = rl.Snapshot()
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// 启动时恢复限流状态, 需在限流窗口配置完成后调用; 文件不存在时视为首次启动
+func loadRateLimitState(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state rateLimitState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	for name, rl := range persistentLimiters() {
+		if saved := state.Limiters[name]; len(saved) > 0 {
+			restored := rl.Restore(saved)
+			slog.Info("已恢复限流状态", "event", "rate_limit_restored", "limiter", name, "keys", restored,
+				"saved_at", state.SavedAt.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// 从状态文件中删除这些设备ID的限流记录 (删除设备数据时调用); 文件不存在时不做任何事
+// 运行期间文件中是上次关闭时保存的状态, 内存中的记录由各限流器的 Forget 删除
+func eraseRateLimitState(path string, deviceIDs []string) error {
+	rateLimitStateMutex.Lock()
+	defer rateLimitStateMutex.Unlock()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state rateLimitState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	saved := state.Limiters["device"]
+	removed := 0
+	for _, id := range deviceIDs {
+		if _, ok := saved[id]; ok {
+			delete(saved, id)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return nil
+	}
+	if data, err = json.Marshal(state); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
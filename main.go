@@ -1,120 +1,289 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"html/template"
+	"io"
+	"log/slog"
+	"math"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 // Response 统一响应结构体
 type Response struct {
-	Status  string      `json:"status"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
+	XMLName xml.Name    `json:"-" xml:"response"`
+	Status  string      `json:"status" xml:"status"`
+	Code    string      `json:"code,omitempty" xml:"code,omitempty"` // 错误码, 仅错误响应携带, 客户端可据此分支处理
+	Message string      `json:"message" xml:"message"`
+	Data    interface{} `json:"data,omitempty" xml:"data,omitempty"`
 }
 
 // DeviceInfo 结构体定义
 type DeviceInfo struct {
-	Timestamp           string `json:"timestamp"`
-	UserAgent           string `json:"userAgent"`
-	IPAddress           string `json:"ipAddress"`
-	Screen              string `json:"screen"`
-	ColorDepth          string `json:"colorDepth"`
-	Timezone            string `json:"timezone"`
-	Language            string `json:"language"`
-	Platform            string `json:"platform"`
-	CPUCores            string `json:"cpuCores"`
-	DeviceMemory        string `json:"deviceMemory"`
-	Connection          string `json:"connection"`
-	TouchSupport        string `json:"touchSupport"`
-	PixelRatio          string `json:"pixelRatio"`
-	AvailableScreen     string `json:"availableScreen"`
-	CookiesEnabled      string `json:"cookiesEnabled"`
-	JavaEnabled         string `json:"javaEnabled"`
-	DoNotTrack          string `json:"doNotTrack"`
-	HardwareConcurrency string `json:"hardwareConcurrency"`
-	Vendor              string `json:"vendor"`
-	Product             string `json:"product"`
+	Timestamp           string `json:"timestamp" xml:"timestamp"`
+	UserAgent           string `json:"userAgent" xml:"userAgent"`
+	IPAddress           string `json:"ipAddress" xml:"ipAddress"`
+	Screen              string `json:"screen" xml:"screen"`
+	ColorDepth          string `json:"colorDepth" xml:"colorDepth"`
+	Timezone            string `json:"timezone" xml:"timezone"`
+	Language            string `json:"language" xml:"language"`
+	Platform            string `json:"platform" xml:"platform"`
+	CPUCores            string `json:"cpuCores" xml:"cpuCores"`
+	DeviceMemory        string `json:"deviceMemory" xml:"deviceMemory"`
+	Connection          string `json:"connection" xml:"connection"`
+	TouchSupport        string `json:"touchSupport" xml:"touchSupport"`
+	PixelRatio          string `json:"pixelRatio" xml:"pixelRatio"`
+	AvailableScreen     string `json:"availableScreen" xml:"availableScreen"`
+	CookiesEnabled      string `json:"cookiesEnabled" xml:"cookiesEnabled"`
+	JavaEnabled         string `json:"javaEnabled" xml:"javaEnabled"`
+	DoNotTrack          string `json:"doNotTrack" xml:"doNotTrack"`
+	HardwareConcurrency string `json:"hardwareConcurrency" xml:"hardwareConcurrency"`
+	Vendor              string `json:"vendor" xml:"vendor"`
+	Product             string `json:"product" xml:"product"`
 	// 新增字段
-	Battery           string `json:"battery"`
-	OnlineStatus      string `json:"onlineStatus"`
-	MaxTouchPoints    string `json:"maxTouchPoints"`
-	PDFViewer         string `json:"pdfViewer"`
-	WebGL             string `json:"webgl"`
-	Canvas            string `json:"canvas"`
-	AudioContext      string `json:"audioContext"`
-	LocalStorage      string `json:"localStorage"`
-	SessionStorage    string `json:"sessionStorage"`
-	IndexedDB         string `json:"indexedDB"`
-	Geolocation       string `json:"geolocation"`
-	LocationDetails   string `json:"locationDetails"`
-	Notifications     string `json:"notifications"`
-	ServiceWorker     string `json:"serviceWorker"`
-	WebRTC            string `json:"webrtc"`
-	MediaDevices      string `json:"mediaDevices"`
-	DeviceOrientation string `json:"deviceOrientation"`
-	Vibration         string `json:"vibration"`
-	Bluetooth         string `json:"bluetooth"`
-	USB               string `json:"usb"`
-	Clipboard         string `json:"clipboard"`
-	Share             string `json:"share"`
-	PaymentRequest    string `json:"paymentRequest"`
-	Accelerometer     string `json:"accelerometer"`
-	Gyroscope         string `json:"gyroscope"`
-	Magnetometer      string `json:"magnetometer"`
-	GamepadAPI        string `json:"gamepadAPI"`
-	VRDisplay         string `json:"vrDisplay"`
-	WebAssembly       string `json:"webAssembly"`
-	CSSFeatures       string `json:"cssFeatures"`
-	FontList          string `json:"fontList"`
-	Plugins           string `json:"plugins"`
-	MimeTypes         string `json:"mimeTypes"`
-	ViewportSize      string `json:"viewportSize"`
-	DeviceType        string `json:"deviceType"`
-	OSVersion         string `json:"osVersion"`
-	BrowserVersion    string `json:"browserVersion"`
-	ReferrerPolicy    string `json:"referrerPolicy"`
-	HTTPSSupport      string `json:"httpsSupport"`
+	Battery           string `json:"battery" xml:"battery"`
+	OnlineStatus      string `json:"onlineStatus" xml:"onlineStatus"`
+	MaxTouchPoints    string `json:"maxTouchPoints" xml:"maxTouchPoints"`
+	PDFViewer         string `json:"pdfViewer" xml:"pdfViewer"`
+	PDFViewerDetail   string `json:"pdfViewerDetail" xml:"pdfViewerDetail"`
+	WebGL             string `json:"webgl" xml:"webgl"`
+	Canvas            string `json:"canvas" xml:"canvas"`
+	AudioContext      string `json:"audioContext" xml:"audioContext"`
+	LocalStorage      string `json:"localStorage" xml:"localStorage"`
+	SessionStorage    string `json:"sessionStorage" xml:"sessionStorage"`
+	IndexedDB         string `json:"indexedDB" xml:"indexedDB"`
+	Geolocation       string `json:"geolocation" xml:"geolocation"`
+	LocationDetails   string `json:"locationDetails" xml:"locationDetails"`
+	Lat               string `json:"lat" xml:"lat"`
+	Lng               string `json:"lng" xml:"lng"`
+	ResolvedAddress   string `json:"resolvedAddress" xml:"resolvedAddress"`
+	Notifications     string `json:"notifications" xml:"notifications"`
+	ServiceWorker     string `json:"serviceWorker" xml:"serviceWorker"`
+	WebRTC            string `json:"webrtc" xml:"webrtc"`
+	MediaDevices      string `json:"mediaDevices" xml:"mediaDevices"`
+	DeviceOrientation string `json:"deviceOrientation" xml:"deviceOrientation"`
+	Vibration         string `json:"vibration" xml:"vibration"`
+	Bluetooth         string `json:"bluetooth" xml:"bluetooth"`
+	USB               string `json:"usb" xml:"usb"`
+	Serial            string `json:"serial" xml:"serial"`
+	Clipboard         string `json:"clipboard" xml:"clipboard"`
+	Share             string `json:"share" xml:"share"`
+	PaymentRequest    string `json:"paymentRequest" xml:"paymentRequest"`
+	Accelerometer     string `json:"accelerometer" xml:"accelerometer"`
+	Gyroscope         string `json:"gyroscope" xml:"gyroscope"`
+	Magnetometer      string `json:"magnetometer" xml:"magnetometer"`
+	GamepadAPI        string `json:"gamepadAPI" xml:"gamepadAPI"`
+	VRDisplay         string `json:"vrDisplay" xml:"vrDisplay"`
+	WebAssembly       string `json:"webAssembly" xml:"webAssembly"`
+	CSSFeatures       string `json:"cssFeatures" xml:"cssFeatures"`
+	FontList          string `json:"fontList" xml:"fontList"`
+	Plugins           string `json:"plugins" xml:"plugins"`
+	MimeTypes         string `json:"mimeTypes" xml:"mimeTypes"`
+	ViewportSize      string `json:"viewportSize" xml:"viewportSize"`
+	DeviceType        string `json:"deviceType" xml:"deviceType"`
+	OSVersion         string `json:"osVersion" xml:"osVersion"`
+	BrowserVersion    string `json:"browserVersion" xml:"browserVersion"`
+	ReferrerPolicy    string `json:"referrerPolicy" xml:"referrerPolicy"`
+	HTTPSSupport      string `json:"httpsSupport" xml:"httpsSupport"`
 	// Canvas指纹相关
-	CanvasFingerprint string `json:"canvasFingerprint"`
-	WebGLFingerprint  string `json:"webglFingerprint"`
-	FontFingerprint   string `json:"fontFingerprint"`
+	CanvasFingerprint string `json:"canvasFingerprint" xml:"canvasFingerprint"`
+	WebGLFingerprint  string `json:"webglFingerprint" xml:"webglFingerprint"`
+	FontFingerprint   string `json:"fontFingerprint" xml:"fontFingerprint"`
+	AudioFingerprint  string `json:"audioFingerprint" xml:"audioFingerprint"`
+	// 提交请求的请求ID (X-Request-ID), 同时随日志和 Webhook 传递
+	RequestID string `json:"requestId" xml:"requestId"`
+	// 服务端根据各项指纹计算的稳定设备ID
+	DeviceID string `json:"deviceId" xml:"deviceId"`
+	// 合并重复记录后的首次/最近访问时间和访问次数, 未合并的记录为空
+	FirstSeen  string `json:"firstSeen,omitempty" xml:"firstSeen,omitempty"`
+	LastSeen   string `json:"lastSeen,omitempty" xml:"lastSeen,omitempty"`
+	VisitCount int    `json:"visitCount,omitempty" xml:"visitCount,omitempty"`
+	// 指纹在已收集总体中的识别信息量 (比特)
+	UniquenessBits float64 `json:"uniquenessBits" xml:"uniquenessBits"`
+	// 第一方 Cookie 中的设备标识
+	CookieID string `json:"cookieId" xml:"cookieId"`
+	// 显卡信息: 原始 WebGL 字符串及服务端归一化结果
+	WebGLVendor   string `json:"webglVendor" xml:"webglVendor"`
+	WebGLRenderer string `json:"webglRenderer" xml:"webglRenderer"`
+	GPUVendor     string `json:"gpuVendor" xml:"gpuVendor"`
+	GPUModel      string `json:"gpuModel" xml:"gpuModel"`
+	// 由 Screen 和 AvailableScreen 解析出的分辨率, 无法解析时为 0
+	ScreenWidth  int `json:"screenWidth" xml:"screenWidth"`
+	ScreenHeight int `json:"screenHeight" xml:"screenHeight"`
+	AvailWidth   int `json:"availWidth" xml:"availWidth"`
+	AvailHeight  int `json:"availHeight" xml:"availHeight"`
+	// IP 地理位置
+	GeoCountry string `json:"geoCountry" xml:"geoCountry"`
+	GeoCity    string `json:"geoCity" xml:"geoCity"`
+	// IP 所属自治系统, 以及是否属于云服务/托管商
+	ASN          string `json:"asn" xml:"asn"`
+	ASNOrg       string `json:"asnOrg" xml:"asnOrg"`
+	IsDatacenter bool   `json:"isDatacenter" xml:"isDatacenter"`
+	// 时区与IP所在国家是否一致: consistent/suspicious/unknown
+	TimezoneMismatch string `json:"timezoneMismatch" xml:"timezoneMismatch"`
+	// 是否为爬虫或自动化工具
+	IsBot string `json:"isBot" xml:"isBot"`
+	// platform 与 User-Agent 中的操作系统是否一致: ok/mismatch/unknown
+	PlatformConsistent string `json:"platformConsistent" xml:"platformConsistent"`
+	// 请求头中的 User-Agent Client Hints
+	ClientHintUA              string `json:"clientHintUA" xml:"clientHintUA"`
+	ClientHintPlatform        string `json:"clientHintPlatform" xml:"clientHintPlatform"`
+	ClientHintMobile          string `json:"clientHintMobile" xml:"clientHintMobile"`
+	ClientHintPlatformVersion string `json:"clientHintPlatformVersion" xml:"clientHintPlatformVersion"`
+	// 提交连接的 TLS 指纹 (JA3 MD5), 仅直接提供 HTTPS 服务时由服务端计算
+	JA3 string `json:"ja3,omitempty" xml:"ja3,omitempty"`
+	// 提交请求的原始请求头
+	RequestHeaders XMLMap[string] `json:"requestHeaders,omitempty" xml:"requestHeaders,omitempty"`
+	// 指针与悬停能力 (CSS 媒体查询) 及服务端据此判断的设备类型
+	PointerType  string `json:"pointerType" xml:"pointerType"`
+	AnyPointer   string `json:"anyPointer" xml:"anyPointer"`
+	HoverCapable string `json:"hoverCapable" xml:"hoverCapable"`
+	AnyHover     string `json:"anyHover" xml:"anyHover"`
+	DeviceTier   string `json:"deviceTier" xml:"deviceTier"`
+	// 完整语言偏好列表及服务端计算的指纹
+	Languages           []string `json:"languages" xml:"languages"`
+	LanguageFingerprint string   `json:"languageFingerprint" xml:"languageFingerprint"`
+	// 媒体设备数量
+	AudioInputs  string `json:"audioInputs" xml:"audioInputs"`
+	VideoInputs  string `json:"videoInputs" xml:"videoInputs"`
+	AudioOutputs string `json:"audioOutputs" xml:"audioOutputs"`
+	// 数据保留
+	ExpiresAt string `json:"expiresAt,omitempty" xml:"expiresAt,omitempty"`
+	// 已遵循的拒绝跟踪信号 (DNT/Sec-GPC/doNotTrack), 此时数据不保存
+	Respected string `json:"respected,omitempty" xml:"respected,omitempty"`
+	// 按嵌入页面的 disable 参数关闭的探测项, 对应字段不采集也不保存
+	OptedOut []string `json:"optedOut,omitempty" xml:"optedOut,omitempty"`
+	// 本次采集使用的探测级别
+	ProbeProfile string `json:"probeProfile" xml:"probeProfile"`
+	// 服务端补充处理中未成功的环节, 不影响采集结果
+	Warnings []string `json:"warnings,omitempty" xml:"warnings,omitempty"`
+}
+
+// Clock 时间来源, 测试中可替换为可控的假时钟
+type Clock interface {
+	Now() time.Time
+}
+
+// 系统时钟
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+var systemClock Clock = realClock{}
+
+// Limiter 按IP或设备ID限流
+type Limiter interface {
+	Allow(key string) bool
+	RetryAfter(key string) time.Duration
+	// 删除该键的计数 (删除设备数据时调用)
+	Forget(key string) error
 }
 
-// 限流器结构
+// 限流器结构: 每个IP (或设备ID) 在 window 时间内最多 limit 次请求, limit <= 0 表示不限流
 type RateLimiter struct {
 	requests map[string][]time.Time
 	mutex    sync.Mutex
+	clock    Clock
+	limit    int
+	window   time.Duration
 }
 
 var rateLimiter = &RateLimiter{
 	requests: make(map[string][]time.Time),
+	clock:    systemClock,
+	limit:    30,
+	window:   time.Minute,
 }
 
-// 检查是否允许请求 (每分钟最多30次)
+// 请求使用的限流器, 配置 REDIS_URL 时为 RedisLimiter
+var requestLimiter Limiter = rateLimiter
+
+// 按设备ID限流 (DEVICE_RATE_LIMIT 环境变量), 默认不启用
+// 运营商级 NAT 后的正常用户共用一个IP, 轮换IP的攻击者则能绕过IP限流
+var deviceRateLimiter = &RateLimiter{
+	requests: make(map[string][]time.Time),
+	clock:    systemClock,
+	window:   time.Minute,
+}
+
+var deviceLimiter Limiter = deviceRateLimiter
+
+// 读取和管理接口的限流 (READ_RATE_LIMIT 环境变量), 与提交分开计数, 仪表盘轮询不会占用提交配额
+var readRateLimiter = &RateLimiter{
+	requests: make(map[string][]time.Time),
+	clock:    systemClock,
+	limit:    300,
+	window:   time.Minute,
+}
+
+var readLimiter Limiter = readRateLimiter
+
+// 数据保留时长 (RETENTION 环境变量, 0 表示永久保留)
+var retention time.Duration
+
+// 前端探测级别 (PROBE_PROFILE 环境变量)
+// minimal: 仅基础检测, 不触发权限弹窗, 不生成指纹
+// standard: 默认检测集合
+// full: 额外检测蓝牙/USB/串口等可能弹窗或输出控制台错误的API
+var probeProfile = "standard"
+
+var probeProfiles = map[string]bool{"minimal": true, "standard": true, "full": true}
+
+// 是否在响应中返回 warnings (VERBOSE_RESPONSE 环境变量)
+var verboseResponse bool
+
+// 是否允许 GET + X-HTTP-Method-Override 提交 (METHOD_OVERRIDE 环境变量)
+var allowMethodOverride bool
+
+// 响应签名密钥 (RESPONSE_SIGNING_KEY 环境变量, 为空时不签名)
+var responseSigningKey []byte
+
+// 请求签名密钥 (SIGNING_SECRET 环境变量, 为空时不校验)
+// 只发给受信任的非浏览器客户端; 下发到页面中的密钥任何人都能读到, 签名也就失去意义
+var signingSecret []byte
+
+// 优雅关闭时等待处理中请求的最长时间
+const shutdownTimeout = 15 * time.Second
+
+// 提交数据大小上限
+const maxBodySize = 1 << 20
+
+// 检查是否允许请求
 func (rl *RateLimiter) Allow(ip string) bool {
+	if rl.limit <= 0 {
+		return true
+	}
+
 	rl.mutex.Lock()
 	defer rl.mutex.Unlock()
 
-	now := time.Now()
-	requests := rl.requests[ip]
+	now := rl.clock.Now()
+	validRequests := pruneRequests(rl.requests[ip], now, rl.window)
 
-	// 清理1分钟前的请求
-	validRequests := make([]time.Time, 0)
-	for _, req := range requests {
-		if now.Sub(req) < time.Minute {
-			validRequests = append(validRequests, req)
-		}
-	}
-
-	if len(validRequests) >= 30 {
+	if len(validRequests) >= rl.limit {
 		return false
 	}
 
@@ -123,940 +292,995 @@ func (rl *RateLimiter) Allow(ip string) bool {
 	return true
 }
 
-// 获取客户端真实IP
-func getClientIP(r *http.Request) string {
-	if ip := r.Header.Get("X-Forwarded-For"); ip != "" {
-		return strings.Split(ip, ",")[0]
+// 距离该IP下一次被允许请求还需等待的时间, 当前已允许时返回 0
+func (rl *RateLimiter) RetryAfter(ip string) time.Duration {
+	if rl.limit <= 0 {
+		return 0
 	}
-	if ip := r.Header.Get("X-Real-IP"); ip != "" {
-		return ip
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	now := rl.clock.Now()
+	validRequests := pruneRequests(rl.requests[ip], now, rl.window)
+	if len(validRequests) < rl.limit {
+		return 0
 	}
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
+	// 窗口内请求数降到 limit 以下时即可再次请求
+	return validRequests[len(validRequests)-rl.limit].Add(rl.window).Sub(now)
+}
+
+func (rl *RateLimiter) Forget(key string) error {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	delete(rl.requests, key)
+	return nil
+}
+
+// 清理窗口之外的请求
+func pruneRequests(requests []time.Time, now time.Time, window time.Duration) []time.Time {
+	validRequests := make([]time.Time, 0, len(requests))
+	for _, req := range requests {
+		if now.Sub(req) < window {
+			validRequests = append(validRequests, req)
+		}
 	}
-	return host
+	return validRequests
+}
+
+// 清理所有IP的过期记录, 删除已无有效请求的IP
+func (rl *RateLimiter) Sweep() {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	now := rl.clock.Now()
+	for ip, requests := range rl.requests {
+		if valid := pruneRequests(requests, now, rl.window); len(valid) > 0 {
+			rl.requests[ip] = valid
+		} else {
+			delete(rl.requests, ip)
+		}
+	}
+}
+
+// 限流记录清理间隔
+var rateLimitSweepInterval = time.Minute
+
+// 启动后台清理, 防止只访问一次的IP永久占用内存
+func (rl *RateLimiter) StartSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			rl.Sweep()
+		}
+	}()
 }
 
-// 发送JSON响应
-func sendJSONResponse(w http.ResponseWriter, status int, response Response) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+// 发送响应, 按 Accept 头编码为 JSON (默认) 或 XML
+func sendResponse(w http.ResponseWriter, r *http.Request, status int, response Response) {
+	encode, contentType := json.Marshal, "application/json"
+	if prefersXML(r.Header.Get("Accept")) {
+		encode, contentType = marshalXML, "application/xml; charset=utf-8"
+	}
+
+	body, err := encode(response)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "响应编码失败", "event", "encode_error", "error", err)
+		status = http.StatusInternalServerError
+		body, _ = encode(Response{Status: "error", Code: "internal_error", Message: "响应编码失败"})
+	}
+	body = append(body, '\n')
+
+	// 响应签名: 对实际发送的响应体字节计算 HMAC-SHA256, 十六进制小写
+	if len(responseSigningKey) > 0 {
+		mac := hmac.New(sha256.New, responseSigningKey)
+		mac.Write(body)
+		w.Header().Set("X-Response-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
 	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(response)
+	w.Write(body)
 }
 
 // 处理设备信息提交
 func collectHandler(w http.ResponseWriter, r *http.Request) {
-	// CORS预检请求
-	if r.Method == "OPTIONS" {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		w.WriteHeader(http.StatusOK)
-		return
+	start := time.Now()
+
+	// 方法覆盖: 只能发 GET 的客户端通过 payload 查询参数或 X-Payload 头携带数据
+	method := r.Method
+	var body io.Reader = r.Body
+	if allowMethodOverride && r.Method == "GET" && strings.EqualFold(r.Header.Get("X-HTTP-Method-Override"), "POST") {
+		payload := r.URL.Query().Get("payload")
+		if payload == "" {
+			payload = r.Header.Get("X-Payload")
+		}
+		method = "POST"
+		body = strings.NewReader(payload)
 	}
 
-	if r.Method != "POST" {
-		fmt.Printf("错误: 收到非POST请求, 方法: %s\n", r.Method)
-		sendJSONResponse(w, http.StatusMethodNotAllowed, Response{
+	if method != "POST" {
+		slog.WarnContext(r.Context(), "收到非POST请求", "event", "method_not_allowed", "method", r.Method,
+			"status", http.StatusMethodNotAllowed)
+		sendResponse(w, r, http.StatusMethodNotAllowed, Response{
 			Status:  "error",
+			Code:    "method_not_allowed",
 			Message: "Only POST method is allowed",
 		})
 		return
 	}
 
-	// 限流检查
 	ip := getClientIP(r)
-	if !rateLimiter.Allow(ip) {
-		fmt.Printf("限流: IP %s 请求过于频繁\n", ip)
-		sendJSONResponse(w, http.StatusTooManyRequests, Response{
-			Status:  "error",
-			Message: "请求过于频繁，请稍后再试",
-		})
-		return
-	}
+	dryRun := isDryRun(r)
 
-	// 打印请求头信息用于调试
-	fmt.Printf("收到请求 - IP: %s, Content-Type: %s, Content-Length: %s\n",
-		ip, r.Header.Get("Content-Type"), r.Header.Get("Content-Length"))
+	// 请求头信息用于调试
+	slog.DebugContext(r.Context(), "收到请求", "event", "request", "ip", ip,
+		"content_type", r.Header.Get("Content-Type"), "content_length", r.Header.Get("Content-Length"))
 
+	// 先读出原始数据, 解析失败时可原样写入死信
+	_, span := tracer.Start(r.Context(), "decode")
+	raw, err := readBody(w, r, body)
+	if err == nil && !verifySignature(w, r, ip, raw) {
+		span.End()
+		return
+	}
 	var info DeviceInfo
-	err := json.NewDecoder(r.Body).Decode(&info)
+	if err == nil {
+		err = json.NewDecoder(bytes.NewReader(raw)).Decode(&info)
+	}
+	span.End()
 	if err != nil {
-		fmt.Printf("JSON解析错误: %v\n", err)
-		sendJSONResponse(w, http.StatusBadRequest, Response{
+		slog.WarnContext(r.Context(), "JSON解析错误", "event", "bad_json", "ip", ip, "error", err, "status", http.StatusBadRequest)
+		if !dryRun {
+			recordDeadLetter(r, ip, raw, "Invalid JSON format: "+err.Error())
+		}
+		sendResponse(w, r, http.StatusBadRequest, Response{
 			Status:  "error",
+			Code:    "bad_json",
 			Message: "Invalid JSON format: " + err.Error(),
 		})
 		return
 	}
+	info.Sanitize()
+	info.ApplyOptOut(r.URL.Query().Get("disable"))
+	if err := info.Validate(); err != nil {
+		slog.WarnContext(r.Context(), "设备信息不完整", "event", "invalid_device", "ip", ip, "error", err, "status", http.StatusBadRequest)
+		if !dryRun {
+			recordDeadLetter(r, ip, raw, "设备信息不完整: "+err.Error())
+		}
+		sendResponse(w, r, http.StatusBadRequest, Response{
+			Status:  "error",
+			Code:    "invalid_device",
+			Message: "设备信息不完整: " + err.Error(),
+		})
+		return
+	}
 
-	// 设置时间戳和IP地址
-	info.Timestamp = time.Now().Format("2006-01-02 15:04:05")
-	info.IPAddress = ip
+	// IP 限流之外再按设备ID限流, 两者都通过才处理
+	deviceID := ComputeDeviceID(info)
+	if !checkDeviceRateLimit(w, r, ip, deviceID) {
+		return
+	}
+	if dryRun {
+		dryRunSubmission(w, r, ip, &info, start)
+		return
+	}
+	checkFingerprintRotation(r, ip, deviceID)
+
+	// 同一 Idempotency-Key 的重复提交直接返回首次结果
+	finish, ok := idempotencyGuard(w, r, raw)
+	if !ok {
+		return
+	}
+	var result *DeviceInfo
+	defer func() { finish(result) }()
 
-	// 控制台输出
-	fmt.Printf("收集到设备信息 [%s] IP: %s, UserAgent: %s\n",
-		info.Timestamp, info.IPAddress, info.UserAgent)
+	// 同时到达的相同提交只处理一次; 跟随的请求沿用首个请求的结果, 设备 Cookie 和请求ID各自保留
+	leader := false
+	v, err, _ := submissionGroup.Do(submissionKey(r, ip, deviceID, raw), func() (interface{}, error) {
+		leader = true
+		err := processSubmission(w, r, ip, &info)
+		return info, err
+	})
+	if err != nil {
+		// 未保存成功: 幂等 key 不记住结果, 客户端可按 Retry-After 重试
+		sendStorageError(w, r, err, nil)
+		return
+	}
+	if !leader {
+		info = v.(DeviceInfo)
+		info.RequestID = RequestID(r.Context())
+		if info.Respected == "" {
+			info.CookieID = deviceCookie(w, r)
+		}
+		slog.InfoContext(r.Context(), "合并同时到达的相同提交", "event", "submission_shared", "ip", ip, "device_id", info.DeviceID)
+	}
+	slog.InfoContext(r.Context(), "收集到设备信息", "event", "collected", "ip", info.IPAddress, "user_agent", info.UserAgent,
+		"status", http.StatusOK, "latency_ms", latencyMs(start))
 
 	// 返回成功响应
-	sendJSONResponse(w, http.StatusOK, Response{
+	result = &info
+	sendResponse(w, r, http.StatusOK, Response{
 		Status:  "success",
 		Message: "设备信息收集成功",
-		Data:    info,
+		Data:    responseData(info),
+	})
+}
+
+// 补充处理并保存一条提交, 包括依赖提交请求本身的请求头、爬虫判断和设备 Cookie; 返回保存时的错误
+func processSubmission(w http.ResponseWriter, r *http.Request, ip string, info *DeviceInfo) error {
+	enrichSubmission(r, ip, info)
+
+	// 客户端拒绝跟踪时不下发设备 Cookie, 也不保存数据; 开启 DROP_BOTS 时爬虫提交不落盘
+	if info.Respected == "" {
+		info.CookieID = deviceCookie(w, r)
+		if !(info.IsBot == "是" && dropBots) {
+			return storeDeviceInfo(r.Context(), *info)
+		}
+	}
+	return nil
+}
+
+// 补充服务端计算的字段, 以及依赖提交请求本身的请求头、Client Hints、爬虫判断和拒绝跟踪信号
+func enrichSubmission(r *http.Request, ip string, info *DeviceInfo) {
+	now := systemClock.Now()
+	enrichDeviceInfo(info, r, ip, now)
+
+	// 请求头和 Client Hints 来自提交请求本身, 批量提交时不适用
+	info.RequestHeaders = recordHeaders(r.Header)
+	info.JA3 = requestJA3(r)
+	info.ClientHintUA = r.Header.Get("Sec-CH-UA")
+	info.ClientHintPlatform = strings.Trim(r.Header.Get("Sec-CH-UA-Platform"), `"`)
+	info.ClientHintMobile = r.Header.Get("Sec-CH-UA-Mobile")
+	info.ClientHintPlatformVersion = strings.Trim(r.Header.Get("Sec-CH-UA-Platform-Version"), `"`)
+	info.PlatformConsistent = checkPlatformConsistency(info.Platform, r.UserAgent())
+
+	// 请求头中的 User-Agent 命中同样视为爬虫
+	bot := info.IsBot == "是" || IsBot(r.UserAgent())
+	if bot {
+		info.IsBot = "是"
+	}
+	info.Respected = optOutSignal(r, *info)
+}
+
+// 按路由分组的IP限流, 超出限制时返回 429; 白名单地址和 CORS 预检请求不计数
+// 首页和健康检查不套用此中间件, 不受限流影响
+func rateLimitMiddleware(limiter Limiter) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "OPTIONS" || allowlisted(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ip := getClientIP(r)
+			if !limiter.Allow(ip) {
+				slog.WarnContext(r.Context(), "请求过于频繁", "event", "rate_limited", "ip", ip, "path", r.URL.Path,
+					"status", http.StatusTooManyRequests)
+				sendRateLimited(w, r, limiter.RetryAfter(ip))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// 按设备ID限流, 超出限制时写入 429 响应并返回 false; 白名单地址同样不限流
+func checkDeviceRateLimit(w http.ResponseWriter, r *http.Request, ip, deviceID string) bool {
+	if allowlisted(r) || deviceLimiter.Allow(deviceID) {
+		return true
+	}
+	slog.WarnContext(r.Context(), "同一设备请求过于频繁", "event", "device_rate_limited", "ip", ip, "device_id", deviceID,
+		"status", http.StatusTooManyRequests)
+	sendRateLimited(w, r, deviceLimiter.RetryAfter(deviceID))
+	return false
+}
+
+// 写入 429 响应
+func sendRateLimited(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfter)))
+	sendResponse(w, r, http.StatusTooManyRequests, Response{
+		Status:  "error",
+		Code:    "rate_limited",
+		Message: "请求过于频繁，请稍后再试",
+	})
+}
+
+// Retry-After 的秒数, 向上取整且至少为 1 秒
+func retryAfterSeconds(d time.Duration) int {
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+// 服务端补充处理: 时间戳、IP、地理位置、指纹归一化等
+func enrichDeviceInfo(info *DeviceInfo, r *http.Request, ip string, now time.Time) {
+	ctx, span := tracer.Start(r.Context(), "enrich")
+	defer span.End()
+
+	// 设置时间戳和IP地址
+	info.Timestamp = now.Format("2006-01-02 15:04:05")
+	info.IPAddress = ip
+	info.RequestID = RequestID(r.Context())
+
+	// 直接以 TLS 提供服务时以服务端实际协议为准
+	if r.TLS != nil {
+		info.HTTPSSupport = "支持"
+	}
+	// JA3 只能由服务端从握手中计算, 丢弃客户端提交的值
+	info.JA3 = ""
+
+	// IP 地理位置, 未配置数据库时留空
+	if geoResolver != nil {
+		_, geoSpan := tracer.Start(ctx, "geoip")
+		country, city, err := geoResolver.Lookup(ip)
+		geoSpan.End()
+		if err != nil {
+			info.Warnings = append(info.Warnings, "geo: 查询失败: "+err.Error())
+		}
+		info.GeoCountry, info.GeoCity = country, city
+	}
+	if asnResolver != nil {
+		asn, org, datacenter, err := asnResolver.Lookup(ip)
+		if err != nil {
+			info.Warnings = append(info.Warnings, "asn: 查询失败: "+err.Error())
+		}
+		info.ASN, info.ASNOrg, info.IsDatacenter = asn, org, datacenter
+	}
+	info.TimezoneMismatch = checkTimezoneMismatch(info.Timezone, info.GeoCountry)
+
+	// 服务端反向地理编码, 外部服务不可用时只记录警告; 内存压力下跳过
+	if geocoder != nil && info.Lat != "" && info.Lng != "" {
+		if degraded.Load() {
+			info.Warnings = append(info.Warnings, "geocode: 内存压力降级, 跳过反向地理编码")
+		} else {
+			_, geoSpan := tracer.Start(ctx, "geocode")
+			address, err := geocoder.Reverse(info.Lat, info.Lng)
+			geoSpan.End()
+			if err != nil {
+				info.Warnings = append(info.Warnings, "geocode: "+err.Error())
+			} else {
+				info.ResolvedAddress = address
+			}
+		}
+	}
+
+	// 地理位置查询使用完整IP, 之后再脱敏; 限流仍使用内存中的完整IP
+	info.IPAddress = persistedIP(ip)
+
+	// 客户端上报的 User-Agent 命中爬虫特征
+	info.IsBot = "否"
+	if info.UserAgent != "" && IsBot(info.UserAgent) {
+		info.IsBot = "是"
+	}
+
+	// 记录实际使用的探测级别, 客户端上报的值无效时以服务端配置为准
+	if !probeProfiles[info.ProbeProfile] {
+		if info.ProbeProfile != "" {
+			info.Warnings = append(info.Warnings, "probeProfile: 客户端上报值无效, 已使用服务端配置")
+		}
+		info.ProbeProfile = probeProfile
+	}
+
+	info.DeviceTier = classifyDeviceTier(*info)
+	info.ScreenWidth, info.ScreenHeight = parseDimensions(info.Screen)
+	info.AvailWidth, info.AvailHeight = parseDimensions(info.AvailableScreen)
+
+	// 语言偏好指纹: 保留顺序, 顺序不同视为不同指纹
+	if len(info.Languages) > 0 {
+		info.LanguageFingerprint = languageFingerprint(info.Languages)
+	}
+
+	// 归一化显卡型号, 原始字符串保留在记录中; 内存压力下跳过
+	if info.WebGLRenderer != "" && degraded.Load() {
+		info.Warnings = append(info.Warnings, "gpu: 内存压力降级, 跳过显卡归一化")
+	} else if info.WebGLRenderer != "" {
+		vendor, model, ok := normalizeGPU(info.WebGLVendor, info.WebGLRenderer)
+		info.GPUVendor, info.GPUModel = vendor, model
+		if !ok {
+			info.Warnings = append(info.Warnings, "gpu: 未匹配到显卡归一化规则")
+		}
+	}
+
+	info.DeviceID = ComputeDeviceID(*info)
+	if cachesShed.Load() {
+		info.Warnings = append(info.Warnings, "uniqueness: 内存压力降级, 跳过唯一性评估")
+	} else {
+		info.UniquenessBits = fingerprintPopulation.UniquenessBits(*info)
+	}
+
+	// 按当前保留策略计算过期时间, 随记录保存并告知客户端
+	if retention > 0 {
+		info.ExpiresAt = now.Add(retention).Format("2006-01-02 15:04:05")
+	}
+}
+
+// 保存记录并更新访问统计、独立设备估算、推送事件和 Webhook; 保存失败时返回错误, 不计入统计也不推送
+func storeDeviceInfo(ctx context.Context, info DeviceInfo) error {
+	// 保存不随请求取消而中断, 但保留链路上下文
+	ctx = context.WithoutCancel(ctx)
+	if store != nil {
+		ctx, span := tracer.Start(ctx, "store")
+		err := insertRecord(ctx, info)
+		span.End()
+		if err != nil {
+			slog.Error("保存设备信息失败", "event", "storage_error", "ip", info.IPAddress, "request_id", info.RequestID,
+				"retryable", errors.Is(err, ErrStorageUnavailable), "error", err)
+			return err
+		}
+	}
+	countRecord(info)
+	uniqueVisitors.Add(info.DeviceID)
+	eventHub.Publish(info)
+	if webhook != nil {
+		_, span := tracer.Start(ctx, "webhook")
+		webhook.Enqueue(info)
+		span.End()
+	}
+	return nil
+}
+
+// 将已保存的记录计入访问统计和指纹总体; 降级清空这些缓存期间不计入, 恢复后从存储重建
+func countRecord(info DeviceInfo) {
+	if cachesShed.Load() {
+		return
+	}
+	deviceStats.Record(info.DeviceID, info.Timestamp)
+	fingerprintPopulation.Add(info)
+}
+
+// 判断设备类型: 优先依据指针与悬停能力, 缺失时退回 UA 判断
+func classifyDeviceTier(info DeviceInfo) string {
+	ua := strings.ToLower(info.UserAgent)
+	tablet := strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")) ||
+		// iPadOS 的 Safari 默认伪装成 macOS
+		(strings.Contains(ua, "macintosh") && info.MaxTouchPoints != "" && info.MaxTouchPoints != "0")
+
+	switch {
+	case info.PointerType == "coarse" && info.HoverCapable == "不支持":
+		if tablet {
+			return "平板设备"
+		}
+		return "移动设备"
+	case info.PointerType == "fine" && info.HoverCapable == "支持":
+		// 带触控板/键盘的平板也会报告精确指针
+		if tablet && strings.Contains(info.AnyPointer, "coarse") {
+			return "平板设备"
+		}
+		return "桌面设备"
+	case tablet:
+		return "平板设备"
+	case strings.Contains(ua, "mobile") || strings.Contains(ua, "iphone") || strings.Contains(ua, "phone"):
+		return "移动设备"
+	case ua == "":
+		return "未知"
+	}
+	return "桌面设备"
+}
+
+// 解析 "1920 x 1080" 形式的尺寸, 分隔符两侧空格可有可无; 格式不符时返回 0, 0
+func parseDimensions(s string) (width, height int) {
+	w, h, ok := strings.Cut(strings.ToLower(s), "x")
+	if !ok {
+		return 0, 0
+	}
+	width, err1 := strconv.Atoi(strings.TrimSpace(w))
+	height, err2 := strconv.Atoi(strings.TrimSpace(h))
+	if err1 != nil || err2 != nil || width <= 0 || height <= 0 {
+		return 0, 0
+	}
+	return width, height
+}
+
+// 对有序语言列表求哈希
+func languageFingerprint(languages []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(languages, ",")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// 计算稳定的设备ID
+// 只使用跨访问不变的指纹和硬件特征, 不包含时间戳、IP 等易变字段
+func ComputeDeviceID(info DeviceInfo) string {
+	parts := []string{
+		info.CanvasFingerprint,
+		info.WebGLFingerprint,
+		info.FontFingerprint,
+		info.AudioFingerprint,
+		info.Screen,
+		info.Platform,
+		info.Timezone,
+		info.HardwareConcurrency,
+	}
+	for i, p := range parts {
+		parts[i] = strings.TrimSpace(p)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	return hex.EncodeToString(sum[:])
+}
+
+// 校验 X-Signature 请求签名 (原始请求体的 HMAC-SHA256, 十六进制)
+// 未配置 SIGNING_SECRET 时直接通过; 校验失败时写入死信和 401 响应并返回 false
+func verifySignature(w http.ResponseWriter, r *http.Request, ip string, raw []byte) bool {
+	if len(signingSecret) == 0 {
+		return true
+	}
+
+	mac := hmac.New(sha256.New, signingSecret)
+	mac.Write(raw)
+	expected := mac.Sum(nil)
+
+	got, err := hex.DecodeString(strings.TrimPrefix(r.Header.Get("X-Signature"), "sha256="))
+	if err == nil && hmac.Equal(got, expected) {
+		return true
+	}
+
+	slog.WarnContext(r.Context(), "请求签名无效", "event", "bad_signature", "ip", ip, "status", http.StatusUnauthorized)
+	if !isDryRun(r) {
+		recordDeadLetter(r, ip, raw, "请求签名无效")
+	}
+	sendResponse(w, r, http.StatusUnauthorized, Response{
+		Status:  "error",
+		Code:    "bad_signature",
+		Message: "请求签名无效",
+	})
+	return false
+}
+
+// 读取提交数据, 支持 Content-Encoding: gzip, 解压后的数据同样受大小上限约束
+func readBody(w http.ResponseWriter, r *http.Request, body io.Reader) ([]byte, error) {
+	body = http.MaxBytesReader(w, io.NopCloser(body), maxBodySize)
+	if r.Method == "POST" && strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		defer gz.Close()
+		body = io.LimitReader(gz, maxBodySize+1)
+	}
+
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > maxBodySize {
+		return nil, errors.New("request body too large")
+	}
+	return raw, nil
+}
+
+// 记录被拒绝的提交 (未启用死信存储时忽略)
+func recordDeadLetter(r *http.Request, ip string, raw []byte, reason string) {
+	if deadLetters == nil {
+		return
+	}
+	err := deadLetters.Add(DeadLetter{
+		Timestamp:   systemClock.Now().Format("2006-01-02 15:04:05"),
+		IPAddress:   persistedIP(ip),
+		UserAgent:   r.UserAgent(),
+		ContentType: r.Header.Get("Content-Type"),
+		Reason:      reason,
+		Payload:     string(raw),
 	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "写入死信失败", "event", "deadletter_error", "ip", ip, "error", err)
+	}
+}
+
+// 请求耗时 (毫秒)
+func latencyMs(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
+
+// 记录错误并退出
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// 返回给客户端的数据, 非详细模式下隐藏 warnings
+func responseData(info DeviceInfo) DeviceInfo {
+	if !verboseResponse {
+		info.Warnings = nil
+	}
+	return info
+}
+
+// newMux 注册所有路由, 首页精确匹配 "/", 其余未注册路径返回 JSON 404
+func newMux(cfg Config) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/{$}", indexHandler)
+	// 提交和读取接口分组限流, 首页、健康检查和 pprof 不限流
+	collectLimit, readLimit := rateLimitMiddleware(requestLimiter), rateLimitMiddleware(readLimiter)
+	mux.Handle("/collect", collectLimit(timeoutHandler(http.HandlerFunc(collectHandler), time.Duration(cfg.RequestTimeout))))
+	mux.Handle("/collect/batch", collectLimit(timeoutHandler(http.HandlerFunc(batchCollectHandler), time.Duration(cfg.RequestTimeout))))
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", readyzHandler)
+	// 读取和管理接口暴露已收集的指纹, 需要 API 密钥, 未配置密钥时停用; 汇总统计可通过 PUBLIC_STATS 公开
+	mux.Handle("/devices", readLimit(requireAPIKey(http.HandlerFunc(devicesHandler))))
+	mux.Handle("/devices.csv", readLimit(requireAPIKey(http.HandlerFunc(devicesCSVHandler))))
+	mux.Handle("/devices.ndjson", readLimit(requireAPIKey(http.HandlerFunc(devicesNDJSONHandler))))
+	mux.Handle("/devices/{id}", readLimit(requireAPIKey(http.HandlerFunc(eraseDeviceHandler))))
+	mux.Handle("/devices/{id}/stats", readLimit(requireAPIKey(http.HandlerFunc(deviceStatsHandler))))
+	mux.Handle("/devices/similar", readLimit(requireAPIKey(http.HandlerFunc(similarDevicesHandler))))
+	mux.Handle("/devices/compact", readLimit(requireAPIKey(http.HandlerFunc(compactHandler))))
+	mux.Handle("/stats", readLimit(requireStatsAuth(http.HandlerFunc(statsHandler))))
+	mux.Handle("/stats/unique", readLimit(requireStatsAuth(http.HandlerFunc(uniqueVisitorsHandler))))
+	mux.Handle("/stats/timeseries", readLimit(requireStatsAuth(http.HandlerFunc(timeSeriesHandler))))
+	mux.Handle("/stats/gpu", readLimit(requireStatsAuth(http.HandlerFunc(gpuStatsHandler))))
+	mux.Handle("/stats/anonymity", readLimit(requireStatsAuth(http.HandlerFunc(anonymityHandler))))
+	mux.Handle("/export/anon", readLimit(requireAPIKey(http.HandlerFunc(anonExportHandler))))
+	mux.Handle("/events", readLimit(requireAPIKey(http.HandlerFunc(eventsHandler))))
+	mux.Handle("/admin", readLimit(requireAdminAuth(http.HandlerFunc(adminHandler))))
+	mux.Handle("/admin/deadletter", readLimit(requireAPIKey(http.HandlerFunc(deadLetterHandler))))
+	mux.Handle("/admin/fingerprints", readLimit(requireAPIKey(http.HandlerFunc(fingerprintMonitorHandler))))
+	mux.Handle("/webhook/replay", readLimit(requireAPIKey(http.HandlerFunc(webhookReplayHandler))))
+	mux.Handle("/import", readLimit(requireAPIKey(http.HandlerFunc(importHandler))))
+	mux.Handle("/debug/config", readLimit(requireAPIKey(http.HandlerFunc(debugConfigHandler))))
+	if cfg.EnablePprof {
+		registerPprof(mux)
+	}
+	// 其余路径统一返回 JSON 404, 不再落到首页
+	mux.HandleFunc("/", notFoundHandler)
+	return mux
+}
+
+// newHandler 在路由外套上中间件
+func newHandler(mux *http.ServeMux, cfg Config) http.Handler {
+	handler := Chain(mux, tracingMiddleware(mux), accessLogMiddleware, requestIDMiddleware, recoverMiddleware, securityHeadersMiddleware, corsMiddleware, ipFilterMiddleware)
+	// 服务网格内部以 h2c 通信时, 明文连接上也接受直接发起的 HTTP/2 (prior knowledge), HTTP/1.1 不受影响
+	if cfg.EnableH2C {
+		handler = h2c.NewHandler(handler, &http2.Server{IdleTimeout: time.Duration(cfg.IdleTimeout)})
+	}
+	return handler
 }
 
 // 提供前端页面
 func indexHandler(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path != "/" {
-		http.NotFound(w, r)
+	if r.Method != "GET" && r.Method != "HEAD" {
+		sendResponse(w, r, http.StatusMethodNotAllowed, Response{
+			Status:  "error",
+			Code:    "method_not_allowed",
+			Message: "Only GET method is allowed",
+		})
 		return
 	}
 
-	html := `<!DOCTYPE html>
-<html lang="zh-CN">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>设备信息收集</title>
-    <style>
-        * { margin: 0; padding: 0; box-sizing: border-box; }
-        body {
-            font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
-            line-height: 1.6; color: #333;
-            background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
-            min-height: 100vh; padding: 20px;
-        }
-        .container { max-width: 1200px; margin: 0 auto; }
-        .header { text-align: center; margin-bottom: 30px; color: white; }
-        .header h1 { font-size: 2.5rem; margin-bottom: 10px; text-shadow: 2px 2px 4px rgba(0,0,0,0.3); }
-        .info-grid { display: grid; grid-template-columns: repeat(auto-fit, minmax(350px, 1fr)); gap: 20px; margin-bottom: 30px; }
-        .info-card {
-            background: white; border-radius: 15px; padding: 25px;
-            box-shadow: 0 10px 30px rgba(0,0,0,0.2);
-            transition: transform 0.3s ease, box-shadow 0.3s ease;
-        }
-        .info-card:hover { transform: translateY(-5px); box-shadow: 0 15px 40px rgba(0,0,0,0.3); }
-        .info-card h3 {
-            color: #4a5568; border-bottom: 2px solid #e2e8f0; padding-bottom: 10px;
-            margin-bottom: 15px; display: flex; align-items: center; gap: 10px;
-        }
-        .info-item {
-            display: flex; justify-content: space-between; align-items: center;
-            padding: 8px 0; border-bottom: 1px solid #f7fafc;
-        }
-        .info-item:last-child { border-bottom: none; }
-        .info-label { font-weight: 600; color: #4a5568; flex-shrink: 0; }
-        .info-value { color: #2d3748; text-align: right; word-break: break-all; flex: 1; margin-left: 15px; }
-        .status {
-            text-align: center; padding: 20px; background: white; border-radius: 15px;
-            box-shadow: 0 10px 30px rgba(0,0,0,0.2); margin-bottom: 20px;
-        }
-        .status.success { background: #48bb78; color: white; }
-        .status.error { background: #f56565; color: white; }
-        .actions { text-align: center; margin-top: 20px; }
-        .btn {
-            background: #4299e1; color: white; border: none; padding: 12px 30px;
-            border-radius: 25px; cursor: pointer; font-size: 1rem;
-            transition: all 0.3s ease; box-shadow: 0 4px 15px rgba(66, 153, 225, 0.3);
-        }
-        .btn:hover { background: #3182ce; transform: translateY(-2px); box-shadow: 0 6px 20px rgba(66, 153, 225, 0.4); }
-        @media (max-width: 768px) {
-            .info-grid { grid-template-columns: 1fr; }
-            .header h1 { font-size: 2rem; }
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="header">
-            <h1>🖥️ 设备信息收集</h1>
-            <p>以下展示了当前浏览器和设备可获取的信息</p>
-        </div>
-        
-        <div id="status" class="status"></div>
-        
-        <div class="info-grid">
-            <div class="info-card">
-                <h3>🎯 设备指纹</h3>
-                <div class="info-item"><span class="info-label">Canvas指纹:</span><span class="info-value" id="canvasFingerprint" style="font-family: monospace; font-size: 0.8em;">生成中...</span></div>
-                <div class="info-item"><span class="info-label">WebGL指纹:</span><span class="info-value" id="webglFingerprint" style="font-family: monospace; font-size: 0.8em;">生成中...</span></div>
-                <div class="info-item"><span class="info-label">字体指纹:</span><span class="info-value" id="fontFingerprint" style="font-family: monospace; font-size: 0.8em;">生成中...</span></div>
-            </div>
-
-            <div class="info-card">
-                <h3>�🌐 浏览器信息</h3>
-                <div class="info-item"><span class="info-label">User Agent:</span><span class="info-value" id="userAgent">检测中...</span></div>
-                <div class="info-item"><span class="info-label">平台:</span><span class="info-value" id="platform">检测中...</span></div>
-                <div class="info-item"><span class="info-label">语言:</span><span class="info-value" id="language">检测中...</span></div>
-                <div class="info-item"><span class="info-label">浏览器厂商:</span><span class="info-value" id="vendor">检测中...</span></div>
-                <div class="info-item"><span class="info-label">浏览器产品:</span><span class="info-value" id="product">检测中...</span></div>
-                <div class="info-item"><span class="info-label">浏览器版本:</span><span class="info-value" id="browserVersion">检测中...</span></div>
-            </div>
-            
-            <div class="info-card">
-                <h3>🖥️ 显示信息</h3>
-                <div class="info-item"><span class="info-label">屏幕分辨率:</span><span class="info-value" id="screen">检测中...</span></div>
-                <div class="info-item"><span class="info-label">可用屏幕:</span><span class="info-value" id="availableScreen">检测中...</span></div>
-                <div class="info-item"><span class="info-label">视口大小:</span><span class="info-value" id="viewportSize">检测中...</span></div>
-                <div class="info-item"><span class="info-label">颜色深度:</span><span class="info-value" id="colorDepth">检测中...</span></div>
-                <div class="info-item"><span class="info-label">像素比:</span><span class="info-value" id="pixelRatio">检测中...</span></div>
-            </div>
-            
-            <div class="info-card">
-                <h3>⚙️ 系统信息</h3>
-                <div class="info-item"><span class="info-label">设备类型:</span><span class="info-value" id="deviceType">检测中...</span></div>
-                <div class="info-item"><span class="info-label">操作系统:</span><span class="info-value" id="osVersion">检测中...</span></div>
-                <div class="info-item"><span class="info-label">时区:</span><span class="info-value" id="timezone">检测中...</span></div>
-                <div class="info-item"><span class="info-label">CPU核心:</span><span class="info-value" id="cpuCores">检测中...</span></div>
-                <div class="info-item"><span class="info-label">设备内存:</span><span class="info-value" id="deviceMemory">检测中...</span></div>
-                <div class="info-item"><span class="info-label">硬件并发:</span><span class="info-value" id="hardwareConcurrency">检测中...</span></div>
-            </div>
-            
-            <div class="info-card">
-                <h3>📡 网络与连接</h3>
-                <div class="info-item"><span class="info-label">连接类型:</span><span class="info-value" id="connection">检测中...</span></div>
-                <div class="info-item"><span class="info-label">在线状态:</span><span class="info-value" id="onlineStatus">检测中...</span></div>
-                <div class="info-item"><span class="info-label">HTTPS支持:</span><span class="info-value" id="httpsSupport">检测中...</span></div>
-                <div class="info-item"><span class="info-label">IP地址:</span><span class="info-value" id="ipAddress">检测中...</span></div>
-                <div class="info-item"><span class="info-label">时间戳:</span><span class="info-value" id="timestamp">检测中...</span></div>
-            </div>
-
-            <div class="info-card">
-                <h3>🔧 硬件功能</h3>
-                <div class="info-item"><span class="info-label">触摸支持:</span><span class="info-value" id="touchSupport">检测中...</span></div>
-                <div class="info-item"><span class="info-label">最大触点:</span><span class="info-value" id="maxTouchPoints">检测中...</span></div>
-                <div class="info-item"><span class="info-label">电池状态:</span><span class="info-value" id="battery">检测中...</span></div>
-                <div class="info-item"><span class="info-label">振动支持:</span><span class="info-value" id="vibration">检测中...</span></div>
-                <div class="info-item"><span class="info-label">设备方向:</span><span class="info-value" id="deviceOrientation">检测中...</span></div>
-            </div>
-
-            <div class="info-card">
-                <h3>🎮 传感器与游戏</h3>
-                <div class="info-item"><span class="info-label">加速度计:</span><span class="info-value" id="accelerometer">检测中...</span></div>
-                <div class="info-item"><span class="info-label">陀螺仪:</span><span class="info-value" id="gyroscope">检测中...</span></div>
-                <div class="info-item"><span class="info-label">磁力计:</span><span class="info-value" id="magnetometer">检测中...</span></div>
-                <div class="info-item"><span class="info-label">游戏手柄:</span><span class="info-value" id="gamepadAPI">检测中...</span></div>
-                <div class="info-item"><span class="info-label">VR显示:</span><span class="info-value" id="vrDisplay">检测中...</span></div>
-            </div>
-
-            <div class="info-card">
-                <h3>🎨 图形与媒体</h3>
-                <div class="info-item"><span class="info-label">WebGL:</span><span class="info-value" id="webgl">检测中...</span></div>
-                <div class="info-item"><span class="info-label">Canvas:</span><span class="info-value" id="canvas">检测中...</span></div>
-                <div class="info-item"><span class="info-label">音频上下文:</span><span class="info-value" id="audioContext">检测中...</span></div>
-                <div class="info-item"><span class="info-label">媒体设备:</span><span class="info-value" id="mediaDevices">检测中...</span></div>
-                <div class="info-item"><span class="info-label">WebRTC:</span><span class="info-value" id="webrtc">检测中...</span></div>
-            </div>
-
-            <div class="info-card">
-                <h3>💾 存储与API</h3>
-                <div class="info-item"><span class="info-label">本地存储:</span><span class="info-value" id="localStorage">检测中...</span></div>
-                <div class="info-item"><span class="info-label">会话存储:</span><span class="info-value" id="sessionStorage">检测中...</span></div>
-                <div class="info-item"><span class="info-label">IndexedDB:</span><span class="info-value" id="indexedDB">检测中...</span></div>
-                <div class="info-item"><span class="info-label">Service Worker:</span><span class="info-value" id="serviceWorker">检测中...</span></div>
-                <div class="info-item"><span class="info-label">WebAssembly:</span><span class="info-value" id="webAssembly">检测中...</span></div>
-            </div>
-
-            <div class="info-card">
-                <h3>🔐 权限与隐私</h3>
-                <div class="info-item"><span class="info-label">Cookie支持:</span><span class="info-value" id="cookiesEnabled">检测中...</span></div>
-                <div class="info-item"><span class="info-label">Do Not Track:</span><span class="info-value" id="doNotTrack">检测中...</span></div>
-                <div class="info-item"><span class="info-label">地理位置:</span><span class="info-value" id="geolocation">检测中...</span></div>
-                <div class="info-item"><span class="info-label">位置详情:</span><span class="info-value" id="locationDetails">获取中...</span></div>
-                <div class="info-item"><span class="info-label">通知权限:</span><span class="info-value" id="notifications">检测中...</span></div>
-                <div class="info-item"><span class="info-label">剪贴板:</span><span class="info-value" id="clipboard">检测中...</span></div>
-            </div>
-
-        </div>
-        
-        <div class="actions">
-            <button class="btn" onclick="collectDeviceInfo()">🔄 重新收集信息</button>
-        </div>
-    </div>
-
-    <script>
-        function collectDeviceInfo() {
-            const statusElement = document.getElementById('status');
-            statusElement.className = 'status';
-            statusElement.textContent = '正在收集设备信息...';
-            
-            try {
-                const deviceInfo = {
-                    // 基础信息
-                    userAgent: navigator.userAgent,
-                    screen: screen.width + " x " + screen.height,
-                    availableScreen: screen.availWidth + " x " + screen.availHeight,
-                    colorDepth: screen.colorDepth + " bit",
-                    timezone: Intl.DateTimeFormat().resolvedOptions().timeZone,
-                    language: navigator.language,
-                    platform: navigator.platform,
-                    cpuCores: navigator.hardwareConcurrency ? navigator.hardwareConcurrency.toString() : '未知',
-                    deviceMemory: navigator.deviceMemory ? navigator.deviceMemory + " GB" : '未知',
-                    connection: getConnectionInfo(),
-                    touchSupport: 'ontouchstart' in window ? '支持' : '不支持',
-                    pixelRatio: window.devicePixelRatio.toString(),
-                    cookiesEnabled: navigator.cookieEnabled ? '启用' : '禁用',
-                    javaEnabled: typeof navigator.javaEnabled === 'function' ? (navigator.javaEnabled() ? '启用' : '禁用') : '未知',
-                    doNotTrack: navigator.doNotTrack || '未设置',
-                    hardwareConcurrency: navigator.hardwareConcurrency ? navigator.hardwareConcurrency.toString() : '未知',
-                    vendor: navigator.vendor || '未知',
-                    product: navigator.product || '未知',
-                    
-                    // 新增信息
-                    battery: getBatteryInfo(),
-                    onlineStatus: navigator.onLine ? '在线' : '离线',
-                    maxTouchPoints: navigator.maxTouchPoints ? navigator.maxTouchPoints.toString() : '0',
-                    pdfViewer: checkPDFViewer(),
-                    webgl: checkWebGL(),
-                    canvas: checkCanvas(),
-                    audioContext: checkAudioContext(),
-                    localStorage: checkLocalStorage(),
-                    sessionStorage: checkSessionStorage(),
-                    indexedDB: 'indexedDB' in window ? '支持' : '不支持',
-                    geolocation: 'geolocation' in navigator ? '支持' : '不支持',
-                    locationDetails: getLocationDetails(),
-                    notifications: 'Notification' in window ? '支持' : '不支持',
-                    serviceWorker: 'serviceWorker' in navigator ? '支持' : '不支持',
-                    webrtc: checkWebRTC(),
-                    mediaDevices: 'mediaDevices' in navigator ? '支持' : '不支持',
-                    deviceOrientation: 'DeviceOrientationEvent' in window ? '支持' : '不支持',
-                    vibration: 'vibrate' in navigator ? '支持' : '不支持',
-                    clipboard: 'clipboard' in navigator ? '支持' : '不支持',
-                    accelerometer: 'Accelerometer' in window ? '支持' : '不支持',
-                    gyroscope: 'Gyroscope' in window ? '支持' : '不支持',
-                    magnetometer: 'Magnetometer' in window ? '支持' : '不支持',
-                    gamepadAPI: 'getGamepads' in navigator ? '支持' : '不支持',
-                    vrDisplay: 'getVRDisplays' in navigator ? '支持' : '不支持',
-                    webAssembly: 'WebAssembly' in window ? '支持' : '不支持',
-                    cssFeatures: getCSSFeatures(),
-                    fontList: getFontList(),
-                    plugins: getPluginsList(),
-                    mimeTypes: getMimeTypesList(),
-                    viewportSize: window.innerWidth + " x " + window.innerHeight,
-                    deviceType: getDeviceType(),
-                    osVersion: getOSVersion(),
-                    browserVersion: getBrowserVersion(),
-                    referrerPolicy: document.referrerPolicy || '未设置',
-                    httpsSupport: location.protocol === 'https:' ? '支持' : '不支持',
-                    // Canvas指纹
-                    canvasFingerprint: generateCanvasFingerprint(),
-                    webglFingerprint: generateWebGLFingerprint(),
-                    fontFingerprint: generateFontFingerprint()
-                };
-                
-                console.log('准备发送的数据:', deviceInfo);
-                
-                updateDisplay(deviceInfo);
-                
-                const controller = new AbortController();
-                const timeoutId = setTimeout(() => controller.abort(), 10000);
-                
-                fetch('/collect', {
-                    method: 'POST',
-                    headers: { 'Content-Type': 'application/json' },
-                    body: JSON.stringify(deviceInfo),
-                    signal: controller.signal
-                })
-                .then(response => {
-                    clearTimeout(timeoutId);
-                    console.log('服务器响应状态:', response.status);
-                    if (!response.ok) {
-                        return response.text().then(text => {
-                            console.log('服务器错误响应:', text);
-                            throw new Error('HTTP ' + response.status + ': ' + response.statusText);
-                        });
-                    }
-                    return response.json();
-                })
-                .then(data => {
-                    console.log('服务器成功响应:', data);
-                    if (data.status === 'success') {
-                        statusElement.className = 'status success';
-                        statusElement.textContent = '✅ 设备信息收集成功！数据已发送到服务器。';
-                        if (data.data) {
-                            document.getElementById('ipAddress').textContent = data.data.ipAddress || '未知';
-                            document.getElementById('timestamp').textContent = data.data.timestamp || '未知';
-                        }
-                    } else {
-                        throw new Error(data.message || '未知错误');
-                    }
-                })
-                .catch(error => {
-                    clearTimeout(timeoutId);
-                    statusElement.className = 'status error';
-                    console.error('请求错误:', error);
-                    if (error.name === 'AbortError') {
-                        statusElement.textContent = '❌ 请求超时，请检查网络连接';
-                    } else {
-                        statusElement.textContent = '❌ 发送数据到服务器失败: ' + error.message;
-                    }
-                });
-            } catch (error) {
-                statusElement.className = 'status error';
-                statusElement.textContent = '❌ 收集设备信息时发生错误: ' + error.message;
-                console.error('收集信息错误:', error);
-            }
-        }
-        
-        // 辅助函数
-        function getBatteryInfo() {
-            if ('getBattery' in navigator) {
-                navigator.getBattery().then(function(battery) {
-                    const level = Math.round(battery.level * 100);
-                    const charging = battery.charging ? '充电中' : '未充电';
-                    const batteryStr = level + '% (' + charging + ')';
-                    
-                    const element = document.getElementById('battery');
-                    if (element) {
-                        element.textContent = batteryStr;
-                    }
-                }).catch(function() {
-                    const element = document.getElementById('battery');
-                    if (element) {
-                        element.textContent = 'API支持但获取失败';
-                    }
-                });
-                return 'API支持，获取中...';
-            }
-            return '不支持';
-        }
-        
-        function checkWebGL() {
-            try {
-                const canvas = document.createElement('canvas');
-                return !!(window.WebGLRenderingContext && canvas.getContext('webgl')) ? '支持' : '不支持';
-            } catch (e) {
-                return '不支持';
-            }
-        }
-        
-        function checkCanvas() {
-            try {
-                const canvas = document.createElement('canvas');
-                return !!(canvas.getContext && canvas.getContext('2d')) ? '支持' : '不支持';
-            } catch (e) {
-                return '不支持';
-            }
-        }
-        
-        function checkAudioContext() {
-            return !!(window.AudioContext || window.webkitAudioContext) ? '支持' : '不支持';
-        }
-        
-        function checkLocalStorage() {
-            try {
-                return 'localStorage' in window && window.localStorage !== null ? '支持' : '不支持';
-            } catch (e) {
-                return '不支持';
-            }
-        }
-        
-        function checkSessionStorage() {
-            try {
-                return 'sessionStorage' in window && window.sessionStorage !== null ? '支持' : '不支持';
-            } catch (e) {
-                return '不支持';
-            }
-        }
-        
-        function checkPDFViewer() {
-            // 检查多种 PDF 支持方式
-            const checks = [];
-            
-            // 检查 MIME 类型
-            if (navigator.mimeTypes && navigator.mimeTypes['application/pdf']) {
-                checks.push('MIME支持');
-            }
-            
-            // 检查插件
-            if (navigator.plugins) {
-                for (let i = 0; i < navigator.plugins.length; i++) {
-                    const plugin = navigator.plugins[i];
-                    if (plugin.name.toLowerCase().includes('pdf')) {
-                        checks.push('插件支持');
-                        break;
-                    }
-                }
-            }
-            
-            // 检查内置 PDF 查看器
-            if (window.navigator.pdfViewerEnabled !== undefined) {
-                if (window.navigator.pdfViewerEnabled) {
-                    checks.push('内置查看器');
-                }
-            } else {
-                // Firefox/Chrome 的内置 PDF 支持
-                const userAgent = navigator.userAgent.toLowerCase();
-                if (userAgent.includes('firefox') || userAgent.includes('chrome') || userAgent.includes('edge')) {
-                    checks.push('可能支持内置');
-                }
-            }
-            
-            return checks.length > 0 ? checks.join(', ') : '不支持';
-        }
-        
-        function checkPDFViewer() {
-            // 检查多种 PDF 支持方式
-            const checks = [];
-            
-            // 检查 MIME 类型
-            if (navigator.mimeTypes && navigator.mimeTypes['application/pdf']) {
-                checks.push('MIME支持');
-            }
-            
-            // 检查插件
-            if (navigator.plugins) {
-                for (let i = 0; i < navigator.plugins.length; i++) {
-                    const plugin = navigator.plugins[i];
-                    if (plugin.name.toLowerCase().includes('pdf')) {
-                        checks.push('插件支持');
-                        break;
-                    }
-                }
-            }
-            
-            // 检查内置 PDF 查看器
-            if (window.navigator.pdfViewerEnabled !== undefined) {
-                if (window.navigator.pdfViewerEnabled) {
-                    checks.push('内置查看器');
-                }
-            } else {
-                // Firefox/Chrome 的内置 PDF 支持
-                const userAgent = navigator.userAgent.toLowerCase();
-                if (userAgent.includes('firefox') || userAgent.includes('chrome') || userAgent.includes('edge')) {
-                    checks.push('可能支持内置');
-                }
-            }
-            
-            return checks.length > 0 ? checks.join(', ') : '不支持';
-        }
-        
-        function checkWebRTC() {
-            return !!(window.RTCPeerConnection || window.webkitRTCPeerConnection || window.mozRTCPeerConnection) ? '支持' : '不支持';
-        }
-        
-        function getCSSFeatures() {
-            const features = [];
-            if (CSS.supports('display', 'grid')) features.push('Grid');
-            if (CSS.supports('display', 'flex')) features.push('Flexbox');
-            if (CSS.supports('backdrop-filter', 'blur(10px)')) features.push('Backdrop-filter');
-            return features.length ? features.join(', ') : '基础CSS';
-        }
-        
-        function getFontList() {
-            const fonts = ['Arial', 'Times New Roman', 'Helvetica', 'Georgia', 'Verdana'];
-            const available = [];
-            const canvas = document.createElement('canvas');
-            const ctx = canvas.getContext('2d');
-            fonts.forEach(font => {
-                ctx.font = '12px ' + font;
-                if (ctx.measureText('test').width > 0) available.push(font);
-            });
-            return available.length ? available.slice(0, 3).join(', ') + '等' : '未检测';
-        }
-        
-        function getPluginsList() {
-            if (navigator.plugins && navigator.plugins.length > 0) {
-                const plugins = Array.from(navigator.plugins).slice(0, 3).map(p => p.name);
-                return plugins.join(', ') + '等';
-            }
-            return '无插件';
-        }
-        
-        function getMimeTypesList() {
-            if (navigator.mimeTypes && navigator.mimeTypes.length > 0) {
-                return navigator.mimeTypes.length + ' 种类型';
-            }
-            return '未检测';
-        }
-        
-        function getDeviceType() {
-            const ua = navigator.userAgent.toLowerCase();
-            if (/mobile|android|iphone|ipad|phone/i.test(ua)) return '移动设备';
-            if (/tablet|ipad/i.test(ua)) return '平板设备';
-            return '桌面设备';
-        }
-        
-        function getOSVersion() {
-            const ua = navigator.userAgent;
-            if (ua.indexOf('Windows NT 10.0') !== -1) return 'Windows 10/11';
-            if (ua.indexOf('Windows NT 6.3') !== -1) return 'Windows 8.1';
-            if (ua.indexOf('Windows NT 6.2') !== -1) return 'Windows 8';
-            if (ua.indexOf('Windows NT 6.1') !== -1) return 'Windows 7';
-            if (ua.indexOf('Mac OS X') !== -1) return 'macOS ' + ua.match(/Mac OS X ([0-9_]+)/)?.[1]?.replace(/_/g, '.') || '';
-            if (ua.indexOf('Android') !== -1) return 'Android ' + ua.match(/Android ([0-9.]+)/)?.[1] || '';
-            if (ua.indexOf('iPhone OS') !== -1) return 'iOS ' + ua.match(/iPhone OS ([0-9_]+)/)?.[1]?.replace(/_/g, '.') || '';
-            return navigator.platform;
-        }
-        
-        function getBrowserVersion() {
-            const ua = navigator.userAgent;
-            if (ua.indexOf('Chrome') !== -1) return 'Chrome ' + ua.match(/Chrome\/([0-9.]+)/)?.[1] || '';
-            if (ua.indexOf('Firefox') !== -1) return 'Firefox ' + ua.match(/Firefox\/([0-9.]+)/)?.[1] || '';
-            if (ua.indexOf('Safari') !== -1 && ua.indexOf('Chrome') === -1) return 'Safari ' + ua.match(/Version\/([0-9.]+)/)?.[1] || '';
-            if (ua.indexOf('Edge') !== -1) return 'Edge ' + ua.match(/Edge\/([0-9.]+)/)?.[1] || '';
-            return '未知浏览器';
-        }
-        
-        function getConnectionInfo() {
-            // 检查Network Information API支持
-            if (navigator.connection || navigator.mozConnection || navigator.webkitConnection) {
-                const conn = navigator.connection || navigator.mozConnection || navigator.webkitConnection;
-                
-                let info = [];
-                
-                // 有效连接类型
-                if (conn.effectiveType) {
-                    const typeMap = {
-                        'slow-2g': '慢速2G',
-                        '2g': '2G',
-                        '3g': '3G', 
-                        '4g': '4G'
-                    };
-                    info.push(typeMap[conn.effectiveType] || conn.effectiveType);
-                }
-                
-                // 连接类型
-                if (conn.type) {
-                    const connectionTypeMap = {
-                        'bluetooth': '蓝牙',
-                        'cellular': '蜂窝网络',
-                        'ethernet': '以太网',
-                        'none': '无连接',
-                        'wifi': 'WiFi',
-                        'wimax': 'WiMAX',
-                        'other': '其他',
-                        'unknown': '未知'
-                    };
-                    info.push(connectionTypeMap[conn.type] || conn.type);
-                }
-                
-                // 下行速度
-                if (conn.downlink !== undefined) {
-                    info.push('下行: ' + conn.downlink + 'Mbps');
-                }
-                
-                // RTT延迟
-                if (conn.rtt !== undefined) {
-                    info.push('RTT: ' + conn.rtt + 'ms');
-                }
-                
-                // 节省数据模式
-                if (conn.saveData !== undefined) {
-                    info.push('节省数据: ' + (conn.saveData ? '开启' : '关闭'));
-                }
-                
-                return info.length > 0 ? info.join(' | ') : '基本连接信息';
-            }
-            
-            // 备用检测方法
-            const connection = navigator.connection || navigator.mozConnection || navigator.webkitConnection;
-            if (!connection) {
-                // 通过其他方式推断连接类型
-                let fallbackInfo = [];
-                
-                // 检查在线状态
-                fallbackInfo.push(navigator.onLine ? '在线' : '离线');
-                
-                // 检查是否可能是移动设备
-                if (/Mobile|Android|iPhone|iPad/i.test(navigator.userAgent)) {
-                    fallbackInfo.push('可能是移动网络');
-                } else {
-                    fallbackInfo.push('可能是宽带');
-                }
-                
-                return fallbackInfo.join(' | ');
-            }
-            
-            return '无法检测连接信息';
-        }
-        
-        // 获取地理位置详情
-        function getLocationDetails() {
-            if ('geolocation' in navigator) {
-                navigator.geolocation.getCurrentPosition(
-                    function(position) {
-                        const lat = position.coords.latitude.toFixed(6);
-                        const lng = position.coords.longitude.toFixed(6);
-                        const accuracy = position.coords.accuracy.toFixed(0);
-                        const locationStr = '纬度: ' + lat + ', 经度: ' + lng + ' (精度: ' + accuracy + 'm)';
-                        
-                        // 更新显示
-                        const element = document.getElementById('locationDetails');
-                        if (element) {
-                            element.textContent = locationStr;
-                        }
-                        
-                        // 尝试获取地址信息（可选）
-                        reverseGeocode(lat, lng);
-                    },
-                    function(error) {
-                        const element = document.getElementById('locationDetails');
-                        if (element) {
-                            switch(error.code) {
-                                case error.PERMISSION_DENIED:
-                                    element.textContent = '用户拒绝了地理定位请求';
-                                    break;
-                                case error.POSITION_UNAVAILABLE:
-                                    element.textContent = '位置信息不可用';
-                                    break;
-                                case error.TIMEOUT:
-                                    element.textContent = '请求用户地理位置超时';
-                                    break;
-                                default:
-                                    element.textContent = '发生未知错误';
-                                    break;
-                            }
-                        }
-                    },
-                    {
-                        enableHighAccuracy: true,
-                        timeout: 10000,
-                        maximumAge: 60000
-                    }
-                );
-                return '正在获取位置...';
-            }
-            return '不支持地理位置API';
-        }
-        
-        // 反向地理编码（可选功能）
-        function reverseGeocode(lat, lng) {
-            // 注意：这里使用免费的API，实际使用时可能需要API密钥
-            fetch('https://nominatim.openstreetmap.org/reverse?format=json&lat=' + lat + '&lon=' + lng + '&zoom=18&addressdetails=1')
-                .then(response => response.json())
-                .then(data => {
-                    if (data && data.display_name) {
-                        const element = document.getElementById('locationDetails');
-                        if (element) {
-                            const currentText = element.textContent;
-                            element.textContent = currentText + ' - ' + data.display_name;
-                        }
-                    }
-                })
-                .catch(error => {
-                    console.log('反向地理编码失败:', error);
-                });
-        }
-        
-        // Canvas指纹生成函数
-        function generateCanvasFingerprint() {
-            try {
-                const canvas = document.createElement('canvas');
-                const ctx = canvas.getContext('2d');
-                
-                if (!ctx) return '不支持';
-                
-                // 设置Canvas尺寸
-                canvas.width = 300;
-                canvas.height = 150;
-                
-                // 绘制背景渐变
-                const gradient = ctx.createLinearGradient(0, 0, canvas.width, canvas.height);
-                gradient.addColorStop(0, '#ff6b6b');
-                gradient.addColorStop(0.5, '#4ecdc4');
-                gradient.addColorStop(1, '#45b7d1');
-                ctx.fillStyle = gradient;
-                ctx.fillRect(0, 0, canvas.width, canvas.height);
-                
-                // 绘制几何形状
-                ctx.strokeStyle = '#333333';
-                ctx.lineWidth = 2;
-                ctx.strokeRect(10, 10, 100, 50);
-                
-                ctx.fillStyle = '#ff9999';
-                ctx.beginPath();
-                ctx.arc(180, 80, 40, 0, Math.PI * 2);
-                ctx.fill();
-                
-                // 绘制文本 - 使用不同字体和样式
-                ctx.fillStyle = '#333333';
-                ctx.font = '16px Arial';
-                ctx.fillText('Device Fingerprint', 10, 80);
-                
-                ctx.font = 'bold 12px serif';
-                ctx.fillText('Canvas Test 2024', 10, 100);
-                
-                ctx.font = '14px monospace';
-                ctx.fillText('Hello World! 你好世界', 10, 120);
-                
-                // 绘制表情符号
-                ctx.font = '20px Arial';
-                ctx.fillText('😀🌍🔒', 200, 120);
-                
-                // 添加阴影效果
-                ctx.shadowColor = 'rgba(0,0,0,0.5)';
-                ctx.shadowBlur = 5;
-                ctx.shadowOffsetX = 3;
-                ctx.shadowOffsetY = 3;
-                ctx.fillStyle = '#4a90e2';
-                ctx.fillRect(220, 20, 60, 30);
-                
-                // 生成Canvas数据URL并计算哈希
-                const dataURL = canvas.toDataURL();
-                return hashString(dataURL);
-            } catch (e) {
-                return '生成失败: ' + e.message;
-            }
-        }
-
-        // WebGL指纹生成函数
-        function generateWebGLFingerprint() {
-            try {
-                const canvas = document.createElement('canvas');
-                const gl = canvas.getContext('webgl') || canvas.getContext('experimental-webgl');
-                
-                if (!gl) return '不支持';
-                
-                const fingerprint = [];
-                
-                // WebGL版本和供应商信息
-                fingerprint.push(gl.getParameter(gl.VERSION));
-                fingerprint.push(gl.getParameter(gl.VENDOR));
-                fingerprint.push(gl.getParameter(gl.RENDERER));
-                fingerprint.push(gl.getParameter(gl.SHADING_LANGUAGE_VERSION));
-                
-                // 扩展信息
-                const extensions = gl.getSupportedExtensions();
-                if (extensions) {
-                    fingerprint.push(extensions.sort().join(','));
-                }
-                
-                // WebGL参数
-                const params = [
-                    gl.MAX_TEXTURE_SIZE,
-                    gl.MAX_VERTEX_ATTRIBS,
-                    gl.MAX_VERTEX_UNIFORM_VECTORS,
-                    gl.MAX_FRAGMENT_UNIFORM_VECTORS,
-                    gl.MAX_VARYING_VECTORS,
-                    gl.MAX_RENDERBUFFER_SIZE,
-                    gl.MAX_VIEWPORT_DIMS
-                ];
-                
-                params.forEach(param => {
-                    fingerprint.push(gl.getParameter(param));
-                });
-                
-                // 生成简单的WebGL渲染
-                gl.clearColor(0.2, 0.4, 0.8, 1.0);
-                gl.clear(gl.COLOR_BUFFER_BIT);
-                
-                return hashString(fingerprint.join('|'));
-            } catch (e) {
-                return '生成失败: ' + e.message;
-            }
-        }
-
-        // 字体指纹生成函数
-        function generateFontFingerprint() {
-            try {
-                const baseFonts = ['monospace', 'sans-serif', 'serif'];
-                const testFonts = [
-                    'Arial', 'Helvetica', 'Times New Roman', 'Courier New', 'Verdana',
-                    'Georgia', 'Palatino', 'Garamond', 'Bookman', 'Comic Sans MS',
-                    'Trebuchet MS', 'Arial Black', 'Impact', 'Tahoma', 'Geneva',
-                    'Lucida Console', 'Monaco', 'Consolas', 'Calibri', 'Cambria',
-                    'Microsoft YaHei', 'SimSun', 'SimHei', 'KaiTi', 'FangSong'
-                ];
-                
-                const canvas = document.createElement('canvas');
-                const ctx = canvas.getContext('2d');
-                
-                if (!ctx) return '不支持';
-                
-                const detectedFonts = [];
-                const testString = 'mmmmmmmmmmlli';
-                const testSize = '72px';
-                
-                // 为每种基础字体创建基准尺寸
-                const baseSizes = {};
-                baseFonts.forEach(baseFont => {
-                    ctx.font = testSize + ' ' + baseFont;
-                    const metrics = ctx.measureText(testString);
-                    baseSizes[baseFont] = {
-                        width: metrics.width,
-                        height: metrics.actualBoundingBoxAscent + metrics.actualBoundingBoxDescent
-                    };
-                });
-                
-                // 测试每种字体
-                testFonts.forEach(font => {
-                    baseFonts.forEach(baseFont => {
-                        ctx.font = testSize + ' ' + font + ', ' + baseFont;
-                        const metrics = ctx.measureText(testString);
-                        const currentSize = {
-                            width: metrics.width,
-                            height: metrics.actualBoundingBoxAscent + metrics.actualBoundingBoxDescent
-                        };
-                        
-                        // 如果尺寸与基础字体不同，说明目标字体存在
-                        if (currentSize.width !== baseSizes[baseFont].width || 
-                            currentSize.height !== baseSizes[baseFont].height) {
-                            if (!detectedFonts.includes(font)) {
-                                detectedFonts.push(font);
-                            }
-                        }
-                    });
-                });
-                
-                return hashString(detectedFonts.sort().join(','));
-            } catch (e) {
-                return '生成失败: ' + e.message;
-            }
-        }
-
-        // 简单的哈希函数
-        function hashString(str) {
-            let hash = 0;
-            if (str.length === 0) return hash.toString();
-            
-            for (let i = 0; i < str.length; i++) {
-                const char = str.charCodeAt(i);
-                hash = ((hash << 5) - hash) + char;
-                hash = hash & hash; // 转换为32位整数
-            }
-            
-            return Math.abs(hash).toString(16);
-        }
-        
-        function updateDisplay(info) {
-            for (const [key, value] of Object.entries(info)) {
-                const element = document.getElementById(key);
-                if (element) element.textContent = value;
-            }
-        }
-        
-        document.addEventListener('DOMContentLoaded', collectDeviceInfo);
-    </script>
-</body>
-</html>`
-
+	// 请求浏览器在后续请求 (包括 /collect) 中携带高熵 Client Hints
+	w.Header().Set("Accept-CH", "Sec-CH-UA-Platform-Version, Sec-CH-UA-Model, Sec-CH-UA-Arch, Sec-CH-UA-Full-Version-List")
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.Write([]byte(html))
+	// 允许缓存但每次都要重新验证, If-None-Match 匹配时由 ServeContent 返回 304
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", indexPage.etag)
+	http.ServeContent(w, r, "index.html", time.Time{}, bytes.NewReader(indexPage.body))
 }
 
+// 未注册的路径
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	sendResponse(w, r, http.StatusNotFound, Response{
+		Status:  "error",
+		Code:    "not_found",
+		Message: "接口不存在",
+	})
+}
+
+// 前端页面模板参数
+type indexData struct {
+	ProbeProfile string
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(indexHTML))
+
+// 启动时按当前配置渲染好的首页, 内容在进程内不变
+var indexPage struct {
+	body []byte
+	etag string
+}
+
+// 渲染首页并计算 ETag 和内联脚本的 CSP 哈希
+// ETag 取渲染结果的摘要, 页面模板或探测级别等配置变化时随之改变
+func renderIndexPage() error {
+	var buf bytes.Buffer
+	err := indexTemplate.Execute(&buf, indexData{
+		ProbeProfile: probeProfile,
+	})
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	indexPage.body = buf.Bytes()
+	indexPage.etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+	scriptHashSource = cspScriptHash(indexPage.body)
+	return nil
+}
+
+//go:embed index.html
+var indexHTML string
+
 func main() {
+	// 结构化日志, 以 JSON 行输出到标准输出; 请求内的日志带有 request_id, 启用 ANONYMIZE_IP 时 ip 字段脱敏
+	var logLevel slog.LevelVar
+	slog.SetDefault(slog.New(requestIDHandler{slog.NewJSONHandler(os.Stdout,
+		&slog.HandlerOptions{Level: &logLevel, ReplaceAttr: anonymizeLogIP})}))
+
+	// 读取并校验全部配置
+	configPath := flag.String("config", "", "YAML/JSON 配置文件路径, 环境变量优先于文件中的值")
+	flag.Parse()
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		fatal("配置无效", "error", err)
+	}
+	config = cfg
+	logLevel.UnmarshalText([]byte(cfg.LogLevel))
+
+	// 访问日志
+	if cfg.AccessLog != "" {
+		al, err := NewAccessLogger(cfg.AccessLog, cfg.rotateConfig())
+		if err != nil {
+			fatal("打开 ACCESS_LOG 失败", "error", err)
+		}
+		accessLog = al
+	}
+
+	// 链路追踪
+	var shutdownTracing func(context.Context) error
+	if cfg.OTLPEndpoint != "" {
+		shutdownTracing, err = initTracing(context.Background(), cfg.OTLPEndpoint)
+		if err != nil {
+			fatal("初始化链路追踪失败", "error", err)
+		}
+	}
+
+	// 限流配置
+	rateLimiter.limit = cfg.RateLimit
+	rateLimiter.window = time.Duration(cfg.RateWindow)
+	rateLimiter.StartSweeper(rateLimitSweepInterval)
+	if cfg.RedisURL != "" {
+		rl, err := NewRedisLimiter(cfg.RedisURL, rateLimiter)
+		if err != nil {
+			fatal("无效的 REDIS_URL", "error", err)
+		}
+		requestLimiter = rl
+	}
+	deviceRateLimiter.limit = cfg.DeviceRateLimit
+	deviceRateLimiter.window = time.Duration(cfg.DeviceRateWindow)
+	deviceRateLimiter.StartSweeper(rateLimitSweepInterval)
+	readRateLimiter.limit = cfg.ReadRateLimit
+	readRateLimiter.window = time.Duration(cfg.ReadRateWindow)
+	readRateLimiter.StartSweeper(rateLimitSweepInterval)
+	if rl, ok := requestLimiter.(*RedisLimiter); ok {
+		deviceLimiter = rl.WithFallback(deviceRateLimiter, "device:")
+		readLimiter = rl.WithFallback(readRateLimiter, "read:")
+	}
+	// 恢复上次关闭时保存的限流状态, 避免重启后所有客户端重新获得完整配额
+	rateLimitStatePath = cfg.RateLimitState
+	if cfg.RateLimitState != "" {
+		if err := loadRateLimitState(cfg.RateLimitState); err != nil {
+			slog.Warn("恢复限流状态失败, 从空状态开始", "event", "rate_limit_restore_error", "error", err)
+		}
+	}
+	fingerprintMonitor.threshold = cfg.FingerprintAlertThreshold
+	fingerprintMonitor.window = time.Duration(cfg.FingerprintAlertWindow)
+	fingerprintMonitor.StartSweeper(rateLimitSweepInterval)
+	alertWebhookURL = cfg.AlertWebhookURL
+	idempotencyCache.ttl = time.Duration(cfg.IdempotencyTTL)
+	idempotencyCache.StartSweeper(rateLimitSweepInterval)
+
 	// 设置路由
-	http.HandleFunc("/", indexHandler)
-	http.HandleFunc("/collect", collectHandler)
+	mux := newMux(cfg)
 
-	// 获取端口
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	scheme := "http"
+	if cfg.TLSCert != "" {
+		scheme = "https"
+	}
+	unixSocket = cfg.UnixSocket
+	socketMode, _ := strconv.ParseUint(cfg.UnixSocketMode, 8, 32)
+
+	// 访问控制, 网段列表已在 LoadConfig 中校验
+	trustedProxies, _ = parseCIDRList(strings.Join(cfg.TrustedProxies, ","))
+	blocklist, _ = parseCIDRList(strings.Join(cfg.Blocklist, ","))
+	allowlist, _ = parseCIDRList(strings.Join(cfg.Allowlist, ","))
+	allowedOrigins = parseOriginList(strings.Join(cfg.AllowedOrigins, ","))
+	apiKeys = parseAPIKeys(strings.Join(cfg.APIKeys, ","))
+	publicStats = cfg.PublicStats
+	if len(apiKeys) == 0 {
+		slog.Warn("未配置 API_KEYS, 读取和管理接口已停用", "event", "config", "public_stats", publicStats)
+	}
+
+	probeProfile = cfg.ProbeProfile
+	verboseResponse = cfg.VerboseResponse
+	allowMethodOverride = cfg.MethodOverride
+	dropBots = cfg.DropBots
+	anonymizeIP = cfg.AnonymizeIP
+	redactHeaders = cfg.RedactHeaders
+	securityHeaders = cfg.SecurityHeaders
+	responseSigningKey = []byte(cfg.ResponseSigningKey)
+	signingSecret = []byte(cfg.SigningSecret)
+	if len(signingSecret) > 0 {
+		// 密钥不下发给浏览器, 首页脚本的提交不带签名
+		slog.Warn("已启用请求签名, 首页的浏览器提交将被拒绝, 只有持有密钥的服务端客户端可以提交", "event", "startup")
+	}
+	maxFieldLength = cfg.MaxFieldLength
+	similarityThreshold = cfg.SimilarityThreshold
+	anonK = cfg.AnonK
+
+	// 首页依赖探测级别, 配置确定后渲染一次
+	if err := renderIndexPage(); err != nil {
+		fatal("渲染首页失败", "error", err)
+	}
+
+	// 显卡归一化规则
+	if err := loadGPURules(cfg.GPUMap); err != nil {
+		fatal("加载 GPU_MAP 失败", "error", err)
+	}
+
+	// 内存看门狗
+	if cfg.MemoryLimitMB > 0 {
+		startMemoryWatchdog(cfg.MemoryLimitMB << 20)
+	}
+
+	// GeoIP 数据库
+	if cfg.GeoIPDB != "" {
+		geo, err := NewGeoResolver(cfg.GeoIPDB)
+		if err != nil {
+			fatal("打开 GEOIP_DB 失败", "error", err)
+		}
+		geoResolver = geo
+	}
+	if cfg.GeoIPASNDB != "" {
+		asn, err := NewASNResolver(cfg.GeoIPASNDB)
+		if err != nil {
+			fatal("打开 GEOIP_ASN_DB 失败", "error", err)
+		}
+		asnResolver = asn
+	}
+
+	// 反向地理编码
+	if cfg.ReverseGeocode {
+		geocoder = NewGeocoder(cfg.GeocoderURL, cfg.GeocoderRateLimit)
+	}
+
+	// 存储后端
+	st, err := openStore(cfg)
+	if err != nil {
+		fatal("打开存储后端失败", "storage", cfg.Storage, "error", err)
+	}
+	store = st
+
+	// 从已保存的记录重建设备访问统计、指纹总体和独立设备计数
+	// 逐条读取 (从旧到新), 不一次性载入全部记录, 存储很大时也不会在启动时耗尽内存
+	err = store.Iterate(context.Background(), "", func(info DeviceInfo) error {
+		deviceStats.Record(info.DeviceID, info.Timestamp)
+		fingerprintPopulation.Add(info)
+		uniqueVisitors.Add(info.DeviceID)
+		return nil
+	})
+	if err != nil {
+		fatal("读取已保存的设备信息失败", "storage", cfg.Storage, "error", err)
+	}
+
+	// 死信存储
+	if cfg.DeadLetterFile != "" {
+		deadLetters = NewDeadLetterStore(cfg.DeadLetterFile, time.Duration(cfg.DeadLetterRetention), cfg.DeadLetterMaxSize)
+		deadLetters.StartSweeper(deadLetterSweepInterval)
+	}
+
+	// 数据保留时长
+	retention = time.Duration(cfg.Retention)
+	startRetentionSweeper(context.Background(), systemClock, retentionSweepInterval)
+
+	// Webhook 转发
+	if cfg.WebhookURL != "" {
+		webhook = NewWebhookSender(cfg.WebhookURL, cfg.WebhookDLQ)
 	}
 
 	// 启动信息
 	fmt.Printf("🚀 设备信息收集服务器启动成功!\n")
-	fmt.Printf("📊 访问地址: http://localhost:%s\n", port)
+	if unixSocket != "" {
+		fmt.Printf("📊 监听套接字: %s\n", unixSocket)
+	} else {
+		fmt.Printf("📊 访问地址: %s://localhost:%s\n", scheme, cfg.Port)
+	}
 	fmt.Printf("💻 操作系统: %s\n", runtime.GOOS)
 	fmt.Printf("🕒 启动时间: %s\n", time.Now().Format("2006-01-02 15:04:05"))
 	fmt.Printf("----------------------------------------\n")
 
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	server := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           newHandler(mux, cfg),
+		ReadTimeout:       time.Duration(cfg.ReadTimeout),
+		ReadHeaderTimeout: time.Duration(cfg.ReadHeaderTimeout),
+		WriteTimeout:      time.Duration(cfg.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.IdleTimeout),
+	}
+	// 直接提供 HTTPS 服务时在握手中计算客户端的 JA3 指纹
+	if cfg.TLSCert != "" {
+		server.TLSConfig = ja3TLSConfig()
+		server.ConnContext = ja3ConnContext
+		server.ConnState = ja3ConnState
+	}
+	// Shutdown 不会中断长连接, 主动结束事件流
+	server.RegisterOnShutdown(eventHub.Close)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// 未设置 UNIX_SOCKET 时由 ListenAndServe 监听 TCP 端口
+	var ln net.Listener
+	if unixSocket != "" {
+		l, err := listenUnix(unixSocket, os.FileMode(socketMode))
+		if err != nil {
+			fatal("监听 UNIX_SOCKET 失败", "event", "listen_error", "error", err)
+		}
+		ln = l
+	}
+
+	go func() {
+		var err error
+		switch {
+		case ln != nil && cfg.TLSCert != "":
+			err = server.ServeTLS(ln, cfg.TLSCert, cfg.TLSKey)
+		case ln != nil:
+			err = server.Serve(ln)
+		case cfg.TLSCert != "":
+			err = server.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+		default:
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			fatal("服务器启动失败", "event", "listen_error", "error", err)
+		}
+	}()
+
+	<-ctx.Done()
+	slog.Info("正在关闭服务器, 等待处理中的请求完成", "event", "shutdown")
+
+	// 停止接收新连接并等待处理中的请求结束, 之后再关闭存储
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("关闭服务器超时", "event", "shutdown_timeout", "error", err)
+	}
+
+	// 关闭监听器时通常已删除套接字文件, 这里确保不留下残留
+	if unixSocket != "" {
+		if err := os.Remove(unixSocket); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("删除套接字文件失败", "event", "shutdown", "error", err)
+		}
+	}
+	if cfg.RateLimitState != "" {
+		if err := saveRateLimitState(cfg.RateLimitState); err != nil {
+			slog.Error("保存限流状态失败", "event", "rate_limit_save_error", "error", err)
+		}
+	}
+	if webhook != nil {
+		webhook.Close(shutdownCtx)
+	}
+	if store != nil {
+		if err := store.Close(); err != nil {
+			slog.Error("关闭存储后端失败", "event", "storage_error", "error", err)
+		}
+	}
+	if geoResolver != nil {
+		geoResolver.Close()
+	}
+	if asnResolver != nil {
+		asnResolver.Close()
+	}
+	if rl, ok := requestLimiter.(*RedisLimiter); ok {
+		rl.Close()
+	}
+	if accessLog != nil {
+		accessLog.Close()
+	}
+	if shutdownTracing != nil {
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			slog.Error("导出剩余的链路数据失败", "event", "tracing_error", "error", err)
+		}
+	}
+	slog.Info("服务器已关闭", "event", "stopped")
 }
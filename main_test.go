@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock 可手动推进的时钟
+type fakeClock struct {
+	now   time.Time
+	mutex sync.Mutex
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// 向 collectHandler 提交一次, headers 为成对的请求头名称和值
+func postCollect(target, body string, headers ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	collectHandler(w, r)
+	return w
+}
+
+// 记录数
+func storedCount(t *testing.T, s Store) int {
+	t.Helper()
+	return len(iterateIDs(t, s, ""))
+}
+
+func TestRateLimiterWindow(t *testing.T) {
+	steps := []struct {
+		name      string
+		advance   time.Duration
+		allow     bool
+		remaining time.Duration // 本次请求之后的 RetryAfter
+	}{
+		{"first", 0, true, 0},
+		{"second", 10 * time.Second, true, 50 * time.Second},
+		{"over limit", 20 * time.Second, false, 30 * time.Second},
+		{"first expired", 30 * time.Second, true, 10 * time.Second},
+		{"still limited", 5 * time.Second, false, 5 * time.Second},
+		{"second expired", 5 * time.Second, true, 50 * time.Second},
+	}
+
+	clock := newFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local))
+	rl := &RateLimiter{
+		requests: make(map[string][]time.Time),
+		clock:    clock,
+		limit:    2,
+		window:   time.Minute,
+	}
+	for _, step := range steps {
+		clock.Advance(step.advance)
+		if got := rl.Allow("1.2.3.4"); got != step.allow {
+			t.Fatalf("%s: Allow = %v, want %v", step.name, got, step.allow)
+		}
+		if got := rl.RetryAfter("1.2.3.4"); got != step.remaining {
+			t.Fatalf("%s: RetryAfter = %v, want %v", step.name, got, step.remaining)
+		}
+	}
+	if !rl.Allow("5.6.7.8") {
+		t.Fatal("其他IP不应受影响")
+	}
+
+	clock.Advance(time.Minute)
+	rl.Sweep()
+	if len(rl.requests) != 0 {
+		t.Fatalf("Sweep 后仍有 %d 个IP", len(rl.requests))
+	}
+}
+
+// 只访问过一次的IP在窗口结束后被清理, 仍在窗口内的请求保留
+func TestRateLimiterSweep(t *testing.T) {
+	tests := []struct {
+		name      string
+		ages      []time.Duration // 各次请求距清理时的时长
+		remaining int             // 清理后保留的请求数, 0 表示IP被删除
+	}{
+		{"single stale request", []time.Duration{2 * time.Minute}, 0},
+		{"just expired", []time.Duration{time.Minute}, 0},
+		{"partly expired", []time.Duration{90 * time.Second, 30 * time.Second}, 1},
+		{"all recent", []time.Duration{20 * time.Second, 10 * time.Second}, 2},
+	}
+
+	clock := newFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local))
+	rl := &RateLimiter{
+		requests: make(map[string][]time.Time),
+		clock:    clock,
+		limit:    10,
+		window:   time.Minute,
+	}
+	now := clock.Now()
+	for _, tt := range tests {
+		for _, age := range tt.ages {
+			rl.requests[tt.name] = append(rl.requests[tt.name], now.Add(-age))
+		}
+	}
+
+	// 后台清理按间隔执行
+	rl.StartSweeper(time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rl.mutex.Lock()
+		n := len(rl.requests)
+		rl.mutex.Unlock()
+		if n == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	for _, tt := range tests {
+		requests, ok := rl.requests[tt.name]
+		if len(requests) != tt.remaining || ok != (tt.remaining > 0) {
+			t.Errorf("%s: %d requests kept (present=%v), want %d", tt.name, len(requests), ok, tt.remaining)
+		}
+	}
+}
+
+func TestParseDimensions(t *testing.T) {
+	tests := []struct {
+		in            string
+		width, height int
+	}{
+		{"1920 x 1080", 1920, 1080},
+		{"1920x1080", 1920, 1080},
+		{"1920 X 1080", 1920, 1080},
+		{" 390 x 844 ", 390, 844},
+		{"未知", 0, 0},
+		{"", 0, 0},
+		{"1920", 0, 0},
+		{"1920 x", 0, 0},
+		{"x 1080", 0, 0},
+		{"1920.5 x 1080", 0, 0},
+		{"-1 x 1080", 0, 0},
+		{"0 x 0", 0, 0},
+		{"abc x def", 0, 0},
+		{"1920 x 1080 x 2", 0, 0},
+	}
+	for _, tt := range tests {
+		if w, h := parseDimensions(tt.in); w != tt.width || h != tt.height {
+			t.Errorf("parseDimensions(%q) = %d, %d, want %d, %d", tt.in, w, h, tt.width, tt.height)
+		}
+	}
+}
+
+// 提交时解析屏幕和可用区域尺寸, 无法解析时为 0
+func TestCollectParsesScreen(t *testing.T) {
+	_, info := dryRunCollect(t, []byte(`{"userAgent":"Mozilla/5.0","screen":"2560 x 1440","availableScreen":"未知"}`), "")
+	if info.ScreenWidth != 2560 || info.ScreenHeight != 1440 || info.AvailWidth != 0 || info.AvailHeight != 0 {
+		t.Errorf("screen = %dx%d, avail = %dx%d", info.ScreenWidth, info.ScreenHeight, info.AvailWidth, info.AvailHeight)
+	}
+}
+
+// 首页只匹配 "/", 其余未注册路径返回 JSON 404 而不是首页
+func TestRouting(t *testing.T) {
+	if err := renderIndexPage(); err != nil {
+		t.Fatal(err)
+	}
+	mux := newMux(Config{})
+	tests := []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/", http.StatusOK, ""},
+		{"/nonexistent", http.StatusNotFound, "not_found"},
+		{"/index.html", http.StatusNotFound, "not_found"},
+		{"/collectx", http.StatusNotFound, "not_found"},
+		{"/devices/a/b/c", http.StatusNotFound, "not_found"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.path, w.Code, tt.status)
+			continue
+		}
+		if tt.code == "" {
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+				t.Errorf("%s: Content-Type = %q, want text/html", tt.path, ct)
+			}
+			continue
+		}
+		var resp Response
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Errorf("%s: body is not JSON: %q", tt.path, w.Body)
+			continue
+		}
+		if resp.Code != tt.code {
+			t.Errorf("%s: code = %q, want %q", tt.path, resp.Code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 内存看门狗检查间隔
+const memoryCheckInterval = 5 * time.Second
+
+// 内存压力下的降级状态, 降级时跳过可选的补充处理
+var degraded atomic.Bool
+
+// 访问统计和指纹总体是否已因降级被清空: 清空期间不更新, 恢复后从存储重建完成前保持为 true
+var cachesShed atomic.Bool
+
+// 启动内存看门狗: 堆内存超过 limit 字节时进入降级模式, 回落到 limit 的 80% 以下后恢复
+func startMemoryWatchdog(limit uint64) {
+	go func() {
+		ticker := time.NewTicker(memoryCheckInterval)
+		defer ticker.Stop()
+
+		var stats runtime.MemStats
+		for range ticker.C {
+			runtime.ReadMemStats(&stats)
+			checkMemory(stats.HeapAlloc, limit)
+		}
+	}()
+}
+
+// 根据当前堆内存切换降级状态, 留出回差避免在阈值附近反复切换
+func checkMemory(heap, limit uint64) {
+	switch {
+	case heap > limit && !degraded.Load():
+		degraded.Store(true)
+		slog.Warn("内存压力, 进入降级模式", "event", "degraded", "heap_mb", heap>>20, "limit_mb", limit>>20)
+		shedCaches()
+	case heap < limit/10*8 && degraded.Load():
+		degraded.Store(false)
+		slog.Info("内存恢复, 退出降级模式", "event", "recovered", "heap_mb", heap>>20)
+		go rebuildCaches(context.Background())
+	}
+}
+
+// 降级时释放内存中的缓存: 清空访问统计、指纹总体和已完成的幂等记录
+// 只清空可以从存储重建的派生数据, 不丢弃存储中的记录 (内存存储也不例外)
+func shedCaches() {
+	cachesShed.Store(true)
+	deviceStats.Reset()
+	fingerprintPopulation.Reset()
+	idempotencyCache.Clear()
+	runtime.GC()
+	slog.Warn("内存压力, 已清空内存缓存", "event", "degraded_shed")
+}
+
+var errDegradedAgain = errors.New("重建期间再次进入降级模式")
+
+// 同一时间只进行一次重建, 避免重复计入
+var rebuildMutex sync.Mutex
+
+// 恢复后从存储重建访问统计和指纹总体, 重建期间再次降级时放弃
+// 重建期间保存的记录若未被读到则不计入, 统计为近似值
+func rebuildCaches(ctx context.Context) {
+	rebuildMutex.Lock()
+	defer rebuildMutex.Unlock()
+	if !cachesShed.Load() || degraded.Load() {
+		return
+	}
+	if store == nil {
+		cachesShed.Store(false)
+		return
+	}
+	err := store.Iterate(ctx, "", func(info DeviceInfo) error {
+		if degraded.Load() {
+			return errDegradedAgain
+		}
+		deviceStats.Record(info.DeviceID, info.Timestamp)
+		fingerprintPopulation.Add(info)
+		return nil
+	})
+	if err != nil {
+		deviceStats.Reset()
+		fingerprintPopulation.Reset()
+		slog.Warn("重建内存缓存失败", "event", "rebuild_error", "error", err)
+		return
+	}
+	cachesShed.Store(false)
+	slog.Info("已从存储重建内存缓存", "event", "rebuild")
+}
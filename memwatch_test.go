@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDegradedModeShedsCaches(t *testing.T) {
+	rs := NewRingStore(10)
+	useStore(t, rs)
+	for _, id := range []string{"a", "b", "c", "d"} {
+		info := DeviceInfo{DeviceID: id, Timestamp: "2024-01-01 10:00:00", CanvasFingerprint: id}
+		rs.Insert(context.Background(), info)
+		countRecord(info)
+	}
+	entry, _ := idempotencyCache.Begin("k", [32]byte{})
+	idempotencyCache.Complete(entry, DeviceInfo{})
+	t.Cleanup(func() {
+		degraded.Store(false)
+		cachesShed.Store(false)
+		deviceStats.Reset()
+		fingerprintPopulation.Reset()
+		idempotencyCache.Clear()
+	})
+
+	const limit = 100 << 20
+	checkMemory(limit+1, limit)
+	if !degraded.Load() || !cachesShed.Load() {
+		t.Fatal("未进入降级模式")
+	}
+	if _, ok := deviceStats.Get("a"); ok {
+		t.Error("访问统计未清空")
+	}
+	if fingerprintPopulation.total != 0 {
+		t.Error("指纹总体未清空")
+	}
+	if len(idempotencyCache.entries) != 0 {
+		t.Error("幂等缓存未清空")
+	}
+	if got := iterateIDs(t, rs, ""); !equalStrings(got, []string{"a", "b", "c", "d"}) {
+		t.Errorf("降级不应丢弃存储中的记录, 剩余 %v", got)
+	}
+
+	// 降级期间不计入统计, 设备统计接口返回 503, /stats 标记降级
+	countRecord(DeviceInfo{DeviceID: "e", Timestamp: "2024-01-01 11:00:00"})
+	if _, ok := deviceStats.Get("e"); ok {
+		t.Error("降级期间不应计入统计")
+	}
+	req := httptest.NewRequest("GET", "/devices/c/stats", nil)
+	req.SetPathValue("id", "c")
+	w := httptest.NewRecorder()
+	deviceStatsHandler(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("设备统计 status = %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	statsHandler(w, httptest.NewRequest("GET", "/stats", nil))
+	if body := w.Body.String(); !strings.Contains(body, `"degraded":true`) {
+		t.Errorf("/stats 未标记降级: %s", body)
+	}
+
+	// 恢复后从存储重建
+	checkMemory(limit/2, limit)
+	rebuildCaches(context.Background()) // 等待后台重建完成, 已重建时不重复计入
+	if cachesShed.Load() {
+		t.Fatal("未重建")
+	}
+	if st, ok := deviceStats.Get("c"); !ok || st.VisitCount != 1 {
+		t.Errorf("重建后的统计 %+v %v", st, ok)
+	}
+	if _, ok := deviceStats.Get("a"); !ok {
+		t.Error("重建后的统计缺少记录 a")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// Middleware 包装 http.Handler, 用于日志、恢复、CORS 等横切逻辑
+type Middleware func(http.Handler) http.Handler
+
+// 按顺序套用中间件, 第一个位于最外层
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// 捕获处理函数中的 panic, 记录堆栈并返回 500, 避免整个进程退出
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// 标准库用于中断响应的 panic, 交给 net/http 处理
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			slog.ErrorContext(r.Context(), "处理请求时发生 panic", "event", "panic", "path", r.URL.Path,
+				"error", err, "stack", string(debug.Stack()), "status", http.StatusInternalServerError)
+			sendResponse(w, r, http.StatusInternalServerError, Response{
+				Status:  "error",
+				Code:    "internal_error",
+				Message: "服务器内部错误",
+			})
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// 单个请求的处理时限, 超时返回 503 和标准错误响应
+func timeoutHandler(h http.Handler, timeout time.Duration) http.Handler {
+	body, _ := json.Marshal(Response{Status: "error", Code: "timeout", Message: "请求处理超时"})
+	return http.TimeoutHandler(h, timeout, string(body))
+}
+
+// 长连接和大量数据的流式响应 (事件流、导入、导出) 不受服务器读写超时限制
+// 中间件包装后的 ResponseWriter 不支持 Unwrap 时无法清除, 连接仍会在超时后断开, 记录错误便于排查
+func clearDeadlines(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	err := rc.SetReadDeadline(time.Time{})
+	if err == nil {
+		err = rc.SetWriteDeadline(time.Time{})
+	}
+	if err != nil {
+		slog.WarnContext(r.Context(), "无法清除连接超时, 响应可能被截断", "event", "deadline_error", "path", r.URL.Path, "error", err)
+	}
+}
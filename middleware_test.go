@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecoverMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+		code    string
+	}{
+		{"string panic", func(w http.ResponseWriter, r *http.Request) { panic("boom") }, http.StatusInternalServerError, "internal_error"},
+		{"error panic", func(w http.ResponseWriter, r *http.Request) { panic(errors.New("boom")) }, http.StatusInternalServerError, "internal_error"},
+		{"nil map write", func(w http.ResponseWriter, r *http.Request) {
+			var m map[string]int
+			m["x"]++
+		}, http.StatusInternalServerError, "internal_error"},
+		{"no panic", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }, http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		recoverMiddleware(tt.handler).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+		if tt.code == "" {
+			continue
+		}
+		var resp Response
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Status != "error" || resp.Code != tt.code {
+			t.Errorf("%s: body = %s, want code %s", tt.name, w.Body, tt.code)
+		}
+	}
+}
+
+// 服务在 panic 之后继续处理后续请求
+func TestRecoverMiddlewareKeepsServing(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewServer(recoverMiddleware(mux))
+	defer server.Close()
+
+	for _, path := range []string{"/panic", "/ok", "/panic", "/ok"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		resp.Body.Close()
+		want := http.StatusOK
+		if path == "/panic" {
+			want = http.StatusInternalServerError
+		}
+		if resp.StatusCode != want {
+			t.Errorf("%s: status = %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+}
+
+// net/http 用于中断响应的 panic 不被拦截
+func TestRecoverMiddlewareRepanicsAbort(t *testing.T) {
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", err)
+		}
+	}()
+	h := recoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) }))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+// 启用链路追踪时, 经过全部中间件包装后仍能清除连接超时, 否则事件流、导入和导出会在 WriteTimeout 后被断开
+func TestClearDeadlinesThroughMiddleware(t *testing.T) {
+	al, err := NewAccessLogger(filepath.Join(t.TempDir(), "access.log"), RotateConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedLog := accessLog
+	accessLog = al
+	defer func() {
+		accessLog = savedLog
+		al.Close()
+	}()
+
+	for _, tracing := range []bool{false, true} {
+		saved := tracingEnabled
+		tracingEnabled = tracing
+		var readErr, writeErr error
+		mux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			rc := http.NewResponseController(w)
+			readErr = rc.SetReadDeadline(time.Time{})
+			writeErr = rc.SetWriteDeadline(time.Time{})
+		})
+		srv := httptest.NewServer(newHandler(mux, Config{}))
+		tracingEnabled = saved
+
+		resp, err := http.Get(srv.URL)
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if readErr != nil || writeErr != nil {
+			t.Errorf("tracing=%v: SetReadDeadline = %v, SetWriteDeadline = %v", tracing, readErr, writeErr)
+		}
+	}
+}
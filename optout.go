@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+)
+
+// 可按需关闭的探测项及其采集的字段 (JSON 字段名), 名称不区分大小写
+// 嵌入页面时通过 /?disable=geolocation,webrtc 关闭, 前端跳过探测, 服务端同时清除对应字段
+var optOutProbes = []struct {
+	name   string
+	fields []string
+}{
+	{"geolocation", []string{"locationDetails", "lat", "lng"}},
+	{"webrtc", []string{"webrtc"}},
+	{"battery", []string{"battery"}},
+	{"mediadevices", []string{"audioInputs", "videoInputs", "audioOutputs"}},
+	{"canvas", []string{"canvasFingerprint"}},
+	{"webgl", []string{"webglFingerprint", "webglVendor", "webglRenderer"}},
+	{"audio", []string{"audioFingerprint"}},
+	{"fonts", []string{"fontList", "fontFingerprint"}},
+	{"bluetooth", []string{"bluetooth"}},
+}
+
+// DeviceInfo 中按 JSON 字段名索引的字段位置
+var deviceInfoFields = func() map[string]int {
+	fields := make(map[string]int)
+	t := reflect.TypeOf(DeviceInfo{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[name] = i
+	}
+	return fields
+}()
+
+// 合并 disable 查询参数 (逗号分隔) 与提交中的 optedOut, 清除关闭的探测项对应的字段
+// OptedOut 只保留已知的探测项名称, 按 optOutProbes 的顺序排列
+func (info *DeviceInfo) ApplyOptOut(disable string) {
+	requested := make(map[string]bool)
+	for _, name := range append(strings.Split(disable, ","), info.OptedOut...) {
+		requested[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+
+	info.OptedOut = nil
+	v := reflect.ValueOf(info).Elem()
+	for _, probe := range optOutProbes {
+		if !requested[probe.name] {
+			continue
+		}
+		info.OptedOut = append(info.OptedOut, probe.name)
+		for _, name := range probe.fields {
+			field := v.Field(deviceInfoFields[name])
+			field.Set(reflect.Zero(field.Type()))
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import "strings"
+
+// User-Agent 中的操作系统标识与 navigator.platform 可能取值 (前缀) 的对应关系
+// 按顺序匹配: iPhone/iPad 的 UA 同样包含 "Mac OS X", Android 的 UA 同样包含 "Linux"
+var platformTable = []struct {
+	uaToken   string
+	platforms []string
+}{
+	{"iPhone", []string{"iPhone"}},
+	{"iPad", []string{"iPad", "MacIntel"}},
+	{"iPod", []string{"iPod"}},
+	{"Android", []string{"Linux", "Android"}},
+	{"Windows", []string{"Win32", "Win64", "Windows"}},
+	{"Macintosh", []string{"MacIntel", "MacPPC", "Mac68K", "iPad"}},
+	{"CrOS", []string{"Linux"}},
+	{"Linux", []string{"Linux"}},
+}
+
+// 比较客户端上报的 platform 与请求 User-Agent 中的操作系统
+// 返回 ok/mismatch, 无法从 UA 判断操作系统或 platform 为空时返回 unknown
+func checkPlatformConsistency(platform, ua string) string {
+	if platform == "" {
+		return "unknown"
+	}
+	for _, entry := range platformTable {
+		if !strings.Contains(ua, entry.uaToken) {
+			continue
+		}
+		for _, p := range entry.platforms {
+			if strings.HasPrefix(platform, p) {
+				return "ok"
+			}
+		}
+		return "mismatch"
+	}
+	return "unknown"
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestCheckPlatformConsistency(t *testing.T) {
+	const (
+		windowsUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+		macUA     = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15"
+		iPhoneUA  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148"
+		iPadUA    = "Mozilla/5.0 (iPad; CPU OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148"
+		androidUA = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36"
+		linuxUA   = "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0"
+		chromeOS  = "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	)
+	tests := []struct {
+		platform string
+		ua       string
+		want     string
+	}{
+		// 真实组合
+		{"Win32", windowsUA, "ok"},
+		{"MacIntel", macUA, "ok"},
+		{"iPhone", iPhoneUA, "ok"},
+		{"iPad", iPadUA, "ok"},
+		{"MacIntel", iPadUA, "ok"}, // iPadOS 桌面模式
+		{"Linux armv8l", androidUA, "ok"},
+		{"Linux x86_64", linuxUA, "ok"},
+		{"Linux x86_64", chromeOS, "ok"},
+		// 伪造的组合
+		{"Win32", macUA, "mismatch"},
+		{"MacIntel", windowsUA, "mismatch"},
+		{"Win32", iPhoneUA, "mismatch"},
+		{"MacIntel", androidUA, "mismatch"},
+		{"Win32", linuxUA, "mismatch"},
+		// 无法判断
+		{"", windowsUA, "unknown"},
+		{"Win32", "curl/8.4.0", "unknown"},
+		{"Win32", "", "unknown"},
+	}
+	for _, tt := range tests {
+		if got := checkPlatformConsistency(tt.platform, tt.ua); got != tt.want {
+			t.Errorf("checkPlatformConsistency(%q, %q) = %q, want %q", tt.platform, tt.ua, got, tt.want)
+		}
+	}
+}
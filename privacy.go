@@ -0,0 +1,17 @@
+package main
+
+import "net/http"
+
+// 检查客户端的拒绝跟踪信号: DNT 请求头、Sec-GPC 请求头或页面上报的 doNotTrack
+// 返回命中的信号名称, 未设置时返回空字符串
+func optOutSignal(r *http.Request, info DeviceInfo) string {
+	switch {
+	case r.Header.Get("DNT") == "1":
+		return "DNT"
+	case r.Header.Get("Sec-GPC") == "1":
+		return "Sec-GPC"
+	case info.DoNotTrack == "1" || info.DoNotTrack == "yes":
+		return "doNotTrack"
+	}
+	return ""
+}
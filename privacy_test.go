@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// 拒绝跟踪的提交返回 200 和命中的信号, 不保存也不下发设备 Cookie
+func TestOptOutNotStored(t *testing.T) {
+	tests := []struct {
+		name       string
+		headers    []string
+		doNotTrack string
+		respected  string
+	}{
+		{"no signal", nil, "", ""},
+		{"DNT header", []string{"DNT", "1"}, "", "DNT"},
+		{"GPC header", []string{"Sec-GPC", "1"}, "", "Sec-GPC"},
+		{"page reported", nil, "1", "doNotTrack"},
+		{"page reported yes", nil, "yes", "doNotTrack"},
+		{"DNT disabled", []string{"DNT", "0"}, "unspecified", ""},
+	}
+	for _, tt := range tests {
+		s := NewRingStore(10)
+		useStore(t, s)
+		body := `{"userAgent":"Mozilla/5.0","screen":"1920 x 1080","doNotTrack":"` + tt.doNotTrack + `"}`
+		w := postCollect("/collect", body, append([]string{"User-Agent", "Mozilla/5.0"}, tt.headers...)...)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", tt.name, w.Code, w.Body)
+		}
+		var resp struct{ Data DeviceInfo }
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp.Data.Respected != tt.respected {
+			t.Errorf("%s: respected = %q, want %q", tt.name, resp.Data.Respected, tt.respected)
+		}
+
+		optedOut := tt.respected != ""
+		wantStored := 1
+		if optedOut {
+			wantStored = 0
+		}
+		if got := storedCount(t, s); got != wantStored {
+			t.Errorf("%s: stored %d records, want %d", tt.name, got, wantStored)
+		}
+		if cookie := w.Header().Get("Set-Cookie") != ""; cookie == optedOut {
+			t.Errorf("%s: device cookie set = %v", tt.name, cookie)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 单次 Redis 调用的超时, 超时按不可用处理, 避免拖慢请求
+const redisLimitTimeout = 200 * time.Millisecond
+
+// 固定窗口计数: 窗口内首次计数时设置过期时间, 返回当前计数和剩余毫秒数
+// 以脚本执行保证 INCR 与 PEXPIRE 的原子性, 进程崩溃也不会留下永不过期的键
+var redisLimitScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return {n, redis.call('PTTL', KEYS[1])}
+`)
+
+// RedisLimiter 多个副本共享的限流器, 计数保存在 Redis 中
+// Redis 不可用时退回到本进程的内存限流器, 不拒绝请求
+type RedisLimiter struct {
+	client      *redis.Client
+	fallback    *RateLimiter
+	prefix      string // 区分不同限流维度的键前缀
+	unavailable atomic.Bool
+}
+
+// limit 和 window 与 fallback 保持一致
+func NewRedisLimiter(redisURL string, fallback *RateLimiter) (*RedisLimiter, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisLimiter{client: redis.NewClient(opts), fallback: fallback}, nil
+}
+
+// 共用同一 Redis 连接的另一维度限流器, 键加上 prefix 以免与IP限流冲突
+// 返回的限流器无需单独 Close
+func (rl *RedisLimiter) WithFallback(fallback *RateLimiter, prefix string) *RedisLimiter {
+	return &RedisLimiter{client: rl.client, fallback: fallback, prefix: prefix}
+}
+
+func (rl *RedisLimiter) key(ip string) string {
+	return "device-info-collector:ratelimit:" + rl.prefix + ip
+}
+
+func (rl *RedisLimiter) Allow(ip string) bool {
+	if rl.fallback.limit <= 0 {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisLimitTimeout)
+	defer cancel()
+	res, err := redisLimitScript.Run(ctx, rl.client, []string{rl.key(ip)}, rl.fallback.window.Milliseconds()).Int64Slice()
+	if err != nil {
+		rl.markUnavailable(err)
+		return rl.fallback.Allow(ip)
+	}
+	rl.markAvailable()
+	return res[0] <= int64(rl.fallback.limit)
+}
+
+// 固定窗口下需等待到当前窗口结束
+func (rl *RedisLimiter) RetryAfter(ip string) time.Duration {
+	ctx, cancel := context.WithTimeout(context.Background(), redisLimitTimeout)
+	defer cancel()
+	ttl, err := rl.client.PTTL(ctx, rl.key(ip)).Result()
+	if err != nil {
+		rl.markUnavailable(err)
+		return rl.fallback.RetryAfter(ip)
+	}
+	if ttl < 0 {
+		return 0
+	}
+	return ttl
+}
+
+// 删除 Redis 中的计数, 同时删除内存限流器中的计数
+func (rl *RedisLimiter) Forget(key string) error {
+	rl.fallback.Forget(key)
+	ctx, cancel := context.WithTimeout(context.Background(), redisLimitTimeout)
+	defer cancel()
+	return rl.client.Del(ctx, rl.key(key)).Err()
+}
+
+// 只在状态切换时记录日志, 避免 Redis 故障期间每个请求都打日志
+func (rl *RedisLimiter) markUnavailable(err error) {
+	if !rl.unavailable.Swap(true) {
+		slog.Warn("Redis 不可用, 退回内存限流", "event", "redis_unavailable", "error", err)
+	}
+}
+
+func (rl *RedisLimiter) markAvailable() {
+	if rl.unavailable.Swap(false) {
+		slog.Info("Redis 已恢复, 使用共享限流", "event", "redis_recovered")
+	}
+}
+
+// 检查 Redis 连接, 超时与限流调用相同
+func (rl *RedisLimiter) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, redisLimitTimeout)
+	defer cancel()
+	return rl.client.Ping(ctx).Err()
+}
+
+func (rl *RedisLimiter) Close() error {
+	return rl.client.Close()
+}
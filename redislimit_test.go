@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestFallback(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		requests: make(map[string][]time.Time),
+		clock:    newFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)),
+		limit:    limit,
+		window:   window,
+	}
+}
+
+func TestNewRedisLimiterBadURL(t *testing.T) {
+	for _, url := range []string{"", "not-a-url", "http://127.0.0.1:6379"} {
+		if _, err := NewRedisLimiter(url, newTestFallback(2, time.Minute)); err == nil {
+			t.Errorf("NewRedisLimiter(%q) succeeded, want error", url)
+		}
+	}
+}
+
+// Redis 连接失败时按内存限流器计数, 不拒绝请求
+func TestRedisLimiterFallback(t *testing.T) {
+	rl, err := NewRedisLimiter("redis://127.0.0.1:1/0", newTestFallback(2, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.Close()
+
+	for i, want := range []bool{true, true, false} {
+		if got := rl.Allow("192.0.2.1"); got != want {
+			t.Fatalf("request %d: Allow = %v, want %v", i+1, got, want)
+		}
+	}
+	if !rl.unavailable.Load() {
+		t.Error("limiter not marked unavailable")
+	}
+	if got := rl.RetryAfter("192.0.2.1"); got != time.Minute {
+		t.Errorf("RetryAfter = %v, want %v from the fallback", got, time.Minute)
+	}
+	if !rl.Allow("192.0.2.2") {
+		t.Error("other ip limited")
+	}
+
+	// Redis 不可用时删除计数返回错误, 内存中的计数照常删除
+	if err := rl.Forget("192.0.2.1"); err == nil {
+		t.Error("Forget succeeded without redis")
+	}
+	if _, ok := rl.fallback.requests["192.0.2.1"]; ok {
+		t.Error("fallback count not forgotten")
+	}
+}
+
+// 需要真实的 Redis, 通过 REDIS_TEST_URL 指定, 例如 redis://127.0.0.1:6379/15
+func TestRedisLimiterExpiry(t *testing.T) {
+	url := os.Getenv("REDIS_TEST_URL")
+	if url == "" {
+		t.Skip("REDIS_TEST_URL not set")
+	}
+	const window = 300 * time.Millisecond
+	rl, err := NewRedisLimiter(url, newTestFallback(2, window))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.Close()
+	if err := rl.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	read := rl.WithFallback(newTestFallback(1, window), "read:")
+	ip := "test-" + time.Now().Format("150405.000000")
+	defer rl.client.Del(context.Background(), rl.key(ip), read.key(ip))
+
+	for i, want := range []bool{true, true, false} {
+		if got := rl.Allow(ip); got != want {
+			t.Fatalf("request %d: Allow = %v, want %v", i+1, got, want)
+		}
+	}
+	if got := rl.RetryAfter(ip); got <= 0 || got > window {
+		t.Errorf("RetryAfter = %v, want within (0, %v]", got, window)
+	}
+	// 其他维度使用独立的键
+	if !read.Allow(ip) || read.Allow(ip) {
+		t.Error("read limiter shares the ip counter")
+	}
+
+	// 窗口结束后键过期, 计数重新开始
+	time.Sleep(window + 50*time.Millisecond)
+	if n := rl.client.Exists(context.Background(), rl.key(ip)).Val(); n != 0 {
+		t.Error("key not expired")
+	}
+	if got := rl.RetryAfter(ip); got != 0 {
+		t.Errorf("RetryAfter after expiry = %v, want 0", got)
+	}
+	if !rl.Allow(ip) {
+		t.Error("limited after the window expired")
+	}
+	if rl.unavailable.Load() {
+		t.Error("limiter marked unavailable")
+	}
+
+	// 删除设备数据时删除对应的键
+	if err := rl.Forget(ip); err != nil {
+		t.Fatal(err)
+	}
+	if n := rl.client.Exists(context.Background(), rl.key(ip)).Val(); n != 0 {
+		t.Error("key not deleted by Forget")
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// 过期数据清理间隔
+var retentionSweepInterval = time.Hour
+
+// 定期删除超过保留时长的记录, 直到 ctx 结束; 未配置 RETENTION 或存储后端不支持删除时不启动
+// 记录是否过期以 clock 的时间判断
+func startRetentionSweeper(ctx context.Context, clock Clock, interval time.Duration) {
+	purger, ok := store.(Purger)
+	if retention <= 0 || !ok {
+		return
+	}
+	keep := retention
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sweepExpired(purger, clock.Now(), keep)
+			}
+		}
+	}()
+}
+
+// 删除已过期的记录
+// 优先使用记录中保存的过期时间, 没有时按时间戳加保留时长 keep 计算
+func sweepExpired(purger Purger, now time.Time, keep time.Duration) {
+	removed, err := purger.Purge(context.Background(), func(info DeviceInfo) bool {
+		if info.ExpiresAt != "" {
+			t, err := time.ParseInLocation("2006-01-02 15:04:05", info.ExpiresAt, time.Local)
+			return err == nil && !now.Before(t)
+		}
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", info.Timestamp, time.Local)
+		return err == nil && now.Sub(t) >= keep
+	})
+	if err != nil {
+		slog.Error("清理过期数据失败", "event", "retention_error", "error", err)
+		return
+	}
+	if removed > 0 {
+		slog.Info("已清理过期数据", "event", "retention_sweep", "removed", removed)
+	}
+}
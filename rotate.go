@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// RotateConfig 追加写入文件 (LOG_FILE 和 ACCESS_LOG) 的轮转策略
+type RotateConfig struct {
+	MaxSizeMB  int  // 超过该大小 (MB) 时轮转, 0 表示不按大小轮转
+	Daily      bool // 每天本地时间零点轮转
+	MaxBackups int  // 保留的旧文件数, 0 表示全部保留
+	Compress   bool // 以 gzip 压缩旧文件
+}
+
+func (rc RotateConfig) enabled() bool {
+	return rc.MaxSizeMB > 0 || rc.Daily
+}
+
+// 只按天轮转时的大小上限 (MB), 实际不会达到
+const unlimitedLogSizeMB = 1 << 20
+
+// 打开追加写入的文件; 启用轮转时旧文件重命名为 name-<时间>.ext 保存在同一目录
+// 返回的 Writer 可被多个 goroutine 并发写入, 单次 Write 不会被拆到两个文件中
+// 按天轮转以 clock 的时间为准, 在零点后的第一次写入时进行
+func openLogFile(path string, rc RotateConfig, clock Clock) (io.WriteCloser, error) {
+	if !rc.enabled() {
+		return os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	}
+
+	// lumberjack 在首次写入时才创建文件, 先创建以便立即发现权限问题, 就绪检查也能找到文件
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	maxSize := rc.MaxSizeMB
+	if maxSize <= 0 {
+		maxSize = unlimitedLogSizeMB
+	}
+	rf := &rotatingFile{
+		Logger: &lumberjack.Logger{
+			Filename:   path,
+			MaxSize:    maxSize,
+			MaxBackups: rc.MaxBackups,
+			LocalTime:  true,
+			Compress:   rc.Compress,
+		},
+		daily: rc.Daily,
+		clock: clock,
+	}
+	rf.next = nextMidnight(clock.Now())
+	return rf, nil
+}
+
+// rotatingFile 按大小自动轮转, 可选每天轮转
+type rotatingFile struct {
+	*lumberjack.Logger
+	daily bool
+	clock Clock
+	next  time.Time // 下一次按天轮转的时间
+	mutex sync.Mutex
+}
+
+// 写入前检查是否已跨过零点, 轮转与写入在同一把锁内完成, 不会与存储的改写并发
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	if rf.daily {
+		rf.mutex.Lock()
+		defer rf.mutex.Unlock()
+		if now := rf.clock.Now(); !now.Before(rf.next) {
+			if err := rf.Rotate(); err != nil {
+				slog.Error("轮转日志文件失败", "event", "rotate_error", "file", rf.Filename, "error", err)
+			}
+			rf.next = nextMidnight(now)
+		}
+	}
+	return rf.Logger.Write(p)
+}
+
+// t 之后的下一个本地时间零点
+func nextMidnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDailyRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "devices.jsonl")
+	clock := newFakeClock(time.Date(2024, 1, 1, 23, 59, 0, 0, time.Local))
+
+	out, err := openLogFile(path, RotateConfig{Daily: true}, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	steps := []struct {
+		advance time.Duration
+		line    string
+		backups int
+	}{
+		{0, "a\n", 0},
+		{30 * time.Second, "b\n", 0},
+		{time.Minute, "c\n", 1}, // 跨过零点
+		{time.Hour, "d\n", 1},
+		{24 * time.Hour, "e\n", 2},
+	}
+	for _, step := range steps {
+		clock.Advance(step.advance)
+		if _, err := out.Write([]byte(step.line)); err != nil {
+			t.Fatal(err)
+		}
+		backups, _ := filepath.Glob(filepath.Join(dir, "devices-*.jsonl"))
+		if len(backups) != step.backups {
+			t.Fatalf("写入 %q 后有 %d 个旧文件, want %d", step.line, len(backups), step.backups)
+		}
+		// lumberjack 以毫秒时间命名旧文件, 避免同名
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "e\n" {
+		t.Fatalf("当前文件内容 %q, want %q", data, "e\n")
+	}
+}
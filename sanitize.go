@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 单个字符串字段的最大长度 (字节, MAX_FIELD_LENGTH 环境变量)
+var maxFieldLength = 2048
+
+// 清理客户端提交的字符串字段: 去掉空字节等控制字符和非法 UTF-8, 超长的截断到 maxFieldLength
+// 覆盖所有字符串字段以及字符串切片和映射中的值, 保护日志和下游消费者
+func (info *DeviceInfo) Sanitize() {
+	v := reflect.ValueOf(info).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(sanitizeString(field.String()))
+		case reflect.Slice:
+			if field.Type().Elem().Kind() == reflect.String {
+				for j := 0; j < field.Len(); j++ {
+					field.Index(j).SetString(sanitizeString(field.Index(j).String()))
+				}
+			}
+		case reflect.Map:
+			if field.Type().Elem().Kind() == reflect.String {
+				for _, key := range field.MapKeys() {
+					field.SetMapIndex(key, reflect.ValueOf(sanitizeString(field.MapIndex(key).String())))
+				}
+			}
+		}
+	}
+}
+
+func sanitizeString(s string) string {
+	s = strings.ToValidUTF8(s, "")
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+	if len(s) <= maxFieldLength {
+		return s
+	}
+	// 按字符边界截断, 避免截出半个多字节字符
+	end := maxFieldLength
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return s[:end]
+}
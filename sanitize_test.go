@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeString(t *testing.T) {
+	saved := maxFieldLength
+	maxFieldLength = 8
+	defer func() { maxFieldLength = saved }()
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"unchanged", "Mozilla", "Mozilla"},
+		{"null bytes", "Moz\x00il\x00la", "Mozilla"},
+		{"control characters", "a\tb\r\nc\x1b[0m\x7f", "abc[0m"},
+		{"invalid utf-8", "ab\xff\xfecd", "abcd"},
+		{"truncated", strings.Repeat("x", 20), strings.Repeat("x", 8)},
+		{"exact length", strings.Repeat("x", 8), strings.Repeat("x", 8)},
+		// "中" 占 3 字节, 截断时不能留下半个字符
+		{"multibyte boundary", "ab中文字", "ab中文"},
+		{"stripped before truncation", "\x00\x00\x00abcdefgh", "abcdefgh"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeString(tt.in); got != tt.want {
+			t.Errorf("%s: sanitizeString(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+// 字符串切片中的值同样被清理
+func TestSanitizeDeviceInfo(t *testing.T) {
+	info := DeviceInfo{
+		UserAgent: "Mozilla/5.0\x00" + strings.Repeat("A", 10*maxFieldLength),
+		Platform:  "Linux\x00x86_64",
+		Languages: []string{"zh-CN\x00", "en\r\n"},
+	}
+	info.Sanitize()
+	if len(info.UserAgent) != maxFieldLength || strings.ContainsRune(info.UserAgent, 0) {
+		t.Errorf("UserAgent length = %d, contains null = %v", len(info.UserAgent), strings.ContainsRune(info.UserAgent, 0))
+	}
+	if info.Platform != "Linuxx86_64" {
+		t.Errorf("Platform = %q", info.Platform)
+	}
+	if !equalStrings(info.Languages, []string{"zh-CN", "en"}) {
+		t.Errorf("Languages = %q", info.Languages)
+	}
+}
+
+// 提交接口在存储前清理字段
+func TestCollectSanitizes(t *testing.T) {
+	body, _ := json.Marshal(map[string]any{
+		"userAgent": "Mozilla/5.0\x00" + strings.Repeat("A", maxBodySize/2),
+		"screen":    "1920x1080\x00",
+		"timezone":  "Asia/Shanghai\x1b",
+	})
+	_, info := dryRunCollect(t, body, "")
+	if len(info.UserAgent) != maxFieldLength || strings.ContainsRune(info.UserAgent, 0) {
+		t.Errorf("UserAgent length = %d", len(info.UserAgent))
+	}
+	if info.Screen != "1920x1080" || info.Timezone != "Asia/Shanghai" {
+		t.Errorf("screen = %q, timezone = %q", info.Screen, info.Timezone)
+	}
+}
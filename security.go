@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+)
+
+// 是否发送安全响应头, 本地调试时可通过 SECURITY_HEADERS=false 关闭
+var securityHeaders = true
+
+// 首页内联脚本的 CSP 哈希源 ('sha256-...'), 由 renderIndexPage 计算
+// 首页内容固定, 用哈希代替每个请求的 nonce, 304 复用缓存的页面时脚本仍能通过 CSP
+var scriptHashSource string
+
+// 计算页面中内联脚本 (<script>...</script>) 内容的 CSP 哈希源, 没有内联脚本时返回空字符串
+func cspScriptHash(page []byte) string {
+	_, rest, ok := bytes.Cut(page, []byte("<script>"))
+	if !ok {
+		return ""
+	}
+	script, _, ok := bytes.Cut(rest, []byte("</script>"))
+	if !ok {
+		return ""
+	}
+	sum := sha256.Sum256(script)
+	return "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+}
+
+// 设置安全响应头; 只允许执行首页的内联脚本
+func securityHeadersMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !securityHeaders {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scriptSrc := scriptHashSource
+		if scriptSrc == "" {
+			scriptSrc = "'none'"
+		}
+
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "no-referrer")
+		// 页面自身的内联 style 属性需要 unsafe-inline
+		h.Set("Content-Security-Policy", "default-src 'none'; "+
+			"script-src "+scriptSrc+"; "+
+			"style-src 'self' 'unsafe-inline'; "+
+			"img-src 'self' data:; "+
+			"connect-src 'self'; "+
+			"base-uri 'none'; form-action 'none'; frame-ancestors 'none'")
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// CSP 只放行内联 <script> 的哈希, 内联事件处理属性 (onclick 等) 会被浏览器拦截
+func TestIndexPageHasNoInlineEventHandlers(t *testing.T) {
+	if err := renderIndexPage(); err != nil {
+		t.Fatal(err)
+	}
+	if loc := regexp.MustCompile(`(?i)<[^>]*\son[a-z]+\s*=`).FindIndex(indexPage.body); loc != nil {
+		t.Fatalf("首页含有内联事件处理属性: %s", indexPage.body[loc[0]:loc[1]])
+	}
+	if strings.Count(string(indexPage.body), "<script") != 1 {
+		t.Fatal("CSP 哈希只覆盖第一个内联脚本")
+	}
+}
+
+// 请求签名密钥只发给受信任的客户端, 不出现在公开的首页中
+func TestIndexPageOmitsSigningSecret(t *testing.T) {
+	const secret = "index-page-signing-secret"
+	saved := signingSecret
+	signingSecret = []byte(secret)
+	defer func() {
+		signingSecret = saved
+		renderIndexPage()
+	}()
+	if err := renderIndexPage(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(indexPage.body), secret) {
+		t.Fatal("首页中含有请求签名密钥")
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	if err := renderIndexPage(); err != nil {
+		t.Fatal(err)
+	}
+	handler := securityHeadersMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name    string
+		enabled bool
+		want    map[string]string
+	}{
+		{"enabled", true, map[string]string{
+			"X-Content-Type-Options": "nosniff",
+			"X-Frame-Options":        "DENY",
+			"Referrer-Policy":        "no-referrer",
+		}},
+		{"disabled", false, map[string]string{
+			"X-Content-Type-Options":  "",
+			"Content-Security-Policy": "",
+		}},
+	}
+	saved := securityHeaders
+	defer func() { securityHeaders = saved }()
+	for _, tt := range tests {
+		securityHeaders = tt.enabled
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		for name, value := range tt.want {
+			if got := w.Header().Get(name); got != value {
+				t.Errorf("%s: %s = %q, want %q", tt.name, name, got, value)
+			}
+		}
+		csp := w.Header().Get("Content-Security-Policy")
+		if tt.enabled && !strings.Contains(csp, "script-src "+scriptHashSource+";") {
+			t.Errorf("%s: CSP = %q", tt.name, csp)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// 判定为相似设备的最低相似度 (SIMILARITY_THRESHOLD 环境变量, 0~1)
+var similarityThreshold = 0.7
+
+// 参与相似度比较的指纹组成部分
+// 浏览器升级等只会改变其中少数几项, 多数项仍然一致
+func similarityComponents(info DeviceInfo) []string {
+	return []string{
+		info.CanvasFingerprint,
+		info.WebGLFingerprint,
+		info.FontFingerprint,
+		info.AudioFingerprint,
+		info.LanguageFingerprint,
+		info.Screen,
+		info.ColorDepth,
+		info.PixelRatio,
+		info.Platform,
+		info.Timezone,
+		info.HardwareConcurrency,
+		info.DeviceMemory,
+		info.GPUModel,
+	}
+}
+
+// 计算两条记录的相似度: 双方都有值的组成部分中取值相同的比例
+// 没有可比较的部分时返回 0
+func Similarity(a, b DeviceInfo) float64 {
+	ca, cb := similarityComponents(a), similarityComponents(b)
+	compared, matched := 0, 0
+	for i := range ca {
+		va, vb := strings.TrimSpace(ca[i]), strings.TrimSpace(cb[i])
+		if va == "" || vb == "" {
+			continue
+		}
+		compared++
+		if va == vb {
+			matched++
+		}
+	}
+	if compared == 0 {
+		return 0
+	}
+	return float64(matched) / float64(compared)
+}
+
+// SimilarDevice 相似设备及其相似度
+type SimilarDevice struct {
+	Similarity float64    `json:"similarity" xml:"similarity"`
+	Device     DeviceInfo `json:"device" xml:"device"`
+}
+
+// 查找与指定设备相似的其他设备: GET /devices/similar?id=<deviceId>&limit=N
+// 每个设备取最近一条记录参与比较, 按相似度从高到低排列
+func similarDevicesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		sendResponse(w, r, http.StatusMethodNotAllowed, Response{
+			Status:  "error",
+			Code:    "method_not_allowed",
+			Message: "Only GET method is allowed",
+		})
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		sendResponse(w, r, http.StatusBadRequest, Response{
+			Status:  "error",
+			Code:    "invalid_param",
+			Message: "缺少 id 参数",
+		})
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultPageLimit)
+	if err != nil {
+		sendResponse(w, r, http.StatusBadRequest, Response{
+			Status:  "error",
+			Code:    "invalid_param",
+			Message: "limit 必须是非负整数",
+		})
+		return
+	}
+
+	if store == nil {
+		sendResponse(w, r, http.StatusNotFound, Response{
+			Status:  "error",
+			Code:    "not_enabled",
+			Message: "设备存储未启用",
+		})
+		return
+	}
+
+	records, err := store.List(r.Context(), 0, 0)
+	if err != nil {
+		sendResponse(w, r, http.StatusInternalServerError, Response{
+			Status:  "error",
+			Code:    "storage_error",
+			Message: "读取设备信息失败: " + err.Error(),
+		})
+		return
+	}
+
+	// 记录按时间从新到旧, 每个设备只保留第一次出现的记录
+	latest := make(map[string]DeviceInfo)
+	var order []string
+	for _, info := range records {
+		if _, ok := latest[info.DeviceID]; !ok {
+			latest[info.DeviceID] = info
+			order = append(order, info.DeviceID)
+		}
+	}
+	target, ok := latest[id]
+	if !ok {
+		sendResponse(w, r, http.StatusNotFound, Response{
+			Status:  "error",
+			Code:    "not_found",
+			Message: "设备不存在",
+		})
+		return
+	}
+
+	similar := []SimilarDevice{}
+	for _, deviceID := range order {
+		if deviceID == id {
+			continue
+		}
+		score := Similarity(target, latest[deviceID])
+		if score >= similarityThreshold {
+			similar = append(similar, SimilarDevice{Similarity: score, Device: latest[deviceID]})
+		}
+	}
+	sort.SliceStable(similar, func(i, j int) bool {
+		return similar[i].Similarity > similar[j].Similarity
+	})
+	if limit < len(similar) {
+		similar = similar[:limit]
+	}
+
+	sendResponse(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: "获取相似设备成功",
+		Data:    similar,
+	})
+}
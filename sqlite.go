@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLiteStore SQLite 存储, 完整记录以 JSON 保存在 data 列中
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS devices (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp  TEXT NOT NULL,
+	device_id  TEXT NOT NULL DEFAULT '',
+	ip_address TEXT NOT NULL DEFAULT '',
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_devices_timestamp ON devices (timestamp);
+CREATE INDEX IF NOT EXISTS idx_devices_device_id ON devices (device_id);
+`
+
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite 同一时间只允许一个写入者, 单连接避免 SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Insert(ctx context.Context, info DeviceInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO devices (timestamp, device_id, ip_address, data) VALUES (?, ?, ?, ?)`,
+		info.Timestamp, info.DeviceID, info.IPAddress, string(data))
+	if sqliteTransient(err) {
+		return transientStorageError(err)
+	}
+	return err
+}
+
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// 数据库繁忙或被锁 (超过 busy_timeout)、磁盘已满和 I/O 错误可重试; 扩展错误码的低 8 位为主错误码
+func sqliteTransient(err error) bool {
+	var e *sqlite.Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED, sqlite3.SQLITE_FULL, sqlite3.SQLITE_IOERR:
+		return true
+	}
+	return false
+}
+
+func (s *SQLiteStore) List(ctx context.Context, limit, offset int) ([]DeviceInfo, error) {
+	return s.Find(ctx, DeviceFilter{}, limit, offset)
+}
+
+// 过滤条件转换为 WHERE 子句; 前缀匹配使用 LIKE (对 ASCII 不区分大小写), 转义其中的通配符
+func (s *SQLiteStore) Find(ctx context.Context, filter DeviceFilter, limit, offset int) ([]DeviceInfo, error) {
+	var where []string
+	var args []any
+	prefix := func(field, value string) {
+		if value != "" {
+			where = append(where, `json_extract(data, '$.`+field+`') LIKE ? ESCAPE '\'`)
+			args = append(args, likeEscaper.Replace(value)+"%")
+		}
+	}
+	equal := func(field, value string) {
+		if value != "" {
+			where = append(where, `json_extract(data, '$.`+field+`') = ? COLLATE NOCASE`)
+			args = append(args, value)
+		}
+	}
+	prefix("osVersion", filter.OS)
+	prefix("browserVersion", filter.Browser)
+	equal("geoCountry", filter.Country)
+	equal("deviceType", filter.DeviceType)
+	if filter.IP != "" {
+		where = append(where, `ip_address = ?`)
+		args = append(args, filter.IP)
+	}
+
+	query := `SELECT data FROM devices`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	// SQLite 中 LIMIT -1 表示不限制
+	if limit <= 0 {
+		limit = -1
+	}
+	query += ` ORDER BY timestamp DESC, id DESC LIMIT ? OFFSET ?`
+	args = append(args, limit, offset)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]DeviceInfo, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var info DeviceInfo
+		if err := json.Unmarshal([]byte(data), &info); err != nil {
+			continue
+		}
+		records = append(records, info)
+	}
+	return records, rows.Err()
+}
+
+// 逐页读取时每页的记录数
+const sqliteIteratePageSize = 500
+
+// 按 id 分页读取, 每页读完即释放连接再调用 fn, 慢速的调用方不会长时间占用唯一的数据库连接
+func (s *SQLiteStore) Iterate(ctx context.Context, since string, fn func(DeviceInfo) error) error {
+	var lastID int64
+	for {
+		rows, err := s.db.QueryContext(ctx,
+			`SELECT id, data FROM devices WHERE id > ? AND timestamp >= ? ORDER BY id LIMIT ?`,
+			lastID, since, sqliteIteratePageSize)
+		if err != nil {
+			return err
+		}
+		page := make([]DeviceInfo, 0, sqliteIteratePageSize)
+		n := 0
+		for rows.Next() {
+			var data string
+			if err := rows.Scan(&lastID, &data); err != nil {
+				rows.Close()
+				return err
+			}
+			n++
+			var info DeviceInfo
+			if err := json.Unmarshal([]byte(data), &info); err != nil {
+				continue
+			}
+			page = append(page, info)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, info := range page {
+			if err := fn(info); err != nil {
+				return err
+			}
+		}
+		if n < sqliteIteratePageSize {
+			return nil
+		}
+	}
+}
+
+// 在一次分组查询中统计: 内层按 device_id 统计不同的设备数, 外层按设备数统计指纹数
+func (s *SQLiteStore) AnonymitySetSizes(ctx context.Context, since string) (map[int]int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT size, COUNT(*) FROM (
+			SELECT COUNT(DISTINCT COALESCE(NULLIF(json_extract(data, '$.cookieId'), ''), 'row:' || id)) AS size
+			FROM devices
+			WHERE device_id != '' AND timestamp >= ?
+			GROUP BY device_id
+		)
+		GROUP BY size`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sizes := make(map[int]int)
+	for rows.Next() {
+		var size, n int
+		if err := rows.Scan(&size, &n); err != nil {
+			return nil, err
+		}
+		sizes[size] = n
+	}
+	return sizes, rows.Err()
+}
+
+// 时间段在 SQL 中计算: timestamp 按 UTC 解析为秒数后按 interval 取整, 与 bucketRecords 一致
+func (s *SQLiteStore) CountByInterval(ctx context.Context, interval time.Duration, since string) ([]TimeBucket, error) {
+	seconds := int64(interval / time.Second)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT datetime(CAST(strftime('%s', timestamp) AS INTEGER) / ? * ?, 'unixepoch') AS bucket, COUNT(*)
+		FROM devices
+		WHERE timestamp >= ?
+		GROUP BY bucket
+		ORDER BY bucket`, seconds, seconds, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := make([]TimeBucket, 0)
+	for rows.Next() {
+		var b TimeBucket
+		if err := rows.Scan(&b.Bucket, &b.Count); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, rows.Err()
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (s *SQLiteStore) Delete(ctx context.Context, deviceID, cookieID string) (int, error) {
+	query := `DELETE FROM devices WHERE device_id = ?`
+	args := []any{deviceID}
+	if cookieID != "" {
+		query += ` OR json_extract(data, '$.cookieId') = ?`
+		args = append(args, cookieID)
+	}
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (s *SQLiteStore) Purge(ctx context.Context, expired func(DeviceInfo) bool) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, data FROM devices`)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var data string
+		if err := rows.Scan(&id, &data); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		var info DeviceInfo
+		if err := json.Unmarshal([]byte(data), &info); err == nil && expired(info) {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM devices WHERE id = ?`, id); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// 在一个事务中合并同一 DeviceID 的记录: 改写最新的一行, 删除其余行
+func (s *SQLiteStore) Compact(ctx context.Context) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, data FROM devices WHERE device_id != '' ORDER BY timestamp, id`)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	var records []DeviceInfo
+	for rows.Next() {
+		var id int64
+		var data string
+		if err := rows.Scan(&id, &data); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		var info DeviceInfo
+		if err := json.Unmarshal([]byte(data), &info); err == nil {
+			ids = append(ids, id)
+			records = append(records, info)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	merged, removed := planCompaction(records)
+	for i, info := range merged {
+		data, err := json.Marshal(info)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE devices SET data = ? WHERE id = ?`, string(data), ids[i]); err != nil {
+			return 0, err
+		}
+	}
+	for _, i := range removed {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM devices WHERE id = ?`, ids[i]); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(removed), nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
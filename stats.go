@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// DeviceStats 单个设备的访问统计
+type DeviceStats struct {
+	DeviceID   string `json:"deviceId" xml:"deviceId"`
+	FirstSeen  string `json:"firstSeen" xml:"firstSeen"`
+	LastSeen   string `json:"lastSeen" xml:"lastSeen"`
+	VisitCount int    `json:"visitCount" xml:"visitCount"`
+}
+
+// DeviceStatsStore 按 DeviceID 汇总的访问统计, 保存在内存中
+// 配置了 LOG_FILE 时启动时从已保存的记录重建
+type DeviceStatsStore struct {
+	stats map[string]*DeviceStats
+	mutex sync.RWMutex
+}
+
+var deviceStats = NewDeviceStatsStore()
+
+func NewDeviceStatsStore() *DeviceStatsStore {
+	return &DeviceStatsStore{stats: make(map[string]*DeviceStats)}
+}
+
+// 记录一次访问: 新设备创建统计, 已知设备累加次数并按记录时间更新首次和最后访问时间
+// 导入和重建时记录不一定按时间顺序到达; 时间戳为 "2006-01-02 15:04:05" 格式, 按字符串比较即按时间比较
+func (s *DeviceStatsStore) Record(deviceID, timestamp string) {
+	if deviceID == "" {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	st, exists := s.stats[deviceID]
+	if !exists {
+		st = &DeviceStats{DeviceID: deviceID, FirstSeen: timestamp}
+		s.stats[deviceID] = st
+	}
+	if timestamp != "" && (st.FirstSeen == "" || timestamp < st.FirstSeen) {
+		st.FirstSeen = timestamp
+	}
+	if timestamp > st.LastSeen {
+		st.LastSeen = timestamp
+	}
+	st.VisitCount++
+}
+
+// 清空全部统计
+func (s *DeviceStatsStore) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.stats = make(map[string]*DeviceStats)
+}
+
+// 查询设备统计
+func (s *DeviceStatsStore) Get(deviceID string) (DeviceStats, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	st, exists := s.stats[deviceID]
+	if !exists {
+		return DeviceStats{}, false
+	}
+	return *st, true
+}
+
+// 删除设备统计, 设备不存在时不做任何事
+func (s *DeviceStatsStore) Delete(deviceID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.stats, deviceID)
+}
+
+// 查看单个设备的访问统计: GET /devices/{id}/stats
+func deviceStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		sendResponse(w, r, http.StatusMethodNotAllowed, Response{
+			Status:  "error",
+			Code:    "method_not_allowed",
+			Message: "Only GET method is allowed",
+		})
+		return
+	}
+
+	if cachesShed.Load() {
+		sendResponse(w, r, http.StatusServiceUnavailable, Response{
+			Status:  "error",
+			Code:    "degraded",
+			Message: "内存压力降级中, 设备统计暂不可用",
+		})
+		return
+	}
+
+	st, ok := deviceStats.Get(r.PathValue("id"))
+	if !ok {
+		sendResponse(w, r, http.StatusNotFound, Response{
+			Status:  "error",
+			Code:    "not_found",
+			Message: "设备不存在",
+		})
+		return
+	}
+
+	sendResponse(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: "获取设备统计成功",
+		Data:    st,
+	})
+}
+
+// SubmissionStats 提交记录汇总
+type SubmissionStats struct {
+	Total          int         `json:"total" xml:"total"`
+	UniqueIPs      int         `json:"uniqueIPs" xml:"uniqueIPs"`
+	OSVersion      XMLMap[int] `json:"osVersion" xml:"osVersion"`
+	BrowserVersion XMLMap[int] `json:"browserVersion" xml:"browserVersion"`
+	DeviceType     XMLMap[int] `json:"deviceType" xml:"deviceType"`
+	Resolution     XMLMap[int] `json:"resolution" xml:"resolution"`
+	// 服务是否处于内存压力降级模式
+	Degraded bool `json:"degraded" xml:"degraded"`
+}
+
+// 逐条累加提交记录的汇总, 不需要一次性载入全部记录
+type statsAggregator struct {
+	stats SubmissionStats
+	ips   map[string]bool
+}
+
+func newStatsAggregator() *statsAggregator {
+	return &statsAggregator{
+		stats: SubmissionStats{
+			OSVersion:      make(map[string]int),
+			BrowserVersion: make(map[string]int),
+			DeviceType:     make(map[string]int),
+			Resolution:     make(map[string]int),
+		},
+		ips: make(map[string]bool),
+	}
+}
+
+func (a *statsAggregator) Add(info DeviceInfo) {
+	a.stats.Total++
+	a.ips[info.IPAddress] = true
+	a.stats.OSVersion[info.OSVersion]++
+	a.stats.BrowserVersion[info.BrowserVersion]++
+	a.stats.DeviceType[info.DeviceType]++
+	if info.ScreenWidth > 0 {
+		a.stats.Resolution[fmt.Sprintf("%dx%d", info.ScreenWidth, info.ScreenHeight)]++
+	} else {
+		a.stats.Resolution["未知"]++
+	}
+}
+
+func (a *statsAggregator) Result() SubmissionStats {
+	a.stats.UniqueIPs = len(a.ips)
+	return a.stats
+}
+
+// 提交记录汇总: GET /stats?since=RFC3339
+// 在 store.Iterate 中逐条汇总, 每次请求的内存占用与记录总数无关
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	since, ok := sinceQuery(w, r)
+	if !ok {
+		return
+	}
+
+	agg := newStatsAggregator()
+	err := store.Iterate(r.Context(), since, func(info DeviceInfo) error {
+		agg.Add(info)
+		return nil
+	})
+	if err != nil {
+		sendResponse(w, r, http.StatusInternalServerError, Response{
+			Status:  "error",
+			Code:    "storage_error",
+			Message: "读取设备信息失败: " + err.Error(),
+		})
+		return
+	}
+
+	stats := agg.Result()
+	stats.Degraded = degraded.Load()
+	sendResponse(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: "获取统计成功",
+		Data:    stats,
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeviceStatsRecordOutOfOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		timestamps []string
+		first      string
+		last       string
+	}{
+		{"in order", []string{"2024-01-01 10:00:00", "2024-01-02 10:00:00", "2024-01-03 10:00:00"},
+			"2024-01-01 10:00:00", "2024-01-03 10:00:00"},
+		{"older record imported later", []string{"2024-01-02 10:00:00", "2024-01-03 10:00:00", "2024-01-01 10:00:00"},
+			"2024-01-01 10:00:00", "2024-01-03 10:00:00"},
+		{"newest first", []string{"2024-01-03 10:00:00", "2024-01-02 10:00:00", "2024-01-01 10:00:00"},
+			"2024-01-01 10:00:00", "2024-01-03 10:00:00"},
+		{"missing timestamp", []string{"", "2024-01-02 10:00:00", ""},
+			"2024-01-02 10:00:00", "2024-01-02 10:00:00"},
+	}
+	for _, tt := range tests {
+		s := NewDeviceStatsStore()
+		for _, ts := range tt.timestamps {
+			s.Record("d1", ts)
+		}
+		st, ok := s.Get("d1")
+		if !ok {
+			t.Fatalf("%s: device not recorded", tt.name)
+		}
+		if st.FirstSeen != tt.first || st.LastSeen != tt.last || st.VisitCount != len(tt.timestamps) {
+			t.Errorf("%s: got %+v, want first=%s last=%s visits=%d", tt.name, st, tt.first, tt.last, len(tt.timestamps))
+		}
+	}
+}
+
+// /stats 逐条汇总, since 之前的记录不计入
+func TestStatsHandler(t *testing.T) {
+	since, _ := time.ParseInLocation("2006-01-02 15:04:05", "2024-01-02 00:00:00", time.Local)
+	for name, s := range newTestStores(t) {
+		for _, info := range []DeviceInfo{
+			{DeviceID: "a", Timestamp: "2024-01-01 10:00:00", IPAddress: "192.0.2.1", OSVersion: "Windows 10", DeviceType: "桌面设备"},
+			{DeviceID: "b", Timestamp: "2024-01-02 10:00:00", IPAddress: "192.0.2.2", OSVersion: "iOS 17", DeviceType: "移动设备", ScreenWidth: 390, ScreenHeight: 844},
+			{DeviceID: "c", Timestamp: "2024-01-03 10:00:00", IPAddress: "192.0.2.2", OSVersion: "iOS 17", DeviceType: "移动设备"},
+		} {
+			s.Insert(context.Background(), info)
+		}
+		useStore(t, s)
+
+		tests := []struct {
+			query string
+			want  SubmissionStats
+		}{
+			{"", SubmissionStats{Total: 3, UniqueIPs: 2,
+				OSVersion:  XMLMap[int]{"Windows 10": 1, "iOS 17": 2},
+				DeviceType: XMLMap[int]{"桌面设备": 1, "移动设备": 2},
+				Resolution: XMLMap[int]{"390x844": 1, "未知": 2}}},
+			{"?since=" + since.Format(time.RFC3339), SubmissionStats{Total: 2, UniqueIPs: 1,
+				OSVersion:  XMLMap[int]{"iOS 17": 2},
+				DeviceType: XMLMap[int]{"移动设备": 2},
+				Resolution: XMLMap[int]{"390x844": 1, "未知": 1}}},
+		}
+		for _, tt := range tests {
+			w := httptest.NewRecorder()
+			statsHandler(w, httptest.NewRequest("GET", "/stats"+tt.query, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s%s: status = %d: %s", name, tt.query, w.Code, w.Body)
+			}
+			var resp struct{ Data SubmissionStats }
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			got := resp.Data
+			if got.Total != tt.want.Total || got.UniqueIPs != tt.want.UniqueIPs ||
+				!maps.Equal(got.OSVersion, tt.want.OSVersion) || !maps.Equal(got.DeviceType, tt.want.DeviceType) ||
+				!maps.Equal(got.Resolution, tt.want.Resolution) {
+				t.Errorf("%s%s: stats = %+v, want %+v", name, tt.query, got, tt.want)
+			}
+		}
+	}
+}
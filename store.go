@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Store 设备信息存储后端
+type Store interface {
+	// 保存一条记录
+	Insert(ctx context.Context, info DeviceInfo) error
+	// 按时间从新到旧分页读取, limit <= 0 时返回 offset 之后的全部记录
+	List(ctx context.Context, limit, offset int) ([]DeviceInfo, error)
+	// 与 List 相同, 只返回满足 filter 的记录, 分页在过滤之后进行
+	Find(ctx context.Context, filter DeviceFilter, limit, offset int) ([]DeviceInfo, error)
+	// 按写入顺序 (从旧到新) 逐条读取 timestamp 不早于 since 的记录 (since 为空时读取全部), 不一次性载入内存
+	// fn 返回错误时停止读取并返回该错误
+	Iterate(ctx context.Context, since string, fn func(DeviceInfo) error) error
+	// 删除 DeviceID 为 deviceID 的记录, cookieID 非空时同时删除 CookieID 为 cookieID 的记录, 返回删除的条数
+	Delete(ctx context.Context, deviceID, cookieID string) (int, error)
+	Close() error
+}
+
+// Purger 支持按条件删除记录的存储后端, 数据保留清理依赖此接口
+type Purger interface {
+	// 删除 expired 返回 true 的记录, 返回删除的条数
+	Purge(ctx context.Context, expired func(DeviceInfo) bool) (int, error)
+}
+
+// Pinger 支持主动检查可用性的存储后端, 就绪检查依赖此接口
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// 未配置存储后端时为 nil
+var store Store
+
+// ErrStorageUnavailable 存储暂时不可用 (数据库繁忙或被锁、磁盘已满、I/O 错误), 稍后重试可能成功
+// 后端将这类错误包装后返回, 其余错误视为永久性错误, 重试无意义
+var ErrStorageUnavailable = errors.New("存储暂时不可用")
+
+// 将可重试的底层错误包装为 ErrStorageUnavailable, 保留原始错误
+func transientStorageError(err error) error {
+	return fmt.Errorf("%w: %w", ErrStorageUnavailable, err)
+}
+
+// 按 cfg.Storage 打开存储后端: memory (MEMORY_CAPACITY) / jsonl (LOG_FILE) / sqlite (SQLITE_PATH)
+func openStore(cfg Config) (Store, error) {
+	switch cfg.Storage {
+	case "memory":
+		return NewRingStore(cfg.MemoryCapacity), nil
+	case "jsonl":
+		if cfg.LogFile == "" {
+			return nil, errors.New("STORAGE=jsonl 需要设置 LOG_FILE")
+		}
+		return NewJSONLStore(cfg.LogFile, cfg.rotateConfig(), systemClock)
+	case "sqlite":
+		return NewSQLiteStore(cfg.SQLitePath)
+	}
+	return nil, fmt.Errorf("未知的存储后端 %q (可选 memory/jsonl/sqlite)", cfg.Storage)
+}
+
+// 从全部记录中取出一页, records 按时间从新到旧排列
+func paginate(records []DeviceInfo, limit, offset int) []DeviceInfo {
+	if offset >= len(records) {
+		return []DeviceInfo{}
+	}
+	end := len(records)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return records[offset:end]
+}
+
+// 内存存储默认保留的记录数 (MEMORY_CAPACITY 环境变量)
+const defaultMemoryCapacity = 1000
+
+// RingStore 内存环形缓冲区, 只保留最近的 N 条记录, 写满后覆盖最旧的记录
+type RingStore struct {
+	records []DeviceInfo
+	next    int // 下一条记录写入的位置
+	size    int // 当前保存的记录数
+	mutex   sync.RWMutex
+}
+
+func NewRingStore(capacity int) *RingStore {
+	return &RingStore{records: make([]DeviceInfo, capacity)}
+}
+
+func (rs *RingStore) Insert(ctx context.Context, info DeviceInfo) error {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	rs.records[rs.next] = info
+	rs.next = (rs.next + 1) % len(rs.records)
+	if rs.size < len(rs.records) {
+		rs.size++
+	}
+	return nil
+}
+
+func (rs *RingStore) List(ctx context.Context, limit, offset int) ([]DeviceInfo, error) {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	if offset >= rs.size {
+		return []DeviceInfo{}, nil
+	}
+	n := rs.size - offset
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	// 从最近写入的位置往回取
+	records := make([]DeviceInfo, n)
+	for i := range records {
+		idx := (rs.next - 1 - offset - i + 2*len(rs.records)) % len(rs.records)
+		records[i] = rs.records[idx]
+	}
+	return records, nil
+}
+
+func (rs *RingStore) Find(ctx context.Context, filter DeviceFilter, limit, offset int) ([]DeviceInfo, error) {
+	records, _ := rs.List(ctx, 0, 0)
+	return findRecords(records, filter, limit, offset), nil
+}
+
+// 在锁内复制当前记录, 回调在锁外执行, 慢速的调用方不会阻塞写入
+func (rs *RingStore) Iterate(ctx context.Context, since string, fn func(DeviceInfo) error) error {
+	rs.mutex.RLock()
+	records := make([]DeviceInfo, 0, rs.size)
+	start := (rs.next - rs.size + len(rs.records)) % len(rs.records)
+	for i := 0; i < rs.size; i++ {
+		if info := rs.records[(start+i)%len(rs.records)]; since == "" || info.Timestamp >= since {
+			records = append(records, info)
+		}
+	}
+	rs.mutex.RUnlock()
+
+	for _, info := range records {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rs *RingStore) Delete(ctx context.Context, deviceID, cookieID string) (int, error) {
+	return rs.Purge(ctx, deviceMatcher(deviceID, cookieID))
+}
+
+func (rs *RingStore) Purge(ctx context.Context, expired func(DeviceInfo) bool) (int, error) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	// 按从旧到新的顺序取出保留的记录, 重新从头排列
+	kept := make([]DeviceInfo, 0, rs.size)
+	start := (rs.next - rs.size + len(rs.records)) % len(rs.records)
+	for i := 0; i < rs.size; i++ {
+		info := rs.records[(start+i)%len(rs.records)]
+		if !expired(info) {
+			kept = append(kept, info)
+		}
+	}
+	removed := rs.size - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+
+	clear(rs.records)
+	copy(rs.records, kept)
+	rs.size = len(kept)
+	rs.next = len(kept) % len(rs.records)
+	return removed, nil
+}
+
+func (rs *RingStore) Compact(ctx context.Context) (int, error) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	// 按从旧到新的顺序取出全部记录, 合并后重新从头排列
+	records := make([]DeviceInfo, rs.size)
+	start := (rs.next - rs.size + len(rs.records)) % len(rs.records)
+	for i := range records {
+		records[i] = rs.records[(start+i)%len(rs.records)]
+	}
+	merged, removed := planCompaction(records)
+	if len(removed) == 0 {
+		return 0, nil
+	}
+
+	for i, info := range merged {
+		records[i] = info
+	}
+	kept := make([]DeviceInfo, 0, len(records)-len(removed))
+	for i, info := range records {
+		if len(removed) > 0 && removed[0] == i {
+			removed = removed[1:]
+			continue
+		}
+		kept = append(kept, info)
+	}
+
+	clear(rs.records)
+	copy(rs.records, kept)
+	rs.size = len(kept)
+	rs.next = len(kept) % len(rs.records)
+	return len(records) - len(kept), nil
+}
+
+// 当前保存的记录数
+func (rs *RingStore) Len() int {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	return rs.size
+}
+
+func (rs *RingStore) Close() error {
+	return nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 每种存储后端各打开一个空实例, 测试结束时关闭
+func newTestStores(t *testing.T) map[string]Store {
+	t.Helper()
+	dir := t.TempDir()
+	jsonl, err := NewJSONLStore(filepath.Join(dir, "devices.jsonl"), RotateConfig{}, systemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlite, err := NewSQLiteStore(filepath.Join(dir, "devices.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]Store{
+		"memory": NewRingStore(100),
+		"jsonl":  jsonl,
+		"sqlite": sqlite,
+	}
+	t.Cleanup(func() {
+		for _, s := range stores {
+			s.Close()
+		}
+	})
+	return stores
+}
+
+// 替换全局存储, 测试结束时恢复
+func useStore(t *testing.T, s Store) {
+	t.Helper()
+	saved := store
+	store = s
+	t.Cleanup(func() { store = saved })
+}
+
+// 按 DeviceID 列出读到的记录
+func iterateIDs(t *testing.T, s Store, since string) []string {
+	t.Helper()
+	ids := []string{}
+	err := s.Iterate(context.Background(), since, func(info DeviceInfo) error {
+		ids = append(ids, info.DeviceID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStoreIterate(t *testing.T) {
+	records := []DeviceInfo{
+		{DeviceID: "a", Timestamp: "2024-01-01 10:00:00"},
+		{DeviceID: "b", Timestamp: "2024-01-02 10:00:00"},
+		{DeviceID: "c", Timestamp: "2024-01-01 12:00:00"}, // 回填的旧记录
+		{DeviceID: "d", Timestamp: "2024-01-03 10:00:00"},
+	}
+	tests := []struct {
+		since string
+		want  []string
+	}{
+		{"", []string{"a", "b", "c", "d"}},
+		{"2024-01-01 11:00:00", []string{"b", "c", "d"}},
+		{"2024-01-02 10:00:00", []string{"b", "d"}},
+		{"2024-02-01 00:00:00", []string{}},
+	}
+
+	for name, s := range newTestStores(t) {
+		for _, info := range records {
+			if err := s.Insert(context.Background(), info); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, tt := range tests {
+			if got := iterateIDs(t, s, tt.since); !equalStrings(got, tt.want) {
+				t.Errorf("%s: Iterate(since=%q) = %v, want %v", name, tt.since, got, tt.want)
+			}
+		}
+	}
+}
+
+// SQLite 分页读取跨过多页时不遗漏也不重复
+func TestSQLiteIteratePages(t *testing.T) {
+	s := newTestStores(t)["sqlite"]
+	n := 2*sqliteIteratePageSize + 7
+	for i := 0; i < n; i++ {
+		s.Insert(context.Background(), DeviceInfo{DeviceID: "d", Timestamp: "2024-01-01 10:00:00"})
+	}
+	if got := len(iterateIDs(t, s, "")); got != n {
+		t.Fatalf("读到 %d 条, want %d", got, n)
+	}
+}
+
+// 各后端保存、分页读取、按条件清理和删除的结果一致
+func TestStoreRoundTrip(t *testing.T) {
+	full := DeviceInfo{
+		DeviceID:       "a",
+		CookieID:       "cookie-a",
+		Timestamp:      "2024-01-01 10:00:00",
+		UserAgent:      "Mozilla/5.0 (X11; Linux x86_64)",
+		Screen:         "1920 x 1080",
+		ScreenWidth:    1920,
+		ScreenHeight:   1080,
+		Warnings:       []string{"geoip: 未配置"},
+		RequestHeaders: XMLMap[string]{"Accept-Language": "zh-CN"},
+	}
+	records := []DeviceInfo{
+		full,
+		{DeviceID: "b", CookieID: "cookie-b", Timestamp: "2024-01-02 10:00:00"},
+		{DeviceID: "c", CookieID: "cookie-a", Timestamp: "2024-01-03 10:00:00"},
+		{DeviceID: "a", Timestamp: "2024-01-04 10:00:00"},
+		{DeviceID: "d", Timestamp: "2024-01-05 10:00:00"},
+	}
+	ctx := context.Background()
+	ids := func(records []DeviceInfo) []string {
+		ids := []string{}
+		for _, info := range records {
+			ids = append(ids, info.DeviceID)
+		}
+		return ids
+	}
+
+	for name, s := range newTestStores(t) {
+		for _, info := range records {
+			if err := s.Insert(ctx, info); err != nil {
+				t.Fatalf("%s: Insert: %v", name, err)
+			}
+		}
+
+		pages := []struct {
+			limit, offset int
+			want          []string
+		}{
+			{0, 0, []string{"d", "a", "c", "b", "a"}},
+			{2, 0, []string{"d", "a"}},
+			{2, 2, []string{"c", "b"}},
+			{0, 3, []string{"b", "a"}},
+			{10, 5, []string{}},
+		}
+		for _, p := range pages {
+			got, err := s.List(ctx, p.limit, p.offset)
+			if err != nil {
+				t.Fatalf("%s: List: %v", name, err)
+			}
+			if !equalStrings(ids(got), p.want) {
+				t.Errorf("%s: List(%d, %d) = %v, want %v", name, p.limit, p.offset, ids(got), p.want)
+			}
+		}
+		// 保存再读出的记录与写入的完全相同
+		all, _ := s.List(ctx, 0, 0)
+		if !reflect.DeepEqual(all[len(all)-1], full) {
+			t.Errorf("%s: round trip = %+v, want %+v", name, all[len(all)-1], full)
+		}
+
+		purged, err := s.(Purger).Purge(ctx, func(info DeviceInfo) bool { return info.Timestamp < "2024-01-02 00:00:00" })
+		if err != nil || purged != 1 {
+			t.Errorf("%s: Purge = %d, %v, want 1", name, purged, err)
+		}
+		deleted, err := s.Delete(ctx, "a", "cookie-a")
+		if err != nil || deleted != 2 {
+			t.Errorf("%s: Delete = %d, %v, want 2", name, deleted, err)
+		}
+		if deleted, _ := s.Delete(ctx, "a", "cookie-a"); deleted != 0 {
+			t.Errorf("%s: repeated Delete = %d, want 0", name, deleted)
+		}
+		if got := iterateIDs(t, s, ""); !equalStrings(got, []string{"b", "d"}) {
+			t.Errorf("%s: remaining = %v, want [b d]", name, got)
+		}
+	}
+}
+
+// 并发提交到 /collect 时 JSONL 文件中的记录互不交错: 每行都是完整合法的 JSON, 行数与提交数相同
+func TestStoreConcurrentInsert(t *testing.T) {
+	const requests = 100
+	path := filepath.Join(t.TempDir(), "devices.jsonl")
+	jw, err := NewJSONLStore(path, RotateConfig{}, systemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jw.Close()
+	useStore(t, jw)
+
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// 长字段让每次写入都足够大, 交错写入时更容易暴露
+			body := fmt.Sprintf(`{"userAgent":"Mozilla/5.0 %s","screen":"1920x1080","canvasFingerprint":"canvas-%d"}`, strings.Repeat("x", 4096), i)
+			if w := postCollect("/collect", body, "User-Agent", "Mozilla/5.0"); w.Code != http.StatusOK {
+				t.Errorf("request %d: status = %d: %s", i, w.Code, w.Body)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != requests {
+		t.Fatalf("%d lines, want %d", len(lines), requests)
+	}
+	ids := make(map[string]bool)
+	for i, line := range lines {
+		var info DeviceInfo
+		if err := json.Unmarshal([]byte(line), &info); err != nil {
+			t.Fatalf("line %d is not valid JSON: %v", i+1, err)
+		}
+		ids[info.DeviceID] = true
+	}
+	if len(ids) != requests {
+		t.Errorf("%d distinct devices, want %d", len(ids), requests)
+	}
+}
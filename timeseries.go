@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// 时间序列支持的统计粒度
+var timeSeriesIntervals = map[string]time.Duration{
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+// TimeBucket 一个时间段内的提交数, Bucket 为时间段起点, 格式与记录的 timestamp 相同
+type TimeBucket struct {
+	Bucket string `json:"bucket" xml:"bucket"`
+	Count  int    `json:"count" xml:"count"`
+}
+
+// Bucketer 能在存储层按时间段汇总提交数的后端, 其余后端逐条读取记录后在内存中汇总
+type Bucketer interface {
+	// 统计 timestamp 不早于 since 的记录 (since 为空时统计全部), 按时间段从早到晚排列, 没有记录的时间段不返回
+	CountByInterval(ctx context.Context, interval time.Duration, since string) ([]TimeBucket, error)
+}
+
+// 在内存中按时间段汇总: 在 store.Iterate 中逐条计数, 只保留各时间段的计数
+// timestamp 是本地时间的墙上时间, 按 UTC 解析后截断, 时间段按墙上时间对齐 (1d 从零点开始), 与 SQLite 的计算一致
+func bucketRecords(ctx context.Context, s Store, interval time.Duration, since string) ([]TimeBucket, error) {
+	counts := make(map[string]int)
+	err := s.Iterate(ctx, since, func(info DeviceInfo) error {
+		t, err := time.Parse("2006-01-02 15:04:05", info.Timestamp)
+		if err == nil {
+			counts[t.Truncate(interval).Format("2006-01-02 15:04:05")]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]TimeBucket, 0, len(counts))
+	for bucket, count := range counts {
+		buckets = append(buckets, TimeBucket{Bucket: bucket, Count: count})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Bucket < buckets[j].Bucket
+	})
+	return buckets, nil
+}
+
+// 提交量时间序列: GET /stats/timeseries?interval=5m|1h|1d&since=RFC3339, interval 默认 1h
+func timeSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	since, ok := sinceQuery(w, r)
+	if !ok {
+		return
+	}
+
+	name := r.URL.Query().Get("interval")
+	if name == "" {
+		name = "1h"
+	}
+	interval, ok := timeSeriesIntervals[name]
+	if !ok {
+		sendResponse(w, r, http.StatusBadRequest, Response{
+			Status:  "error",
+			Code:    "invalid_param",
+			Message: "interval 可选 5m/1h/1d",
+		})
+		return
+	}
+
+	var buckets []TimeBucket
+	var err error
+	if bucketer, ok := store.(Bucketer); ok {
+		buckets, err = bucketer.CountByInterval(r.Context(), interval, since)
+	} else {
+		buckets, err = bucketRecords(r.Context(), store, interval, since)
+	}
+	if err != nil {
+		sendResponse(w, r, http.StatusInternalServerError, Response{
+			Status:  "error",
+			Code:    "storage_error",
+			Message: "读取设备信息失败: " + err.Error(),
+		})
+		return
+	}
+
+	sendResponse(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: "获取时间序列成功",
+		Data:    buckets,
+	})
+}
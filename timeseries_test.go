@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 内存中逐条汇总与 SQLite 在存储层汇总的结果一致
+func TestTimeSeriesHandler(t *testing.T) {
+	since, _ := time.ParseInLocation("2006-01-02 15:04:05", "2024-01-01 11:00:00", time.Local)
+	tests := []struct {
+		query string
+		want  []TimeBucket
+	}{
+		{"?interval=1h", []TimeBucket{{"2024-01-01 10:00:00", 2}, {"2024-01-01 11:00:00", 1}, {"2024-01-02 09:00:00", 1}}},
+		{"?interval=1d", []TimeBucket{{"2024-01-01 00:00:00", 3}, {"2024-01-02 00:00:00", 1}}},
+		{"?interval=1h&since=" + since.Format(time.RFC3339), []TimeBucket{{"2024-01-01 11:00:00", 1}, {"2024-01-02 09:00:00", 1}}},
+	}
+
+	for name, s := range newTestStores(t) {
+		for i, ts := range []string{"2024-01-01 10:05:00", "2024-01-01 10:55:00", "2024-01-01 11:30:00", "2024-01-02 09:00:00"} {
+			s.Insert(context.Background(), DeviceInfo{DeviceID: string(rune('a' + i)), Timestamp: ts})
+		}
+		useStore(t, s)
+
+		for _, tt := range tests {
+			w := httptest.NewRecorder()
+			timeSeriesHandler(w, httptest.NewRequest("GET", "/stats/timeseries"+tt.query, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s%s: status = %d: %s", name, tt.query, w.Code, w.Body)
+			}
+			var resp struct{ Data []TimeBucket }
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(resp.Data, tt.want) {
+				t.Errorf("%s%s: buckets = %v, want %v", name, tt.query, resp.Data, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+// 常见时区对应的国家 (ISO 3166 代码)
+// 只收录能明确对应到少数国家的时区, 不在表中的时区判定为 unknown
+var timezoneCountries = map[string][]string{
+	// 亚洲
+	"Asia/Shanghai":     {"CN"},
+	"Asia/Chongqing":    {"CN"},
+	"Asia/Urumqi":       {"CN"},
+	"Asia/Hong_Kong":    {"HK"},
+	"Asia/Macau":        {"MO"},
+	"Asia/Taipei":       {"TW"},
+	"Asia/Tokyo":        {"JP"},
+	"Asia/Seoul":        {"KR"},
+	"Asia/Singapore":    {"SG"},
+	"Asia/Kuala_Lumpur": {"MY"},
+	"Asia/Bangkok":      {"TH", "VN", "LA", "KH"},
+	"Asia/Ho_Chi_Minh":  {"VN"},
+	"Asia/Jakarta":      {"ID"},
+	"Asia/Manila":       {"PH"},
+	"Asia/Kolkata":      {"IN"},
+	"Asia/Calcutta":     {"IN"},
+	"Asia/Dubai":        {"AE", "OM"},
+	"Asia/Jerusalem":    {"IL"},
+	"Asia/Tehran":       {"IR"},
+	"Asia/Karachi":      {"PK"},
+	// 欧洲
+	"Europe/London":    {"GB", "IE", "IM", "JE", "GG"},
+	"Europe/Dublin":    {"IE"},
+	"Europe/Paris":     {"FR", "MC"},
+	"Europe/Berlin":    {"DE"},
+	"Europe/Madrid":    {"ES"},
+	"Europe/Rome":      {"IT", "SM", "VA"},
+	"Europe/Amsterdam": {"NL"},
+	"Europe/Brussels":  {"BE"},
+	"Europe/Zurich":    {"CH", "LI"},
+	"Europe/Vienna":    {"AT"},
+	"Europe/Stockholm": {"SE"},
+	"Europe/Oslo":      {"NO"},
+	"Europe/Warsaw":    {"PL"},
+	"Europe/Prague":    {"CZ", "SK"},
+	"Europe/Istanbul":  {"TR"},
+	"Europe/Moscow":    {"RU"},
+	"Europe/Kiev":      {"UA"},
+	"Europe/Kyiv":      {"UA"},
+	// 美洲
+	"America/New_York":     {"US"},
+	"America/Chicago":      {"US"},
+	"America/Denver":       {"US"},
+	"America/Phoenix":      {"US"},
+	"America/Los_Angeles":  {"US"},
+	"America/Anchorage":    {"US"},
+	"Pacific/Honolulu":     {"US"},
+	"America/Toronto":      {"CA"},
+	"America/Vancouver":    {"CA"},
+	"America/Mexico_City":  {"MX"},
+	"America/Sao_Paulo":    {"BR"},
+	"America/Buenos_Aires": {"AR"},
+	"America/Bogota":       {"CO"},
+	"America/Lima":         {"PE"},
+	"America/Santiago":     {"CL"},
+	// 大洋洲与非洲
+	"Australia/Sydney":    {"AU"},
+	"Australia/Melbourne": {"AU"},
+	"Australia/Perth":     {"AU"},
+	"Pacific/Auckland":    {"NZ"},
+	"Africa/Cairo":        {"EG"},
+	"Africa/Johannesburg": {"ZA", "LS", "SZ"},
+	"Africa/Lagos":        {"NG"},
+	"Africa/Nairobi":      {"KE"},
+}
+
+// 检查客户端上报的时区与IP所在国家是否一致
+// 返回 consistent/suspicious, 国家未知或时区不在表中时返回 unknown
+func checkTimezoneMismatch(timezone, country string) string {
+	countries, ok := timezoneCountries[timezone]
+	if !ok || country == "" {
+		return "unknown"
+	}
+	for _, c := range countries {
+		if c == country {
+			return "consistent"
+		}
+	}
+	return "suspicious"
+}
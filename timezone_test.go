@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestCheckTimezoneMismatch(t *testing.T) {
+	tests := []struct {
+		timezone string
+		country  string
+		want     string
+	}{
+		{"Asia/Shanghai", "CN", "consistent"},
+		{"America/New_York", "US", "consistent"},
+		{"Asia/Bangkok", "VN", "consistent"},
+		{"Europe/London", "IE", "consistent"},
+		{"America/New_York", "CN", "suspicious"},
+		{"Asia/Shanghai", "US", "suspicious"},
+		{"Europe/Berlin", "FR", "suspicious"},
+		// 国家未知或时区不在表中
+		{"Asia/Shanghai", "", "unknown"},
+		{"Mars/Olympus_Mons", "CN", "unknown"},
+		{"", "CN", "unknown"},
+	}
+	for _, tt := range tests {
+		if got := checkTimezoneMismatch(tt.timezone, tt.country); got != tt.want {
+			t.Errorf("checkTimezoneMismatch(%q, %q) = %q, want %q", tt.timezone, tt.country, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// 未配置导出地址时 otel 使用空实现, 创建 span 几乎没有开销
+var tracer = otel.Tracer("device-info-collector")
+
+// 是否已配置链路追踪 (OTEL_EXPORTER_OTLP_ENDPOINT)
+var tracingEnabled bool
+
+// 初始化链路追踪, 通过 OTLP/HTTP 将 span 批量导出到 endpoint
+// 返回的 shutdown 在退出时调用, 导出尚未发送的 span
+func initTracing(ctx context.Context, endpoint string) (shutdown func(context.Context) error, err error) {
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "device-info-collector"))),
+	)
+	otel.SetTracerProvider(provider)
+	// 采信上游通过 traceparent 等请求头传入的链路上下文
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	tracingEnabled = true
+	return provider.Shutdown, nil
+}
+
+// 为每个请求创建服务端 span, 以 "方法 路由模式" 命名, 避免按实际路径产生大量不同的 span 名称
+// 未启用链路追踪时不做包装
+func tracingMiddleware(mux *http.ServeMux) Middleware {
+	return func(next http.Handler) http.Handler {
+		if !tracingEnabled {
+			return next
+		}
+		return otelhttp.NewHandler(next, "http.server",
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				_, pattern := mux.Handler(r)
+				return r.Method + " " + pattern
+			}))
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// 监听的 Unix 套接字路径 (UNIX_SOCKET 环境变量), 为空时监听 TCP 端口
+var unixSocket string
+
+// 在 path 上监听 Unix 套接字并设置文件权限
+// 上次未正常退出遗留的套接字文件先删除; 路径上已有其他类型的文件时返回错误, 不误删
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s 已存在且不是套接字文件", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
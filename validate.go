@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError 提交数据缺少必填字段, Field 为 JSON 字段名
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// 校验客户端提交的数据: userAgent 必填, 且至少有一项参与设备ID计算的指纹字段
+// 用于过滤只提交 {} 的探测请求
+func (info DeviceInfo) Validate() error {
+	if strings.TrimSpace(info.UserAgent) == "" {
+		return &ValidationError{Field: "userAgent", Message: "不能为空"}
+	}
+	fingerprints := []string{
+		info.CanvasFingerprint,
+		info.WebGLFingerprint,
+		info.FontFingerprint,
+		info.AudioFingerprint,
+		info.Screen,
+		info.Platform,
+		info.Timezone,
+		info.HardwareConcurrency,
+	}
+	for _, v := range fingerprints {
+		if strings.TrimSpace(v) != "" {
+			return nil
+		}
+	}
+	return &ValidationError{
+		Field:   "canvasFingerprint/webglFingerprint/fontFingerprint/audioFingerprint/screen/platform/timezone/hardwareConcurrency",
+		Message: "至少需要提供一项",
+	}
+}
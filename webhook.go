@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// 待投递队列长度, 队列满时新记录直接写入死信文件
+	webhookQueueSize = 256
+	// 首次失败后的最大重试次数
+	webhookMaxRetries = 3
+)
+
+// 重试的初始等待时间, 每次翻倍
+var webhookBaseDelay = time.Second
+
+// WebhookSender 将新保存的设备信息异步 POST 到 WEBHOOK_URL
+// 配置了 dlqPath 时, 队列溢出或重试全部失败的记录以 JSON Lines 追加到该文件, 可通过 /webhook/replay 重新投递
+type WebhookSender struct {
+	url     string
+	client  *http.Client
+	queue   chan *webhookJob
+	retries map[*webhookJob]*time.Timer // 等待退避结束的记录, 到期后重新入队
+	done    chan struct{}
+	closed  bool
+	mutex   sync.Mutex
+
+	dlqPath   string
+	dlqMutex  sync.Mutex
+	replaying atomic.Bool
+	erased    []func(DeviceInfo) bool // 重新投递期间 Erase 的条件, 快照中符合条件的记录不再投递, 由 mutex 保护
+}
+
+// 一条待投递的记录及已失败的次数
+type webhookJob struct {
+	info     DeviceInfo
+	failures int
+}
+
+// 未配置 WEBHOOK_URL 时为 nil
+var webhook *WebhookSender
+
+func NewWebhookSender(url, dlqPath string) *WebhookSender {
+	ws := &WebhookSender{
+		url:     url,
+		dlqPath: dlqPath,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		queue:   make(chan *webhookJob, webhookQueueSize),
+		retries: make(map[*webhookJob]*time.Timer),
+		done:    make(chan struct{}),
+	}
+	go ws.run()
+	return ws
+}
+
+// 加入投递队列, 不阻塞; 队列已满时写入死信文件
+func (ws *WebhookSender) Enqueue(info DeviceInfo) {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+	if ws.closed {
+		return
+	}
+	select {
+	case ws.queue <- &webhookJob{info: info}:
+	default:
+		slog.Warn("Webhook 队列已满, 写入死信", "event", "webhook_overflow", "ip", info.IPAddress, "request_id", info.RequestID)
+		ws.writeDLQ(info)
+	}
+}
+
+// 停止接收新记录, 等待队列中的记录投递完成或 ctx 到期; 仍在等待重试的记录写入死信文件
+func (ws *WebhookSender) Close(ctx context.Context) {
+	ws.mutex.Lock()
+	ws.closed = true
+	close(ws.queue)
+	pending := make([]*webhookJob, 0, len(ws.retries))
+	for job, timer := range ws.retries {
+		timer.Stop()
+		pending = append(pending, job)
+	}
+	clear(ws.retries)
+	ws.mutex.Unlock()
+
+	for _, job := range pending {
+		ws.writeDLQ(job.info)
+	}
+
+	select {
+	case <-ws.done:
+	case <-ctx.Done():
+		slog.Warn("等待 Webhook 投递超时", "event", "webhook_timeout", "pending", len(ws.queue))
+	}
+}
+
+// 逐条投递; 失败的记录交给定时器退避重试, 不阻塞后续记录
+func (ws *WebhookSender) run() {
+	defer close(ws.done)
+	for job := range ws.queue {
+		err := ws.deliver(job.info)
+		if err == nil {
+			continue
+		}
+		job.failures++
+		if job.failures > webhookMaxRetries {
+			slog.Error("Webhook 投递失败", "event", "webhook_failed", "ip", job.info.IPAddress, "request_id", job.info.RequestID, "error", err)
+			ws.writeDLQ(job.info)
+			continue
+		}
+		slog.Debug("Webhook 投递失败, 稍后重试", "event", "webhook_retry", "attempt", job.failures, "error", err)
+		ws.retry(job)
+	}
+}
+
+// 退避 webhookBaseDelay * 2^(failures-1) 后重新入队; 届时队列已满或已关闭则写入死信文件
+func (ws *WebhookSender) retry(job *webhookJob) {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+	if ws.closed {
+		ws.writeDLQ(job.info)
+		return
+	}
+	delay := webhookBaseDelay << (job.failures - 1)
+	ws.retries[job] = time.AfterFunc(delay, func() {
+		ws.mutex.Lock()
+		defer ws.mutex.Unlock()
+		if _, ok := ws.retries[job]; !ok {
+			// 已被 Close 写入死信文件或被 Erase 删除
+			return
+		}
+		delete(ws.retries, job)
+		select {
+		case ws.queue <- job:
+		default:
+			slog.Warn("Webhook 队列已满, 写入死信", "event", "webhook_overflow", "ip", job.info.IPAddress, "request_id", job.info.RequestID)
+			ws.writeDLQ(job.info)
+		}
+	})
+}
+
+// 投递一条记录
+func (ws *WebhookSender) deliver(info DeviceInfo) error {
+	body, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return ws.post(body)
+}
+
+func (ws *WebhookSender) post(body []byte) error {
+	resp, err := ws.client.Post(ws.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// 将投递失败的记录追加到死信文件
+func (ws *WebhookSender) writeDLQ(info DeviceInfo) {
+	if ws.dlqPath == "" {
+		return
+	}
+
+	ws.dlqMutex.Lock()
+	defer ws.dlqMutex.Unlock()
+
+	f, err := os.OpenFile(ws.dlqPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err == nil {
+		err = json.NewEncoder(f).Encode(info)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		slog.Error("写入 WEBHOOK_DLQ 失败", "event", "storage_error", "ip", info.IPAddress, "request_id", info.RequestID, "error", err)
+	}
+}
+
+// 删除符合条件的待重试记录和死信文件 (包括正在重新投递的快照) 中的记录, 返回从文件中删除的条数
+func (ws *WebhookSender) Erase(match func(DeviceInfo) bool) (int, error) {
+	ws.mutex.Lock()
+	for job, timer := range ws.retries {
+		if match(job.info) {
+			timer.Stop()
+			delete(ws.retries, job)
+		}
+	}
+	if ws.replaying.Load() {
+		ws.erased = append(ws.erased, match)
+	}
+	ws.mutex.Unlock()
+
+	if ws.dlqPath == "" {
+		return 0, nil
+	}
+	ws.dlqMutex.Lock()
+	defer ws.dlqMutex.Unlock()
+
+	removed := 0
+	for _, path := range []string{ws.dlqPath, ws.replayPath()} {
+		n, err := filterDLQFile(path, func(line []byte) bool {
+			var info DeviceInfo
+			return json.Unmarshal(line, &info) != nil || !match(info)
+		})
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// 只保留 keep 返回 true 的行, 返回删除的行数; 文件不存在时不做任何事, 保留的行为空时删除文件
+// 调用方需持有 dlqMutex
+func filterDLQFile(path string, keep func(line []byte) bool) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var kept bytes.Buffer
+	removed := 0
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if !keep(line) {
+			removed++
+			continue
+		}
+		kept.Write(line)
+		kept.WriteByte('\n')
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, kept.Bytes(), 0o644); err != nil {
+		return 0, err
+	}
+	return removed, os.Rename(tmp, path)
+}
+
+var errReplayRunning = errors.New("上一次重新投递尚未完成")
+
+// 正在重新投递的死信快照; 进程在投递中途退出时保留, 下次重新投递时优先投递
+func (ws *WebhookSender) replayPath() string {
+	return ws.dlqPath + ".replay"
+}
+
+// 在后台重新投递死信文件中的记录, 返回待投递的条数
+// 持有 dlqMutex 时只把死信文件移为快照, 投递期间不加锁, 新的死信照常追加到死信文件
+// 每条只尝试一次, 投递失败或未来得及投递 (服务关闭) 的记录在结束时追加回死信文件
+func (ws *WebhookSender) Replay() (int, error) {
+	if !ws.replaying.CompareAndSwap(false, true) {
+		return 0, errReplayRunning
+	}
+	lines, err := ws.snapshotDLQ()
+	if err != nil || len(lines) == 0 {
+		ws.endReplay()
+		return 0, err
+	}
+
+	go func() {
+		defer ws.endReplay()
+		delivered := make(map[string]int)
+		sent := 0
+	loop:
+		for _, line := range lines {
+			select {
+			case <-ws.done:
+				// 服务已关闭, 其余记录留待下次重新投递
+				break loop
+			default:
+			}
+			if ws.replayErased(line) {
+				continue
+			}
+			if ws.post(line) == nil {
+				delivered[string(line)]++
+				sent++
+			}
+		}
+		remaining, err := ws.finishReplay(delivered)
+		if err != nil {
+			slog.Error("写回 Webhook 死信失败", "event", "webhook_error", "error", err)
+			return
+		}
+		slog.Info("重新投递 Webhook 死信", "event", "webhook_replay", "delivered", sent, "remaining", remaining)
+	}()
+	return len(lines), nil
+}
+
+// 结束重新投递; 与 Erase 检查 replaying 使用同一把锁, 不会留下过期的删除条件
+func (ws *WebhookSender) endReplay() {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+	ws.erased = nil
+	ws.replaying.Store(false)
+}
+
+// 快照中的记录是否已在重新投递期间被 Erase 删除
+func (ws *WebhookSender) replayErased(line []byte) bool {
+	var info DeviceInfo
+	if json.Unmarshal(line, &info) != nil {
+		return false
+	}
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+	for _, match := range ws.erased {
+		if match(info) {
+			return true
+		}
+	}
+	return false
+}
+
+// 将死信文件移为快照并读出其中的记录; 上次投递中断留下的快照优先, 此时死信文件保持不动
+func (ws *WebhookSender) snapshotDLQ() ([][]byte, error) {
+	ws.dlqMutex.Lock()
+	defer ws.dlqMutex.Unlock()
+
+	if _, err := os.Stat(ws.replayPath()); os.IsNotExist(err) {
+		if err := os.Rename(ws.dlqPath, ws.replayPath()); err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+	}
+	data, err := os.ReadFile(ws.replayPath())
+	if err != nil {
+		return nil, err
+	}
+	var lines [][]byte
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// 把快照中未投递成功的记录追加回死信文件并删除快照, 返回追加的条数
+// 重新读取快照而不是使用内存中的副本, 投递期间被 Erase 删除的记录不会写回
+func (ws *WebhookSender) finishReplay(delivered map[string]int) (int, error) {
+	ws.dlqMutex.Lock()
+	defer ws.dlqMutex.Unlock()
+
+	if _, err := filterDLQFile(ws.replayPath(), func(line []byte) bool {
+		if delivered[string(line)] > 0 {
+			delivered[string(line)]--
+			return false
+		}
+		return true
+	}); err != nil {
+		return 0, err
+	}
+	data, err := os.ReadFile(ws.replayPath())
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(data) > 0 {
+		f, err := os.OpenFile(ws.dlqPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return 0, err
+		}
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return bytes.Count(data, []byte("\n")), os.Remove(ws.replayPath())
+}
+
+// 重新投递 Webhook 死信: POST /webhook/replay
+func webhookReplayHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		sendResponse(w, r, http.StatusMethodNotAllowed, Response{
+			Status:  "error",
+			Code:    "method_not_allowed",
+			Message: "Only POST method is allowed",
+		})
+		return
+	}
+
+	if webhook == nil || webhook.dlqPath == "" {
+		sendResponse(w, r, http.StatusNotFound, Response{
+			Status:  "error",
+			Code:    "not_enabled",
+			Message: "Webhook 死信未启用",
+		})
+		return
+	}
+
+	queued, err := webhook.Replay()
+	if errors.Is(err, errReplayRunning) {
+		sendResponse(w, r, http.StatusConflict, Response{
+			Status:  "error",
+			Code:    "replay_running",
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		sendResponse(w, r, http.StatusInternalServerError, Response{
+			Status:  "error",
+			Code:    "webhook_error",
+			Message: "重新投递失败: " + err.Error(),
+		})
+		return
+	}
+
+	// 投递在后台进行, 结果记录在 event 为 webhook_replay 的日志中
+	slog.InfoContext(r.Context(), "开始重新投递 Webhook 死信", "event", "webhook_replay_start", "queued", queued)
+	sendResponse(w, r, http.StatusAccepted, Response{
+		Status:  "success",
+		Message: "已开始重新投递",
+		Data:    XMLMap[int]{"queued": queued},
+	})
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func useWebhookBaseDelay(t *testing.T, d time.Duration) {
+	t.Helper()
+	saved := webhookBaseDelay
+	webhookBaseDelay = d
+	t.Cleanup(func() { webhookBaseDelay = saved })
+}
+
+// 读取死信文件中的请求ID
+func dlqRequestIDs(t *testing.T, path string) []string {
+	t.Helper()
+	ids := []string{}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return ids
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var info DeviceInfo
+		if err := json.Unmarshal(scanner.Bytes(), &info); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, info.RequestID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// 按请求ID返回状态码的测试服务, 记录每个请求ID被投递的次数
+type webhookServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	attempts map[string]int
+	status   func(id string, attempt int) int
+}
+
+func newWebhookServer(t *testing.T, status func(id string, attempt int) int) *webhookServer {
+	ws := &webhookServer{attempts: make(map[string]int), status: status}
+	ws.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var info DeviceInfo
+		json.NewDecoder(r.Body).Decode(&info)
+		ws.mutex.Lock()
+		ws.attempts[info.RequestID]++
+		attempt := ws.attempts[info.RequestID]
+		ws.mutex.Unlock()
+		w.WriteHeader(ws.status(info.RequestID, attempt))
+	}))
+	t.Cleanup(ws.Close)
+	return ws
+}
+
+func (s *webhookServer) Attempts(id string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.attempts[id]
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	useWebhookBaseDelay(t, time.Millisecond)
+	tests := []struct {
+		name     string
+		failures int // 前几次投递返回 500
+		attempts int
+		dlq      bool
+	}{
+		{"first attempt", 0, 1, false},
+		{"recovers after retries", 2, 3, false},
+		{"last retry succeeds", webhookMaxRetries, webhookMaxRetries + 1, false},
+		{"retries exhausted", webhookMaxRetries + 1, webhookMaxRetries + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newWebhookServer(t, func(id string, attempt int) int {
+				if attempt <= tt.failures {
+					return http.StatusInternalServerError
+				}
+				return http.StatusOK
+			})
+			dlq := filepath.Join(t.TempDir(), "dlq.jsonl")
+			ws := NewWebhookSender(server.URL, dlq)
+			ws.Enqueue(DeviceInfo{RequestID: "r1"})
+
+			waitFor(t, "delivery attempts", func() bool { return server.Attempts("r1") == tt.attempts })
+			if tt.dlq {
+				waitFor(t, "dead letter", func() bool { return len(dlqRequestIDs(t, dlq)) == 1 })
+			}
+			ws.Close(context.Background())
+
+			if got := server.Attempts("r1"); got != tt.attempts {
+				t.Errorf("attempts = %d, want %d", got, tt.attempts)
+			}
+			want := []string{}
+			if tt.dlq {
+				want = []string{"r1"}
+			}
+			if got := dlqRequestIDs(t, dlq); !equalStrings(got, want) {
+				t.Errorf("dlq = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// 等待重试的记录不阻塞后续记录的投递, 关闭时写入死信文件
+func TestWebhookBackoffDoesNotBlock(t *testing.T) {
+	useWebhookBaseDelay(t, time.Hour)
+	server := newWebhookServer(t, func(id string, attempt int) int {
+		if id == "failing" {
+			return http.StatusBadGateway
+		}
+		return http.StatusOK
+	})
+	dlq := filepath.Join(t.TempDir(), "dlq.jsonl")
+	ws := NewWebhookSender(server.URL, dlq)
+
+	ws.Enqueue(DeviceInfo{RequestID: "failing"})
+	ws.Enqueue(DeviceInfo{RequestID: "ok"})
+	waitFor(t, "delivery behind a failing record", func() bool { return server.Attempts("ok") == 1 })
+
+	ws.Close(context.Background())
+	if got := server.Attempts("failing"); got != 1 {
+		t.Errorf("failing attempts = %d, want 1", got)
+	}
+	if got := dlqRequestIDs(t, dlq); !equalStrings(got, []string{"failing"}) {
+		t.Errorf("dlq = %v, want [failing]", got)
+	}
+
+	// 关闭后不再接收新记录
+	ws.Enqueue(DeviceInfo{RequestID: "late"})
+	if got := dlqRequestIDs(t, dlq); !equalStrings(got, []string{"failing"}) {
+		t.Errorf("dlq after close = %v, want [failing]", got)
+	}
+}
+
+// 队列已满时新记录写入死信文件而不是丢弃
+func TestWebhookOverflow(t *testing.T) {
+	release := make(chan struct{})
+	var received atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Store(true)
+		<-release
+	}))
+	defer server.Close()
+
+	dlq := filepath.Join(t.TempDir(), "dlq.jsonl")
+	ws := NewWebhookSender(server.URL, dlq)
+	ws.Enqueue(DeviceInfo{RequestID: "in-flight"})
+	waitFor(t, "first delivery", received.Load)
+
+	for i := 0; i < webhookQueueSize; i++ {
+		ws.Enqueue(DeviceInfo{RequestID: "queued"})
+	}
+	ws.Enqueue(DeviceInfo{RequestID: "overflow-1"})
+	ws.Enqueue(DeviceInfo{RequestID: "overflow-2"})
+	if got := dlqRequestIDs(t, dlq); !equalStrings(got, []string{"overflow-1", "overflow-2"}) {
+		t.Errorf("dlq = %v, want overflowed records", got)
+	}
+
+	close(release)
+	ws.Close(context.Background())
+	if got := dlqRequestIDs(t, dlq); len(got) != 2 {
+		t.Errorf("dlq after drain = %v, want 2 records", got)
+	}
+}
+
+// 重新投递在后台进行且不持有死信文件的锁: 投递期间新的死信照常写入, 被删除的记录不会写回
+func TestWebhookReplay(t *testing.T) {
+	release := make(chan struct{})
+	var mutex sync.Mutex
+	attempts := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var info DeviceInfo
+		json.NewDecoder(r.Body).Decode(&info)
+		mutex.Lock()
+		attempts[info.RequestID]++
+		mutex.Unlock()
+		if info.RequestID == "blocking" {
+			<-release
+		}
+		if info.RequestID == "failing" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	dlq := filepath.Join(t.TempDir(), "dlq.jsonl")
+	ws := NewWebhookSender(server.URL, dlq)
+	defer ws.Close(context.Background())
+	for _, id := range []string{"blocking", "failing", "erased", "ok"} {
+		ws.writeDLQ(DeviceInfo{RequestID: id})
+	}
+
+	queued, err := ws.Replay()
+	if err != nil || queued != 4 {
+		t.Fatalf("Replay = %d, %v, want 4", queued, err)
+	}
+	if _, err := ws.Replay(); err != errReplayRunning {
+		t.Errorf("concurrent Replay err = %v, want errReplayRunning", err)
+	}
+
+	// 第一条记录的投递被阻塞时, 写入死信和删除都不等待
+	waitFor(t, "blocked delivery", func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return attempts["blocking"] == 1
+	})
+	ws.writeDLQ(DeviceInfo{RequestID: "new"})
+	if n, err := ws.Erase(func(info DeviceInfo) bool { return info.RequestID == "erased" }); err != nil || n != 1 {
+		t.Errorf("Erase = %d, %v, want 1", n, err)
+	}
+	if got := dlqRequestIDs(t, dlq); !equalStrings(got, []string{"new"}) {
+		t.Errorf("dlq during replay = %v, want [new]", got)
+	}
+
+	close(release)
+	waitFor(t, "replay", func() bool { return !ws.replaying.Load() })
+	if got := dlqRequestIDs(t, dlq); !equalStrings(got, []string{"failing", "new"}) {
+		t.Errorf("dlq after replay = %v, want [failing new]", got)
+	}
+	if _, err := os.Stat(ws.replayPath()); !os.IsNotExist(err) {
+		t.Errorf("replay snapshot left behind: %v", err)
+	}
+	if attempts["ok"] != 1 || attempts["erased"] != 0 || attempts["new"] != 0 {
+		t.Errorf("attempts = %v", attempts)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/xml"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// XMLMap 可编码为 XML 的映射, encoding/xml 不支持 map
+// 每个键值对编码为 <entry key="键">值</entry>, 按键排序; JSON 编码与普通 map 相同
+type XMLMap[V any] map[string]V
+
+func (m XMLMap[V]) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		entry := xml.StartElement{
+			Name: xml.Name{Local: "entry"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: k}},
+		}
+		if err := e.EncodeElement(m[k], entry); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// 编码为带 XML 声明的文档
+func marshalXML(v any) ([]byte, error) {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// 根据 Accept 头判断客户端是否要求 XML
+// 按 q 值取 JSON 和 XML 中优先级较高的一方, 相同或都未列出 (含 */*) 时使用 JSON
+func prefersXML(accept string) bool {
+	jsonQ, xmlQ := -1.0, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		switch mediaType {
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		case "application/xml", "text/xml":
+			xmlQ = max(xmlQ, q)
+		}
+	}
+	return xmlQ > 0 && xmlQ > jsonQ
+}